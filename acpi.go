@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+type acpiTableOutput struct {
+	Signature string `json:"signature"`
+	Address   string `json:"address"`
+	Length    int    `json:"length"`
+}
+
+type acpiCheckOutput struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Match    bool   `json:"match"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+type acpiOutput struct {
+	LoaderHash string            `json:"acpi_loader_hash"`
+	RsdpHash   string            `json:"acpi_rsdp_hash"`
+	TablesHash string            `json:"acpi_tables_hash"`
+	Tables     []acpiTableOutput `json:"tables"`
+	// Captured lists the captured ACPI hashes the blobs reproduce, as "configuration/epoch".
+	Captured []string          `json:"captured"`
+	Commands []string          `json:"commands,omitempty"`
+	Checks   []acpiCheckOutput `json:"checks,omitempty"`
+}
+
+func sha384Hex(data []byte) string {
+	h := sha512.Sum384(data)
+	return fmt.Sprintf("%x", h)
+}
+
+// diffTableLoader describes the first difference between two table loader command streams.
+func diffTableLoader(expected, actual []internal.TableLoaderCommand) string {
+	for i := range min(len(expected), len(actual)) {
+		if expected[i] != actual[i] {
+			return fmt.Sprintf("command %d: expected %s, got %s", i, expected[i], actual[i])
+		}
+	}
+	if len(expected) != len(actual) {
+		return fmt.Sprintf("expected %d commands, got %d", len(expected), len(actual))
+	}
+	return ""
+}
+
+// runAcpi rebuilds the ACPI blobs for a table set, runs the table loader over them and optionally
+// compares the result with blobs captured from a VM. The embedded templates reproduce no captured
+// ACPI hashes, so reference values only use the catalog hashes; this command is for investigating
+// the difference.
+func runAcpi(args []string) int {
+	var (
+		vcpus      int
+		tablesPath string
+		loaderPath string
+		rsdpPath   string
+		commands   bool
+	)
+
+	fs := flag.NewFlagSet("acpi", flag.ExitOnError)
+	fs.IntVar(&vcpus, "vcpus", 0, "Number of vCPUs selecting the embedded ACPI tables template")
+	fs.StringVar(&tablesPath, "tables", "", "Path to a captured etc/acpi/tables blob (instead of -vcpus)")
+	fs.StringVar(&loaderPath, "loader", "", "Path to a captured etc/table-loader blob to compare against")
+	fs.StringVar(&rsdpPath, "rsdp", "", "Path to a captured etc/acpi/rsdp blob to compare against")
+	fs.BoolVar(&commands, "commands", false, "Include the table loader commands in the output")
+	fs.Parse(args)
+
+	var acpi *internal.AcpiTables
+	var err error
+	switch {
+	case tablesPath != "":
+		tablesData, rerr := os.ReadFile(tablesPath)
+		if rerr != nil {
+			fmt.Printf("Error reading ACPI tables: %v\n", rerr)
+			return 1
+		}
+		acpi, err = internal.LinkAcpiTables(tablesData)
+	case vcpus != 0:
+		acpi, err = internal.BuildAcpiTables(vcpus)
+	default:
+		fmt.Printf("Error: either -vcpus or -tables is required\n")
+		return 1
+	}
+	if err != nil {
+		fmt.Printf("Error building ACPI tables: %v\n", err)
+		return 1
+	}
+
+	state, err := acpi.Execute()
+	if err != nil {
+		fmt.Printf("Error running table loader: %v\n", err)
+		return 1
+	}
+	installed, err := state.InstalledTables()
+	if err != nil {
+		fmt.Printf("Error installing ACPI tables: %v\n", err)
+		return 1
+	}
+
+	output := acpiOutput{
+		LoaderHash: sha384Hex(acpi.Loader),
+		RsdpHash:   sha384Hex(acpi.Rsdp),
+		TablesHash: sha384Hex(acpi.Tables),
+		Captured:   acpi.CapturedEpochs(internal.DefaultCatalog()),
+	}
+	if output.Captured == nil {
+		output.Captured = []string{}
+		fmt.Fprintf(os.Stderr, "Warning: the ACPI hashes match no captured value; they are unverified\n")
+	}
+	for _, t := range installed {
+		output.Tables = append(output.Tables, acpiTableOutput{
+			Signature: t.Signature,
+			Address:   fmt.Sprintf("%#x", t.Address),
+			Length:    t.Length,
+		})
+	}
+	if commands {
+		for _, c := range acpi.Commands {
+			output.Commands = append(output.Commands, c.String())
+		}
+	}
+
+	if loaderPath != "" {
+		loaderData, err := os.ReadFile(loaderPath)
+		if err != nil {
+			fmt.Printf("Error reading table loader: %v\n", err)
+			return 1
+		}
+		check := acpiCheckOutput{Name: "loader", Expected: output.LoaderHash, Actual: sha384Hex(loaderData)}
+		check.Match = check.Expected == check.Actual
+		if !check.Match {
+			captured, err := internal.ParseTableLoader(loaderData)
+			if err != nil {
+				check.Detail = err.Error()
+			} else {
+				check.Detail = diffTableLoader(acpi.Commands, captured)
+			}
+		}
+		output.Checks = append(output.Checks, check)
+	}
+	if rsdpPath != "" {
+		rsdpData, err := os.ReadFile(rsdpPath)
+		if err != nil {
+			fmt.Printf("Error reading RSDP: %v\n", err)
+			return 1
+		}
+		check := acpiCheckOutput{Name: "rsdp", Expected: output.RsdpHash, Actual: sha384Hex(rsdpData)}
+		check.Match = check.Expected == check.Actual
+		if !check.Match {
+			check.Detail = fmt.Sprintf("expected %x, got %x", acpi.Rsdp, rsdpData)
+		}
+		output.Checks = append(output.Checks, check)
+	}
+
+	jsonData, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(jsonData))
+
+	for _, c := range output.Checks {
+		if !c.Match {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// appFlags selects the dstack app deployment RTMR3 is computed for.
+type appFlags struct {
+	composePath string
+	normalize   bool
+	eventOrder  string
+	appID       string
+	instanceID  string
+	keyProvider string
+}
+
+func (a *appFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&a.composePath, "app-compose", "", "Path to the app-compose.json of the app; enables the RTMR3 computation")
+	fs.BoolVar(&a.normalize, "app-compose-normalize", false, "Hash the normalized app-compose.json instead of the file as is, for apps deployed with the normalized document")
+	fs.StringVar(&a.eventOrder, "runtime-events", strings.Join(internal.DefaultRuntimeEventOrder, ","), "Runtime events in the order the dstack guest extends them into RTMR3 (comma-separated), which differs between dstack versions")
+	fs.StringVar(&a.appID, "app-id", "", "App ID (hex); defaults to the ID derived from the compose hash")
+	fs.StringVar(&a.instanceID, "instance-id", "", "Instance ID (hex); empty for apps without instance IDs")
+	fs.StringVar(&a.keyProvider, "key-provider", "", "Key provider as name:id, e.g. kms:<hex root CA public key>")
+}
+
+// decodeHexID decodes a hex-encoded identifier, with or without a 0x prefix.
+func decodeHexID(name string, s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", name, s, err)
+	}
+	return b, nil
+}
+
+// composeHash reads an app-compose.json and computes its compose hash: the SHA-256 of the file
+// as is, which is what dstack measures, or of its normalized form.
+func composeHash(path string, normalize bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app compose file: %w", err)
+	}
+	compose, err := internal.ParseAppCompose(data)
+	if err != nil {
+		return nil, err
+	}
+	if normalize {
+		return compose.ComposeHash()
+	}
+	h := sha256.Sum256(data)
+	return h[:], nil
+}
+
+// runtimeEventOrder returns the runtime event order selected with -runtime-events.
+func (a *appFlags) runtimeEventOrder() []string {
+	return strings.Split(a.eventOrder, ",")
+}
+
+// deployment returns the app deployment selected with -app-compose, or nil if none was given.
+func (a *appFlags) deployment() (*internal.AppDeployment, error) {
+	if a.composePath == "" {
+		if a.appID != "" || a.instanceID != "" || a.keyProvider != "" {
+			return nil, fmt.Errorf("-app-id, -instance-id and -key-provider require -app-compose")
+		}
+		return nil, nil
+	}
+	if a.keyProvider == "" {
+		return nil, fmt.Errorf("-key-provider is required with -app-compose")
+	}
+	keyProvider, err := internal.ParseKeyProvider(a.keyProvider)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := composeHash(a.composePath, a.normalize)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &internal.AppDeployment{
+		ComposeHash: hash,
+		AppID:       internal.AppIDFromComposeHash(hash),
+		KeyProvider: keyProvider,
+		EventOrder:  a.runtimeEventOrder(),
+	}
+	if a.appID != "" {
+		if d.AppID, err = decodeHexID("app ID", a.appID); err != nil {
+			return nil, err
+		}
+	}
+	if d.InstanceID, err = decodeHexID("instance ID", a.instanceID); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+type composeOutput struct {
+	ComposeHash string `json:"compose_hash"`
+	AppID       string `json:"app_id"`
+	// NormalizedComposeHash is set when the file is not in normalized form, and so hashes
+	// differently when deployed normalized.
+	NormalizedComposeHash string `json:"normalized_compose_hash,omitempty"`
+	Normalized            string `json:"normalized,omitempty"`
+}
+
+// runCompose computes the compose hash and derived app ID of an app-compose.json. dstack measures
+// the file as deployed, so the file is hashed as is unless -normalize is given.
+func runCompose(args []string) int {
+	var (
+		composePath string
+		normalize   bool
+		normalized  bool
+	)
+	fs := flag.NewFlagSet("compose", flag.ExitOnError)
+	fs.StringVar(&composePath, "app-compose", "", "Path to the app-compose.json of the app")
+	fs.BoolVar(&normalize, "normalize", false, "Hash the normalized document instead of the file as is")
+	fs.BoolVar(&normalized, "normalized", false, "Include the normalized document in the output")
+	fs.Parse(args)
+
+	if composePath == "" {
+		fmt.Println("Error: -app-compose is required")
+		return 1
+	}
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		fmt.Printf("Error: failed to read app compose file: %v\n", err)
+		return 1
+	}
+	compose, err := internal.ParseAppCompose(data)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	doc, err := compose.Normalize()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	hash, normalizedHash := sha256.Sum256(data), sha256.Sum256(doc)
+	if normalize {
+		hash = normalizedHash
+	}
+	output := composeOutput{
+		ComposeHash: hex.EncodeToString(hash[:]),
+		AppID:       hex.EncodeToString(internal.AppIDFromComposeHash(hash[:])),
+	}
+	if !normalize && normalizedHash != hash {
+		output.NormalizedComposeHash = hex.EncodeToString(normalizedHash[:])
+		fmt.Fprintln(os.Stderr, "Warning: app-compose.json is not normalized; it hashes to normalized_compose_hash if deployed normalized")
+	}
+	if normalized {
+		output.Normalized = string(doc)
+	}
+	jsonData, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(jsonData))
+	return 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComposeHash(t *testing.T) {
+	// Not normalized: indented, so the raw and normalized hashes differ.
+	data := []byte("{\n  \"runner\": \"docker-compose\",\n  \"docker_compose_file\": \"services: {}\"\n}\n")
+	path := filepath.Join(t.TempDir(), "app-compose.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := composeHash(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256(data); string(raw) != string(want[:]) {
+		t.Errorf("composeHash() = %x, want the hash of the file as is %x", raw, want)
+	}
+	normalized, err := composeHash(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(normalized) == string(raw) {
+		t.Error("composeHash(normalize) = the raw hash, want the hash of the normalized document")
+	}
+}
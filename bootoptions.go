@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// bootFlags selects the boot options replacing the catalog boot variants.
+type bootFlags struct {
+	options   string
+	disk      string
+	dataDisks int
+}
+
+func (b *bootFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&b.options, "boot-options", "", "Path to a boot configuration (JSON) the BootOrder and Boot#### events are computed from; defaults to the catalog boot variants")
+	fs.StringVar(&b.disk, "boot-disk", "", "Boot disk interface (nvme, scsi or virtio) the boot options are computed for; defaults to the catalog boot variants")
+	fs.IntVar(&b.dataDisks, "data-disks", 0, "Number of data disks attached next to the boot disk (with -boot-disk)")
+}
+
+// configuration returns the boot configuration selected with -boot-options or -boot-disk, or nil
+// to use the catalog boot variants.
+func (b *bootFlags) configuration() (*internal.BootConfiguration, error) {
+	switch {
+	case b.options != "" && b.disk != "":
+		return nil, fmt.Errorf("-boot-options cannot be combined with -boot-disk")
+	case b.options != "":
+		return internal.LoadBootConfiguration(b.options)
+	case b.disk != "":
+		boot, err := internal.DiskTopology{Interface: b.disk, DataDisks: b.dataDisks}.BootConfiguration()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build boot options: %w", err)
+		}
+		return boot, nil
+	case b.dataDisks != 0:
+		return nil, fmt.Errorf("-data-disks requires -boot-disk")
+	}
+	return nil, nil
+}
+
+type bootVariableOutput struct {
+	Name           string `json:"name"`
+	Description    string `json:"description,omitempty"`
+	DevicePath     string `json:"device_path,omitempty"`
+	Data           string `json:"data"`
+	Digest         string `json:"digest"`
+	MatchesCatalog bool   `json:"matches_catalog"`
+}
+
+// runBootOptions encodes the selected boot options and prints the EV_EFI_VARIABLE_BOOT digests
+// of the BootOrder and Boot#### variables, compared with the catalog.
+func runBootOptions(args []string) int {
+	var (
+		boot        bootFlags
+		catalogPath string
+	)
+	fs := flag.NewFlagSet("bootoptions", flag.ExitOnError)
+	boot.register(fs)
+	fs.StringVar(&catalogPath, "catalog", "", "Path to a measurement catalog (defaults to the embedded catalog)")
+	fs.Parse(args)
+
+	config, err := boot.configuration()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if config == nil {
+		fmt.Println("Error: -boot-options or -boot-disk is required")
+		return 1
+	}
+	registry, err := loadRegistry(catalogPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	events, err := config.Events()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	known := registry.Catalog().BootDigests()
+	output := []bootVariableOutput{}
+	for i, e := range events {
+		out := bootVariableOutput{
+			Name:   e.Description,
+			Data:   fmt.Sprintf("%x", e.Preimage),
+			Digest: fmt.Sprintf("%x", e.Digest),
+		}
+		// The first event is BootOrder, followed by the options in order.
+		if i > 0 {
+			out.Description = config.Options[i-1].Description
+			out.DevicePath = config.Options[i-1].DevicePath
+		}
+		for _, d := range known[e.Description] {
+			out.MatchesCatalog = out.MatchesCatalog || bytes.Equal(e.Digest, d)
+		}
+		output = append(output, out)
+	}
+	jsonData, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(jsonData))
+	return 0
+}
@@ -0,0 +1,23 @@
+//go:build firmware_bundle
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// firmwareFiles holds the published firmware images, stored as firmware/<sha384>.fd.
+//
+//go:embed firmware/*.fd
+var firmwareFiles embed.FS
+
+var firmwareBundle = mustSub(firmwareFiles, "firmware")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,8 @@
+//go:build !firmware_bundle
+
+package main
+
+import "io/fs"
+
+// firmwareBundle is nil unless the binary is built with the firmware_bundle tag.
+var firmwareBundle fs.FS
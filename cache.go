@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+type cacheEntryOutput struct {
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+	Valid    bool   `json:"valid"`
+	Known    bool   `json:"known"`
+}
+
+// openFirmwareCache opens the cache in dir, or in the default location when dir is empty.
+func openFirmwareCache(dir string) (*internal.FirmwareCache, error) {
+	if dir == "" {
+		var err error
+		if dir, err = internal.DefaultFirmwareCacheDir(); err != nil {
+			return nil, fmt.Errorf("failed to locate cache directory: %w", err)
+		}
+	}
+	return internal.NewFirmwareCache(dir)
+}
+
+// runCache implements the cache subcommand.
+func runCache(args []string) int {
+	usage := func() {
+		fmt.Printf("Usage: %s cache <list|prune> [-dir path] [-catalog path] [-all]\n", os.Args[0])
+	}
+	if len(args) < 1 {
+		usage()
+		return 1
+	}
+
+	var (
+		dir         string
+		catalogPath string
+		all         bool
+	)
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	fs.StringVar(&dir, "dir", "", "Firmware cache directory (defaults to the user cache directory)")
+	fs.StringVar(&catalogPath, "catalog", "", "Path to a measurement catalog listing the known firmware (defaults to the embedded catalog)")
+	if args[0] == "prune" {
+		fs.BoolVar(&all, "all", false, "Remove all cached firmware, not only unknown and corrupted files")
+	}
+	fs.Parse(args[1:])
+
+	registry, err := loadRegistry(catalogPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	cache, err := openFirmwareCache(dir)
+	if err != nil {
+		fmt.Printf("Error opening firmware cache: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		list, err := cache.List()
+		if err != nil {
+			fmt.Printf("Error listing firmware cache: %v\n", err)
+			return 1
+		}
+		output := []cacheEntryOutput{}
+		for _, f := range list {
+			output = append(output, cacheEntryOutput{
+				Hash:     f.Hash,
+				Size:     f.Size,
+				Modified: f.ModTime.UTC().Format("2006-01-02T15:04:05Z"),
+				Valid:    f.Valid,
+				Known:    registry.IsKnownFirmware(f.Hash),
+			})
+		}
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+
+	case "prune":
+		keep := registry.IsKnownFirmware
+		if all {
+			keep = nil
+		}
+		removed, err := cache.Prune(keep)
+		for _, name := range removed {
+			fmt.Printf("Removed %s\n", name)
+		}
+		if err != nil {
+			fmt.Printf("Error pruning firmware cache: %v\n", err)
+			return 1
+		}
+
+	default:
+		usage()
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// loadRegistry returns a registry backed by the catalog at path, or by the embedded catalog when
+// path is empty.
+func loadRegistry(path string) (*internal.Registry, error) {
+	if path == "" {
+		return internal.NewDefaultRegistry(), nil
+	}
+	catalog, err := internal.LoadCatalog(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load catalog: %w", err)
+	}
+	return internal.NewRegistry(catalog), nil
+}
+
+// runCatalog implements the catalog subcommand.
+func runCatalog(args []string) int {
+	if len(args) < 1 || args[0] != "ingest" {
+		fmt.Printf("Usage: %s catalog ingest -machine name -eventlog path [-catalog path] [-out path] [-epoch name] [-date YYYY-MM-DD]\n", os.Args[0])
+		return 1
+	}
+
+	var (
+		machine     string
+		eventLog    string
+		catalogPath string
+		outPath     string
+		epoch       string
+		date        string
+	)
+	fs := flag.NewFlagSet("catalog ingest", flag.ExitOnError)
+	fs.StringVar(&machine, "machine", "", "Machine configuration the event log was captured on (e.g., c3-standard-22)")
+	fs.StringVar(&eventLog, "eventlog", defaultCcelPath, "Path to the CCEL event log data of the VM")
+	fs.StringVar(&catalogPath, "catalog", "", "Catalog to extend (defaults to the embedded catalog)")
+	fs.StringVar(&outPath, "out", "", "Where to write the extended catalog (defaults to -catalog, or stdout)")
+	fs.StringVar(&epoch, "epoch", "", "Name of the firmware epoch of new ACPI hashes (defaults to the month of -date, e.g. \"April 2026\")")
+	fs.StringVar(&date, "date", time.Now().Format(time.DateOnly), "Capture date recorded with new ACPI hashes")
+	fs.Parse(args[1:])
+
+	if machine == "" {
+		fmt.Println("Error: -machine is required")
+		return 1
+	}
+	captureDate, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		fmt.Printf("Error: invalid -date: %v\n", err)
+		return 1
+	}
+	if epoch == "" {
+		epoch = captureDate.Format("January 2006")
+	}
+	if outPath == "" {
+		outPath = catalogPath
+	}
+
+	catalog := internal.DefaultCatalog()
+	if catalogPath != "" {
+		if catalog, err = internal.LoadCatalog(catalogPath); err != nil {
+			fmt.Printf("Error: failed to load catalog: %v\n", err)
+			return 1
+		}
+	}
+	events, err := readCcel(eventLog)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	captured, err := internal.CaptureRTMR0(events)
+	if err != nil {
+		fmt.Printf("Error: refusing to ingest: %v\n", err)
+		return 1
+	}
+	changes, err := catalog.Ingest(machine, captured, epoch, "catalog ingest "+date)
+	if err != nil {
+		fmt.Printf("Error: refusing to ingest: %v\n", err)
+		return 1
+	}
+
+	data, err := catalog.Marshal()
+	if err != nil {
+		fmt.Printf("Error encoding catalog: %v\n", err)
+		return 1
+	}
+	if outPath == "" {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(outPath, data, 0o644); err != nil {
+		fmt.Printf("Error writing catalog: %v\n", err)
+		return 1
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(os.Stderr, "Catalog already contains all measurements of the event log")
+	}
+	for _, c := range changes {
+		fmt.Fprintf(os.Stderr, "Catalog: %s\n", c)
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+type divergenceOutput struct {
+	Index          int    `json:"index"`
+	Event          string `json:"event,omitempty"`
+	ExpectedDigest string `json:"expected_digest,omitempty"`
+	ObservedDigest string `json:"observed_digest,omitempty"`
+	ObservedType   string `json:"observed_type,omitempty"`
+	Reason         string `json:"reason"`
+	Hint           string `json:"hint,omitempty"`
+}
+
+type registerDiagnosis struct {
+	Register      string             `json:"register"`
+	Match         bool               `json:"match"`
+	Configuration string             `json:"configuration,omitempty"`
+	AcpiEpoch     string             `json:"acpi_epoch,omitempty"`
+	BootVariant   *int               `json:"boot_variant,omitempty"`
+	Matched       int                `json:"matched_events"`
+	Divergences   []divergenceOutput `json:"divergences,omitempty"`
+}
+
+func newRegisterDiagnosis(d internal.Diagnosis) registerDiagnosis {
+	out := registerDiagnosis{
+		Register: fmt.Sprintf("RTMR%d", d.Register),
+		Match:    d.Match(),
+		Matched:  d.Matched,
+	}
+	if v := d.Variant; v != nil {
+		out.Configuration = v.Configuration
+		out.AcpiEpoch = v.AcpiEpoch
+		out.BootVariant = &v.BootVariant
+	}
+	for _, div := range d.Divergences {
+		o := divergenceOutput{Index: div.Index, Reason: div.Reason, Hint: div.Hint}
+		if div.Expected != nil {
+			o.Event = div.Expected.Description
+			o.ExpectedDigest = fmt.Sprintf("%x", div.Expected.Digest)
+		}
+		if div.Observed != nil {
+			o.ObservedDigest = fmt.Sprintf("%x", div.Observed.Digest)
+			o.ObservedType = internal.EventTypeName(div.Observed.EventType)
+		}
+		out.Divergences = append(out.Divergences, o)
+	}
+	return out
+}
+
+// runDiagnose aligns an observed CCEL event log with the expected logs and reports, per register,
+// the first diverging event and the catalog entry that is likely missing.
+func runDiagnose(args []string) int {
+	var (
+		m          measureFlags
+		ccelPath   string
+		jsonOutput bool
+	)
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	m.register(fs)
+	fs.StringVar(&ccelPath, "ccel", defaultCcelPath, "Path to the CCEL event log data")
+	fs.BoolVar(&jsonOutput, "json", false, "Output the result as JSON")
+	fs.Parse(args)
+
+	events, err := readCcel(ccelPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	logs, err := m.expectedLogs(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	rtmr0, err := internal.DiagnoseRTMR0(logs.rtmr0, events)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	output := []registerDiagnosis{
+		newRegisterDiagnosis(rtmr0),
+		newRegisterDiagnosis(internal.DiagnoseLog(1, logs.rtmr1, events)),
+		newRegisterDiagnosis(internal.DiagnoseLog(2, logs.rtmr2, events)),
+	}
+	match := true
+	for _, d := range output {
+		match = match && d.Match
+	}
+
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		for _, d := range output {
+			if d.Match {
+				fmt.Printf("%s: match (%d events)\n", d.Register, d.Matched)
+				continue
+			}
+			first := d.Divergences[0]
+			fmt.Printf("%s: event %d: %s\n", d.Register, first.Index, first.Reason)
+			if d.Configuration != "" {
+				fmt.Printf("  closest: %s, ACPI epoch %s, boot variant %d\n", d.Configuration, d.AcpiEpoch, *d.BootVariant)
+			}
+			if first.ExpectedDigest != "" {
+				fmt.Printf("  expected: %s\n", first.ExpectedDigest)
+			}
+			if first.ObservedDigest != "" {
+				fmt.Printf("  observed: %s\n", first.ObservedDigest)
+			}
+			if first.Hint != "" {
+				fmt.Printf("  hint: %s\n", first.Hint)
+			}
+			for _, div := range d.Divergences[1:] {
+				fmt.Printf("  also differs: event %d: %s\n", div.Index, div.Reason)
+			}
+		}
+	}
+
+	if !match {
+		return 1
+	}
+	return 0
+}
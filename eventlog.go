@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+const defaultCcelPath = "/sys/firmware/acpi/tables/data/CCEL"
+
+type eventOutput struct {
+	Index       int    `json:"index"`
+	Register    string `json:"register"`
+	EventType   string `json:"event_type"`
+	Digest      string `json:"digest"`
+	Description string `json:"description"`
+}
+
+type eventLogOutput struct {
+	Events []eventOutput `json:"events"`
+	RTMR0  string        `json:"rtmr0"`
+	RTMR1  string        `json:"rtmr1"`
+	RTMR2  string        `json:"rtmr2"`
+	RTMR3  string        `json:"rtmr3"`
+}
+
+// registerName returns the name of a CC measurement register index.
+func registerName(mrIndex uint32) string {
+	if mrIndex == 0 {
+		return "MRTD"
+	}
+	return fmt.Sprintf("RTMR%d", mrIndex-1)
+}
+
+// readCcel reads and parses a CCEL event log.
+func readCcel(path string) ([]internal.CcelEvent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	events, err := internal.ParseCcel(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event log: %w", err)
+	}
+	return events, nil
+}
+
+// runEventLog lists the events of a CCEL event log and replays it into RTMR0-3.
+func runEventLog(args []string) int {
+	var (
+		ccelPath   string
+		jsonOutput bool
+	)
+	fs := flag.NewFlagSet("eventlog", flag.ExitOnError)
+	fs.StringVar(&ccelPath, "ccel", defaultCcelPath, "Path to the CCEL event log data")
+	fs.BoolVar(&jsonOutput, "json", false, "Output the result as JSON")
+	fs.Parse(args)
+
+	events, err := readCcel(ccelPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	rtmrs := internal.ReplayCcel(events)
+
+	output := eventLogOutput{
+		Events: []eventOutput{},
+		RTMR0:  fmt.Sprintf("%x", rtmrs[0]),
+		RTMR1:  fmt.Sprintf("%x", rtmrs[1]),
+		RTMR2:  fmt.Sprintf("%x", rtmrs[2]),
+		RTMR3:  fmt.Sprintf("%x", rtmrs[3]),
+	}
+	for i, e := range events {
+		output.Events = append(output.Events, eventOutput{
+			Index:       i,
+			Register:    registerName(e.MrIndex),
+			EventType:   internal.EventTypeName(e.EventType),
+			Digest:      fmt.Sprintf("%x", e.Digest),
+			Description: e.Description(),
+		})
+	}
+
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+		return 0
+	}
+
+	for _, e := range output.Events {
+		fmt.Printf("%3d %-5s %-34s %s  %s\n", e.Index, e.Register, e.EventType, e.Digest, e.Description)
+	}
+	fmt.Printf("\nRTMR0: %s\nRTMR1: %s\nRTMR2: %s\nRTMR3: %s\n", output.RTMR0, output.RTMR1, output.RTMR2, output.RTMR3)
+	return 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+type explainEvent struct {
+	Index     int    `json:"index"`
+	EventType string `json:"event_type"`
+	Name      string `json:"name"`
+	Digest    string `json:"digest"`
+	Source    string `json:"source"`
+	Value     string `json:"value"`
+}
+
+type explainLog struct {
+	Register      string         `json:"register"`
+	MRTD          string         `json:"mrtd,omitempty"`
+	Configuration string         `json:"configuration,omitempty"`
+	AcpiEpoch     string         `json:"acpi_epoch,omitempty"`
+	BootVariant   *int           `json:"boot_variant,omitempty"`
+	Events        []explainEvent `json:"events"`
+	Value         string         `json:"value"`
+}
+
+func newExplainLog(register string, log *internal.EventLog) explainLog {
+	out := explainLog{Register: register, Events: []explainEvent{}, Value: internal.Empty}
+	log.Replay(internal.ObserverFunc(func(index int, e *internal.Event, value []byte) {
+		out.Events = append(out.Events, explainEvent{
+			Index:     index,
+			EventType: internal.EventTypeName(e.Type),
+			Name:      e.Description,
+			Digest:    fmt.Sprintf("%x", e.Digest),
+			Source:    e.Source,
+			Value:     fmt.Sprintf("%x", value),
+		})
+		out.Value = fmt.Sprintf("%x", value)
+	}))
+	return out
+}
+
+// runExplain lists every expected event of RTMR0-2, and of RTMR3 for an app deployment, with its digest, where the digest comes from
+// and the running register value.
+func runExplain(args []string) int {
+	var (
+		m          measureFlags
+		jsonOutput bool
+	)
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	m.register(fs)
+	fs.BoolVar(&jsonOutput, "json", false, "Output the result as JSON")
+	fs.Parse(args)
+
+	logs, err := m.expectedLogs(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	var output []explainLog
+	for i, v := range logs.rtmr0 {
+		l := newExplainLog("RTMR0", v.Log)
+		l.MRTD = logs.rtmr0MRTDs[i]
+		l.Configuration = v.Configuration
+		l.AcpiEpoch = v.AcpiEpoch
+		l.BootVariant = &v.BootVariant
+		output = append(output, l)
+	}
+	output = append(output, newExplainLog("RTMR1", logs.rtmr1), newExplainLog("RTMR2", logs.rtmr2))
+	if logs.rtmr3 != nil {
+		output = append(output, newExplainLog("RTMR3", logs.rtmr3))
+	}
+
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+		return 0
+	}
+
+	for i, l := range output {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("=== %s", l.Register)
+		if l.Configuration != "" {
+			fmt.Printf(" (MRTD %.16s, %s, ACPI epoch %s, boot variant %d)", l.MRTD, l.Configuration, l.AcpiEpoch, *l.BootVariant)
+		}
+		fmt.Println(" ===")
+		for _, e := range l.Events {
+			fmt.Printf("%3d %-34s %-42s %-8s %s\n    value %s\n", e.Index, e.EventType, e.Name, e.Source, e.Digest, e.Value)
+		}
+		fmt.Printf("%s: %s\n", l.Register, l.Value)
+	}
+	return 0
+}
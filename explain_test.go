@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+func TestNewExplainLog(t *testing.T) {
+	digest := func(s string) []byte {
+		h := sha512.Sum384([]byte(s))
+		return h[:]
+	}
+	events := []internal.Event{
+		{Register: 1, Type: internal.EvEfiAction, Description: "action", Digest: digest("action"), Source: internal.DigestComputed},
+		{Register: 1, Type: internal.EvSeparator, Description: "separator", Digest: digest("separator"), Source: internal.DigestCatalog},
+	}
+	log := internal.NewEventLog()
+	for _, e := range events {
+		if err := log.Extend(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := newExplainLog("RTMR1", log)
+
+	// Extend the register by hand: RTMR = SHA384(RTMR || digest).
+	mr := make([]byte, sha512.Size384)
+	var values []string
+	for _, e := range events {
+		h := sha512.Sum384(append(mr, e.Digest...))
+		mr = h[:]
+		values = append(values, hex.EncodeToString(mr))
+	}
+
+	if out.Register != "RTMR1" || len(out.Events) != len(events) {
+		t.Fatalf("newExplainLog() = %+v, want %d RTMR1 events", out, len(events))
+	}
+	for i, e := range out.Events {
+		want := explainEvent{
+			Index:     i,
+			EventType: internal.EventTypeName(events[i].Type),
+			Name:      events[i].Description,
+			Digest:    fmt.Sprintf("%x", events[i].Digest),
+			Source:    events[i].Source,
+			Value:     values[i],
+		}
+		if e != want {
+			t.Errorf("event %d = %+v, want %+v", i, e, want)
+		}
+	}
+	if out.Value != values[len(values)-1] {
+		t.Errorf("Value = %s, want %s", out.Value, values[len(values)-1])
+	}
+
+	empty := newExplainLog("RTMR2", internal.NewEventLog())
+	if empty.Value != internal.Empty || empty.Events == nil || len(empty.Events) != 0 {
+		t.Errorf("newExplainLog(nil) = %+v, want no events and the empty register value", empty)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// firmwareSourceOptions selects where published firmware images are loaded from.
+type firmwareSourceOptions struct {
+	mirror   string
+	dir      string
+	embedded bool
+	cacheDir string
+	noCache  bool
+}
+
+// firmwareSource builds the firmware source selected on the command line. Remote sources are
+// wrapped in the local cache unless it is disabled.
+func firmwareSource(opts firmwareSourceOptions) (internal.FirmwareSource, error) {
+	selected := 0
+	for _, set := range []bool{opts.mirror != "", opts.dir != "", opts.embedded} {
+		if set {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return nil, fmt.Errorf("only one of -fw-mirror, -fw-dir and -fw-embedded may be given")
+	}
+
+	switch {
+	case opts.dir != "":
+		return internal.NewDirFirmwareSource(opts.dir), nil
+	case opts.embedded:
+		if firmwareBundle == nil {
+			return nil, fmt.Errorf("this binary was built without embedded firmware (build tag firmware_bundle)")
+		}
+		return &internal.FSFirmwareSource{FS: firmwareBundle}, nil
+	}
+
+	var src internal.FirmwareSource = internal.NewHTTPFirmwareSource(opts.mirror)
+	if opts.noCache {
+		return src, nil
+	}
+	cache, err := openFirmwareCache(opts.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	return &internal.CachedFirmwareSource{
+		Cache:  cache,
+		Source: src,
+		Warn: func(err error) {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		},
+	}, nil
+}
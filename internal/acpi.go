@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// acpiTemplates contains the etc/acpi/tables blobs for every supported vCPU count, as served by
+// QEMU over fw_cfg before the firmware runs the table loader (pointers hold file offsets and
+// checksums are zero).
+//
+//go:embed templates.json.gz
+var acpiTemplates []byte
+
+// Names of the fw_cfg files allocated by the table loader.
+const (
+	acpiTablesFile = "etc/acpi/tables"
+	acpiRsdpFile   = "etc/acpi/rsdp"
+)
+
+const (
+	acpiTableHeaderSize = 36
+	acpiTablesBlobSize  = 0x20000 // QEMU pads etc/acpi/tables to 128 KiB.
+	acpiRsdpSize        = 20      // ACPI 1.0 RSDP, pointing at the RSDT.
+	acpiMaxVCPUs        = 128
+)
+
+// acpiTable is a single ACPI table inside the etc/acpi/tables blob.
+type acpiTable struct {
+	Signature string
+	Offset    int
+	Length    int
+}
+
+// AcpiTables is the set of ACPI blobs QEMU exposes to the firmware for one machine shape.
+type AcpiTables struct {
+	Tables   []byte
+	Rsdp     []byte
+	Loader   []byte
+	Commands []TableLoaderCommand
+}
+
+// loadAcpiTemplate returns the ACPI tables template for the given vCPU count.
+func loadAcpiTemplate(vcpus int) ([]byte, error) {
+	if vcpus < 1 || vcpus > acpiMaxVCPUs {
+		return nil, fmt.Errorf("ACPI: unsupported vCPU count %d (must be between 1 and %d)", vcpus, acpiMaxVCPUs)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(acpiTemplates))
+	if err != nil {
+		return nil, fmt.Errorf("ACPI: failed to decompress templates: %w", err)
+	}
+	defer zr.Close()
+
+	// The templates are large, so only decode the requested entry.
+	key := strconv.Itoa(vcpus)
+	dec := json.NewDecoder(zr)
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("ACPI: failed to parse templates: %w", err)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("ACPI: failed to parse templates: %w", err)
+		}
+		if tok != key {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, fmt.Errorf("ACPI: failed to parse templates: %w", err)
+			}
+			continue
+		}
+
+		var blob string
+		if err := dec.Decode(&blob); err != nil {
+			return nil, fmt.Errorf("ACPI: failed to parse template for %d vCPUs: %w", vcpus, err)
+		}
+		return hex.DecodeString(blob)
+	}
+	return nil, fmt.Errorf("ACPI: no template for %d vCPUs", vcpus)
+}
+
+// splitAcpiTables walks the tables in a blob until it hits the zero padding.
+func splitAcpiTables(blob []byte) ([]acpiTable, error) {
+	var tables []acpiTable
+	for off := 0; off+8 <= len(blob); {
+		length := int(binary.LittleEndian.Uint32(blob[off+4:]))
+		if length == 0 {
+			break
+		}
+		if off+length > len(blob) {
+			return nil, fmt.Errorf("ACPI: table at %#x overflows blob (%d bytes)", off, length)
+		}
+		tables = append(tables, acpiTable{Signature: string(blob[off : off+4]), Offset: off, Length: length})
+		off += length
+	}
+	return tables, nil
+}
+
+// findAcpiTable returns the first table with the given signature.
+func findAcpiTable(tables []acpiTable, signature string) (acpiTable, bool) {
+	for _, t := range tables {
+		if t.Signature == signature {
+			return t, true
+		}
+	}
+	return acpiTable{}, false
+}
+
+// acpiPointer is a pointer field in one table that refers to another table in the same blob.
+type acpiPointer struct {
+	Offset int // Offset of the pointer field in the blob.
+	Size   int
+	Target int // Offset of the referenced table in the blob.
+}
+
+// acpiPointers lists the pointer fields QEMU links via the table loader, in the order QEMU emits them.
+func acpiPointers(tables []acpiTable) ([]acpiPointer, error) {
+	facp, ok := findAcpiTable(tables, "FACP")
+	if !ok {
+		return nil, fmt.Errorf("ACPI: no FACP table")
+	}
+	facs, ok := findAcpiTable(tables, "FACS")
+	if !ok {
+		return nil, fmt.Errorf("ACPI: no FACS table")
+	}
+	dsdt, ok := findAcpiTable(tables, "DSDT")
+	if !ok {
+		return nil, fmt.Errorf("ACPI: no DSDT table")
+	}
+	if facp.Length < 148 {
+		return nil, fmt.Errorf("ACPI: FACP table too short: %d", facp.Length)
+	}
+
+	pointers := []acpiPointer{
+		{Offset: facp.Offset + 36, Size: 4, Target: facs.Offset},  // FIRMWARE_CTRL
+		{Offset: facp.Offset + 40, Size: 4, Target: dsdt.Offset},  // DSDT
+		{Offset: facp.Offset + 140, Size: 8, Target: dsdt.Offset}, // X_DSDT
+	}
+
+	// The RSDT references every table except FACS and DSDT (reachable through the FACP) and itself.
+	rsdt, ok := findAcpiTable(tables, "RSDT")
+	if !ok {
+		return nil, fmt.Errorf("ACPI: no RSDT table")
+	}
+	entry := rsdt.Offset + acpiTableHeaderSize
+	for _, t := range tables {
+		switch t.Signature {
+		case "FACS", "DSDT", "RSDT":
+			continue
+		}
+		if entry+4 > rsdt.Offset+rsdt.Length {
+			return nil, fmt.Errorf("ACPI: RSDT has no room for %s", t.Signature)
+		}
+		pointers = append(pointers, acpiPointer{Offset: entry, Size: 4, Target: t.Offset})
+		entry += 4
+	}
+	return pointers, nil
+}
+
+// BuildAcpiTables builds the ACPI blobs for a machine shape with the given number of vCPUs.
+func BuildAcpiTables(vcpus int) (*AcpiTables, error) {
+	template, err := loadAcpiTemplate(vcpus)
+	if err != nil {
+		return nil, err
+	}
+	return LinkAcpiTables(template)
+}
+
+// LinkAcpiTables rebuilds the table loader and RSDP for the given etc/acpi/tables contents, in the
+// same way QEMU does. The tables are re-linked: the table pointers are set to the offsets of the
+// tables in this layout and checksums are cleared, as QEMU leaves both for the table loader.
+func LinkAcpiTables(tablesData []byte) (*AcpiTables, error) {
+	tables, err := splitAcpiTables(tablesData)
+	if err != nil {
+		return nil, err
+	}
+	pointers, err := acpiPointers(tables)
+	if err != nil {
+		return nil, err
+	}
+	rsdt, _ := findAcpiTable(tables, "RSDT")
+
+	size := max(len(tablesData), acpiTablesBlobSize)
+	blob := make([]byte, size)
+	copy(blob, tablesData)
+
+	commands := []TableLoaderCommand{
+		{Command: TableLoaderCmdAllocate, File: acpiRsdpFile, Align: 16, Zone: TableLoaderZoneFSeg},
+		{Command: TableLoaderCmdAllocate, File: acpiTablesFile, Align: 64, Zone: TableLoaderZoneHigh},
+	}
+	for _, t := range tables {
+		for _, p := range pointers {
+			if p.Offset < t.Offset || p.Offset >= t.Offset+t.Length {
+				continue
+			}
+			putUintN(blob[p.Offset:], p.Size, uint64(p.Target))
+			commands = append(commands, TableLoaderCommand{
+				Command: TableLoaderCmdAddPointer,
+				File:    acpiTablesFile,
+				SrcFile: acpiTablesFile,
+				Offset:  uint32(p.Offset),
+				Size:    uint8(p.Size),
+			})
+		}
+		// FACS has no checksum.
+		if t.Signature == "FACS" {
+			continue
+		}
+		blob[t.Offset+9] = 0
+		commands = append(commands, TableLoaderCommand{
+			Command: TableLoaderCmdAddChecksum,
+			File:    acpiTablesFile,
+			Offset:  uint32(t.Offset + 9),
+			Start:   uint32(t.Offset),
+			Length:  uint32(t.Length),
+		})
+	}
+
+	rsdp := make([]byte, acpiRsdpSize)
+	copy(rsdp[0:8], "RSD PTR ")
+	copy(rsdp[9:15], blob[rsdt.Offset+10:rsdt.Offset+16]) // OEMID
+	rsdp[15] = 0                                          // Revision (ACPI 1.0)
+	putUintN(rsdp[16:], 4, uint64(rsdt.Offset))
+	commands = append(commands,
+		TableLoaderCommand{Command: TableLoaderCmdAddPointer, File: acpiRsdpFile, SrcFile: acpiTablesFile, Offset: 16, Size: 4},
+		TableLoaderCommand{Command: TableLoaderCmdAddChecksum, File: acpiRsdpFile, Offset: 8, Start: 0, Length: acpiRsdpSize},
+	)
+
+	return &AcpiTables{
+		Tables:   blob,
+		Rsdp:     rsdp,
+		Loader:   EncodeTableLoader(commands),
+		Commands: commands,
+	}, nil
+}
+
+// Execute runs the table loader over the blobs, as the firmware would.
+func (a *AcpiTables) Execute() (*TableLoaderState, error) {
+	return ExecuteTableLoader(a.Commands, map[string][]byte{
+		acpiTablesFile: a.Tables,
+		acpiRsdpFile:   a.Rsdp,
+	})
+}
+
+// events returns the EV_PLATFORM_CONFIG_FLAGS events of the ACPI blobs.
+func (a *AcpiTables) events() []Event {
+	return []Event{
+		measuredEvent(EvPlatformConfigFlags, "ACPI table loader", a.Loader),
+		measuredEvent(EvPlatformConfigFlags, "ACPI RSDP", a.Rsdp),
+		measuredEvent(EvPlatformConfigFlags, "ACPI tables", a.Tables),
+	}
+}
+
+// CapturedEpochs returns the captured ACPI hashes the tables reproduce, as "configuration/epoch".
+// The tables built from the embedded templates only model part of what GCE generates, so hashes
+// matching none of them are unlikely to be what a VM measures.
+func (a *AcpiTables) CapturedEpochs(c *Catalog) []string {
+	var out []string
+	for _, name := range slices.Sorted(maps.Keys(c.MachineConfigurations)) {
+		if epoch, ok := capturedAcpiEpoch(c, name, a.events()); ok {
+			out = append(out, name+"/"+epoch)
+		}
+	}
+	return out
+}
+
+// putUintN stores v little-endian in the first size bytes of b.
+func putUintN(b []byte, size int, v uint64) {
+	for i := range size {
+		b[i] = byte(v >> (8 * i))
+	}
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildAcpiTables(t *testing.T) {
+	tables, err := BuildAcpiTables(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables.Tables) != acpiTablesBlobSize {
+		t.Errorf("tables blob is %d bytes, want %d", len(tables.Tables), acpiTablesBlobSize)
+	}
+
+	// The templates are served as QEMU serves them, so re-linking them changes nothing.
+	template, err := loadAcpiTemplate(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tables.Tables[:len(template)], template) {
+		t.Error("re-linked tables differ from the template")
+	}
+
+	// The RSDT of the 4 vCPU template is at 0x238e, after FACS, DSDT, FACP, APIC, MCFG and WAET.
+	wantRsdp, _ := hex.DecodeString("5253442050545220" + "00" + "424f43485320" + "00" + "8e230000")
+	if !bytes.Equal(tables.Rsdp, wantRsdp) {
+		t.Errorf("RSDP = %x, want %x", tables.Rsdp, wantRsdp)
+	}
+
+	// Two allocations, the FACP pointers to FACS and DSDT, a checksum per table but FACS, the four
+	// RSDT entries and the RSDP pointer and checksum.
+	var counts [5]int
+	for _, c := range tables.Commands {
+		counts[c.Command]++
+	}
+	if want := [5]int{0, 2, 3 + 4 + 1, 6 + 1, 0}; counts != want {
+		t.Errorf("command counts = %v, want %v", counts, want)
+	}
+	if len(tables.Loader) != len(tables.Commands)*tableLoaderEntrySize {
+		t.Errorf("loader is %d bytes, want %d", len(tables.Loader), len(tables.Commands)*tableLoaderEntrySize)
+	}
+	first := tables.Commands[0]
+	if first.Command != TableLoaderCmdAllocate || first.File != acpiRsdpFile || first.Zone != TableLoaderZoneFSeg {
+		t.Errorf("first command = %v, want the RSDP allocation", first)
+	}
+
+	// FACP (at 0x2138) points at FACS and DSDT by offset.
+	const facp = 0x2138
+	if got := binary.LittleEndian.Uint32(tables.Tables[facp+36:]); got != 0 {
+		t.Errorf("FIRMWARE_CTRL = %#x, want 0", got)
+	}
+	if got := binary.LittleEndian.Uint64(tables.Tables[facp+140:]); got != 0x40 {
+		t.Errorf("X_DSDT = %#x, want 0x40", got)
+	}
+
+	again, err := BuildAcpiTables(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Loader, tables.Loader) || !bytes.Equal(again.Tables, tables.Tables) {
+		t.Error("BuildAcpiTables is not deterministic")
+	}
+}
+
+func TestBuildAcpiTablesVCPUs(t *testing.T) {
+	// Every template builds, and the MADT grows with the vCPU count.
+	var lastApic int
+	for _, vcpus := range []int{1, 2, 22, 44, 128} {
+		tables, err := BuildAcpiTables(vcpus)
+		if err != nil {
+			t.Fatalf("BuildAcpiTables(%d): %v", vcpus, err)
+		}
+		split, err := splitAcpiTables(tables.Tables)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apic, ok := findAcpiTable(split, "APIC")
+		if !ok {
+			t.Fatalf("BuildAcpiTables(%d): no APIC table", vcpus)
+		}
+		if apic.Length <= lastApic {
+			t.Errorf("BuildAcpiTables(%d): APIC is %d bytes, want more than %d", vcpus, apic.Length, lastApic)
+		}
+		lastApic = apic.Length
+	}
+
+	for _, vcpus := range []int{0, 129} {
+		if _, err := BuildAcpiTables(vcpus); err == nil || !strings.Contains(err.Error(), "unsupported vCPU count") {
+			t.Errorf("BuildAcpiTables(%d) error = %v, want unsupported vCPU count", vcpus, err)
+		}
+	}
+}
+
+func TestCapturedEpochs(t *testing.T) {
+	tables, err := BuildAcpiTables(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The embedded templates reproduce no captured epoch, which is why RTMR0 only measures the
+	// captured ACPI hashes.
+	if got := tables.CapturedEpochs(DefaultCatalog()); len(got) != 0 {
+		t.Errorf("CapturedEpochs() = %v; the templates now reproduce a captured epoch", got)
+	}
+
+	events := tables.events()
+	catalog := DefaultCatalog()
+	config := catalog.MachineConfigurations["c3-standard-4"]
+	config.AcpiHashes = append(config.AcpiHashes, AcpiHashes{
+		Epoch:          "test",
+		AcpiLoaderHash: events[0].Digest,
+		AcpiRsdpHash:   events[1].Digest,
+		AcpiTablesHash: events[2].Digest,
+	})
+	catalog.MachineConfigurations["c3-standard-4"] = config
+	if got, want := tables.CapturedEpochs(catalog), []string{"c3-standard-4/test"}; !slices.Equal(got, want) {
+		t.Errorf("CapturedEpochs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const firmwareCacheExt = ".fd"
+
+// ErrFirmwareHashMismatch is returned when firmware contents do not hash to the expected SHA-384.
+var ErrFirmwareHashMismatch = errors.New("firmware hash mismatch")
+
+// VerifyFirmwareHash checks that data hashes to the given hex-encoded SHA-384, which is how GCE
+// names its published firmware files.
+func VerifyFirmwareHash(hash string, data []byte) error {
+	if err := validateFirmwareHash(hash); err != nil {
+		return err
+	}
+	actual := sha512.Sum384(data)
+	if hex.EncodeToString(actual[:]) != hash {
+		return fmt.Errorf("%w: expected %s, got %x", ErrFirmwareHashMismatch, hash, actual)
+	}
+	return nil
+}
+
+// validateFirmwareHash checks that hash is a lowercase hex-encoded SHA-384, so it is safe to use as a file name.
+func validateFirmwareHash(hash string) error {
+	if len(hash) != 2*sha512.Size384 || strings.ToLower(hash) != hash {
+		return fmt.Errorf("invalid firmware hash: %q", hash)
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return fmt.Errorf("invalid firmware hash: %q", hash)
+	}
+	return nil
+}
+
+// FirmwareCache is an on-disk, content-addressed store of firmware images keyed by their SHA-384.
+// Contents are verified both when they are written and when they are read back.
+type FirmwareCache struct {
+	Dir string
+}
+
+// CachedFirmware describes a file in the firmware cache.
+type CachedFirmware struct {
+	Hash    string
+	Size    int64
+	ModTime time.Time
+	// Valid is false when the contents do not match the hash.
+	Valid bool
+}
+
+// DefaultFirmwareCacheDir returns the per-user firmware cache directory.
+func DefaultFirmwareCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dstack-mr-gcp", "firmware"), nil
+}
+
+// NewFirmwareCache opens the firmware cache in dir, creating it if needed.
+func NewFirmwareCache(dir string) (*FirmwareCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create firmware cache: %w", err)
+	}
+	return &FirmwareCache{Dir: dir}, nil
+}
+
+func (c *FirmwareCache) path(hash string) string {
+	return filepath.Join(c.Dir, hash+firmwareCacheExt)
+}
+
+// Get returns the cached firmware with the given hash. A missing entry yields an error satisfying
+// errors.Is(err, os.ErrNotExist). A corrupted entry is removed and ErrFirmwareHashMismatch is returned.
+func (c *FirmwareCache) Get(hash string) ([]byte, error) {
+	if err := validateFirmwareHash(hash); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(c.path(hash))
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyFirmwareHash(hash, data); err != nil {
+		_ = os.Remove(c.path(hash))
+		return nil, fmt.Errorf("cached firmware %s removed: %w", hash[:16], err)
+	}
+	return data, nil
+}
+
+// Put stores the firmware after checking that it hashes to hash.
+func (c *FirmwareCache) Put(hash string, data []byte) error {
+	if err := VerifyFirmwareHash(hash, data); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that readers never see a partial file.
+	tmp, err := os.CreateTemp(c.Dir, hash[:16]+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cached firmware: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cached firmware: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cached firmware: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(hash)); err != nil {
+		return fmt.Errorf("failed to write cached firmware: %w", err)
+	}
+	return nil
+}
+
+// List returns all cached firmware files sorted by hash, verifying each of them.
+func (c *FirmwareCache) List() ([]CachedFirmware, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []CachedFirmware
+	for _, e := range entries {
+		hash, ok := strings.CutSuffix(e.Name(), firmwareCacheExt)
+		if !ok || e.IsDir() || validateFirmwareHash(hash) != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(c.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, CachedFirmware{
+			Hash:    hash,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Valid:   VerifyFirmwareHash(hash, data) == nil,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hash < list[j].Hash })
+	return list, nil
+}
+
+// Prune removes invalid entries, leftover temporary files and every entry for which keep returns
+// false. A nil keep removes all entries. It returns the names of the removed files.
+func (c *FirmwareCache) Prune(keep func(hash string) bool) ([]string, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+	valid := make(map[string]bool)
+	list, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range list {
+		valid[f.Hash] = f.Valid
+	}
+
+	var removed []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		remove := strings.HasSuffix(name, ".tmp")
+		if hash, ok := strings.CutSuffix(name, firmwareCacheExt); ok && validateFirmwareHash(hash) == nil {
+			remove = !valid[hash] || keep == nil || !keep(hash)
+		}
+		if !remove {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.Dir, name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
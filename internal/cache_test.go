@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func firmwareHash(data []byte) string {
+	sum := sha512.Sum384(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyFirmwareHash(t *testing.T) {
+	data := []byte("firmware")
+	hash := firmwareHash(data)
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr error
+		want    string
+	}{
+		{name: "match", hash: hash},
+		{name: "mismatch", hash: firmwareHash([]byte("other")), wantErr: ErrFirmwareHashMismatch},
+		{name: "uppercase", hash: strings.ToUpper(hash), want: "invalid firmware hash"},
+		{name: "short", hash: hash[:64], want: "invalid firmware hash"},
+		{name: "path", hash: "../" + hash[3:], want: "invalid firmware hash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyFirmwareHash(tt.hash, data)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyFirmwareHash() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.want != "":
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("VerifyFirmwareHash() error = %v, want %q", err, tt.want)
+				}
+			case err != nil:
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFirmwareCache(t *testing.T) {
+	cache, err := NewFirmwareCache(filepath.Join(t.TempDir(), "firmware"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("firmware")
+	hash := firmwareHash(data)
+
+	if _, err := cache.Get(hash); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Get() on an empty cache error = %v, want os.ErrNotExist", err)
+	}
+	if err := cache.Put(hash, []byte("tampered")); !errors.Is(err, ErrFirmwareHashMismatch) {
+		t.Fatalf("Put() of mismatching data error = %v, want ErrFirmwareHashMismatch", err)
+	}
+	if err := cache.Put(hash, data); err != nil {
+		t.Fatal(err)
+	}
+	got, err := cache.Get(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Get() = %q, want %q", got, data)
+	}
+
+	// A corrupted entry is reported and removed.
+	if err := os.WriteFile(cache.path(hash), []byte("corrupted"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(hash); !errors.Is(err, ErrFirmwareHashMismatch) {
+		t.Fatalf("Get() of a corrupted entry error = %v, want ErrFirmwareHashMismatch", err)
+	}
+	if _, err := os.Stat(cache.path(hash)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("corrupted entry was not removed: %v", err)
+	}
+}
+
+func TestFirmwareCachePrune(t *testing.T) {
+	cache, err := NewFirmwareCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep, drop, corrupt := []byte("keep"), []byte("drop"), []byte("corrupt")
+	for _, data := range [][]byte{keep, drop, corrupt} {
+		if err := cache.Put(firmwareHash(data), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(cache.path(firmwareHash(corrupt)), []byte("corrupted"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"leftover.1234.tmp", "README"} {
+		if err := os.WriteFile(filepath.Join(cache.Dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := cache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := make(map[string]bool)
+	for _, f := range list {
+		valid[f.Hash] = f.Valid
+	}
+	want := map[string]bool{firmwareHash(keep): true, firmwareHash(drop): true, firmwareHash(corrupt): false}
+	if len(valid) != len(want) {
+		t.Fatalf("List() = %+v, want %d entries", list, len(want))
+	}
+	for hash, v := range want {
+		if valid[hash] != v {
+			t.Errorf("List() valid[%s] = %v, want %v", hash[:16], valid[hash], v)
+		}
+	}
+	if !slices.IsSortedFunc(list, func(a, b CachedFirmware) int { return strings.Compare(a.Hash, b.Hash) }) {
+		t.Error("List() is not sorted by hash")
+	}
+
+	removed, err := cache.Prune(func(hash string) bool { return hash == firmwareHash(keep) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(removed)
+	wantRemoved := []string{firmwareHash(corrupt) + firmwareCacheExt, firmwareHash(drop) + firmwareCacheExt, "leftover.1234.tmp"}
+	slices.Sort(wantRemoved)
+	if !slices.Equal(removed, wantRemoved) {
+		t.Errorf("Prune() removed %v, want %v", removed, wantRemoved)
+	}
+	if _, err := cache.Get(firmwareHash(keep)); err != nil {
+		t.Errorf("kept entry: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cache.Dir, "README")); err != nil {
+		t.Errorf("unrelated file was removed: %v", err)
+	}
+}
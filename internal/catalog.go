@@ -0,0 +1,450 @@
+package internal
+
+import (
+	"crypto/sha512"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+)
+
+// CatalogVersion is the catalog format version understood by this package.
+const CatalogVersion = 1
+
+// catalogJSON is the default catalog of measurements captured on GCP.
+//
+//go:embed catalog.json
+var catalogJSON []byte
+
+// HexBytes is a byte string encoded as hex in JSON.
+type HexBytes []byte
+
+// MarshalJSON encodes the bytes as a lowercase hex string.
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+// UnmarshalJSON decodes a hex string.
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid hex string %q: %w", s, err)
+	}
+	*h = b
+	return nil
+}
+
+// FirmwareMRTD pairs a firmware file name (from gs://gce_tcb_integrity/ovmf_x64_csm)
+// with its corresponding MRTD (from gs://gce_tcb_integrity/ovmf_x64_csm/tdx)
+type FirmwareMRTD struct {
+	FirmwareFile string `json:"file"`
+	MRTD         string `json:"mrtd"`
+}
+
+// SecureBootHashes holds the SHA384 hashes of the Secure Boot EFI variable events.
+type SecureBootHashes struct {
+	SecureBoot HexBytes `json:"SecureBoot"`
+	PK         HexBytes `json:"PK"`
+	KEK        HexBytes `json:"KEK"`
+	DB         HexBytes `json:"db"`
+	DBX        HexBytes `json:"dbx"`
+
+	// data holds the measured UEFI_VARIABLE_DATA of the variables whose contents are known,
+	// keyed by variable name, so that they can be measured with other hash algorithms.
+	data map[string][]byte
+}
+
+// secureBootVariableNames lists the Secure Boot variables in measurement order.
+var secureBootVariableNames = []string{"SecureBoot", "PK", "KEK", "db", "dbx"}
+
+// digest returns a pointer to the digest of the named variable.
+func (h *SecureBootHashes) digest(name string) *HexBytes {
+	switch name {
+	case "SecureBoot":
+		return &h.SecureBoot
+	case "PK":
+		return &h.PK
+	case "KEK":
+		return &h.KEK
+	case "db":
+		return &h.DB
+	case "dbx":
+		return &h.DBX
+	}
+	return nil
+}
+
+// Override returns a copy of h with the hashes of the named variables taken from other.
+func (h SecureBootHashes) Override(other SecureBootHashes, names ...string) SecureBootHashes {
+	out := h
+	out.data = maps.Clone(h.data)
+	for _, name := range names {
+		digest := out.digest(name)
+		if digest == nil {
+			continue
+		}
+		*digest = *other.digest(name)
+		if data, ok := other.data[name]; ok {
+			if out.data == nil {
+				out.data = make(map[string][]byte)
+			}
+			out.data[name] = data
+		} else {
+			delete(out.data, name)
+		}
+	}
+	return out
+}
+
+// events returns the EV_EFI_VARIABLE_DRIVER_CONFIG events of the variables.
+func (h SecureBootHashes) events() []Event {
+	var events []Event
+	for _, name := range secureBootVariableNames {
+		if data, ok := h.data[name]; ok {
+			events = append(events, measuredEvent(EvEfiVariableDriverConfig, name, data))
+		} else {
+			events = append(events, digestEvent(EvEfiVariableDriverConfig, name, *h.digest(name), DigestCatalog))
+		}
+	}
+	return events
+}
+
+// BootVariant contains NVMe driver boot option measurements.
+type BootVariant struct {
+	Boot0001 HexBytes `json:"boot0001"`
+	Boot0002 HexBytes `json:"boot0002"`
+}
+
+// AcpiHashes holds the measured hashes for one set of ACPI tables (tied to a specific firmware version).
+// A machine configuration may have multiple valid sets when GCP updates their firmware.
+type AcpiHashes struct {
+	// Epoch names the firmware release the hashes were captured with.
+	Epoch string `json:"epoch"`
+	// Source records where the hashes were captured, e.g. "mripper 2026-03-13".
+	Source         string   `json:"source,omitempty"`
+	AcpiLoaderHash HexBytes `json:"loader"`
+	AcpiRsdpHash   HexBytes `json:"rsdp"`
+	AcpiTablesHash HexBytes `json:"tables"`
+}
+
+// events returns the EV_PLATFORM_CONFIG_FLAGS events of the ACPI blobs.
+func (a AcpiHashes) events() []Event {
+	return []Event{
+		digestEvent(EvPlatformConfigFlags, "ACPI table loader", a.AcpiLoaderHash, DigestCatalog),
+		digestEvent(EvPlatformConfigFlags, "ACPI RSDP", a.AcpiRsdpHash, DigestCatalog),
+		digestEvent(EvPlatformConfigFlags, "ACPI tables", a.AcpiTablesHash, DigestCatalog),
+	}
+}
+
+// MachineConfiguration holds the captured TD HOB and ACPI table hashes of a machine type.
+type MachineConfiguration struct {
+	TdHobHash  HexBytes     `json:"td_hob"`
+	AcpiHashes []AcpiHashes `json:"acpi"`
+}
+
+// Catalog is the set of captured measurements RTMR0 is computed from.
+type Catalog struct {
+	Version               int                             `json:"version"`
+	Firmware              []FirmwareMRTD                  `json:"firmware"`
+	SecureBoot            SecureBootHashes                `json:"secure_boot"`
+	Boot0000              HexBytes                        `json:"boot0000"`
+	BootVariants          []BootVariant                   `json:"boot_variants"`
+	MachineConfigurations map[string]MachineConfiguration `json:"machine_configurations"`
+}
+
+// ParseCatalog parses and validates a JSON catalog.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("catalog: %w", err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// LoadCatalog reads a JSON catalog from a file.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	return ParseCatalog(data)
+}
+
+// DefaultCatalog returns a copy of the embedded catalog.
+func DefaultCatalog() *Catalog {
+	c, err := ParseCatalog(catalogJSON)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded catalog: %v", err))
+	}
+	return c
+}
+
+// Marshal encodes the catalog as indented JSON.
+func (c *Catalog) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func validateDigest(name string, digest []byte) error {
+	if len(digest) != sha512.Size384 {
+		return fmt.Errorf("%s: expected a %d-byte digest, got %d bytes", name, sha512.Size384, len(digest))
+	}
+	return nil
+}
+
+func (c *Catalog) validate() error {
+	if c.Version != CatalogVersion {
+		return fmt.Errorf("catalog: unsupported version %d (expected %d)", c.Version, CatalogVersion)
+	}
+	for _, fw := range c.Firmware {
+		if err := fw.validate(); err != nil {
+			return fmt.Errorf("catalog: %w", err)
+		}
+	}
+	digests := map[string][]byte{
+		"secure_boot.SecureBoot": c.SecureBoot.SecureBoot,
+		"secure_boot.PK":         c.SecureBoot.PK,
+		"secure_boot.KEK":        c.SecureBoot.KEK,
+		"secure_boot.db":         c.SecureBoot.DB,
+		"secure_boot.dbx":        c.SecureBoot.DBX,
+		"boot0000":               c.Boot0000,
+	}
+	for i, boot := range c.BootVariants {
+		digests[fmt.Sprintf("boot_variants[%d].boot0001", i)] = boot.Boot0001
+		digests[fmt.Sprintf("boot_variants[%d].boot0002", i)] = boot.Boot0002
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.MachineConfigurations)) {
+		config := c.MachineConfigurations[name]
+		if err := config.validate(); err != nil {
+			return fmt.Errorf("catalog: %s: %w", name, err)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(digests)) {
+		if err := validateDigest(name, digests[name]); err != nil {
+			return fmt.Errorf("catalog: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *MachineConfiguration) validate() error {
+	if err := validateDigest("td_hob", m.TdHobHash); err != nil {
+		return err
+	}
+	epochs := make(map[string]bool)
+	for _, acpi := range m.AcpiHashes {
+		if epochs[acpi.Epoch] {
+			return fmt.Errorf("duplicate ACPI epoch %q", acpi.Epoch)
+		}
+		epochs[acpi.Epoch] = true
+		digests := map[string][]byte{"loader": acpi.AcpiLoaderHash, "rsdp": acpi.AcpiRsdpHash, "tables": acpi.AcpiTablesHash}
+		for _, name := range slices.Sorted(maps.Keys(digests)) {
+			if err := validateDigest(acpi.Epoch+" "+name, digests[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (fw FirmwareMRTD) validate() error {
+	if err := validateFirmwareHash(fw.FirmwareFile); err != nil {
+		return err
+	}
+	mrtd, err := hex.DecodeString(fw.MRTD)
+	if err != nil {
+		return fmt.Errorf("firmware %s: invalid MRTD: %w", fw.FirmwareFile[:16], err)
+	}
+	if len(mrtd) != sha512.Size384 {
+		return fmt.Errorf("firmware %s: expected a %d-byte MRTD, got %d bytes", fw.FirmwareFile[:16], sha512.Size384, len(mrtd))
+	}
+	return nil
+}
+
+// BootDigests returns the digests the catalog accepts for each boot variable event.
+func (c *Catalog) BootDigests() map[string][][]byte {
+	digests := map[string][][]byte{
+		"BootOrder": {measureSha384(bootOrderData)},
+		"Boot0000":  {c.Boot0000},
+	}
+	for _, boot := range c.BootVariants {
+		digests["Boot0001"] = append(digests["Boot0001"], boot.Boot0001)
+		digests["Boot0002"] = append(digests["Boot0002"], boot.Boot0002)
+	}
+	return digests
+}
+
+// clone returns a copy of the catalog that can be modified without affecting c.
+func (c *Catalog) clone() *Catalog {
+	out := *c
+	out.Firmware = slices.Clone(c.Firmware)
+	out.BootVariants = slices.Clone(c.BootVariants)
+	out.MachineConfigurations = make(map[string]MachineConfiguration, len(c.MachineConfigurations))
+	for name, config := range c.MachineConfigurations {
+		config.AcpiHashes = slices.Clone(config.AcpiHashes)
+		out.MachineConfigurations[name] = config
+	}
+	return &out
+}
+
+// Registry holds the catalog used to compute measurements and lets callers add or override
+// entries at runtime. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	catalog *Catalog
+}
+
+// NewRegistry returns a registry initialized with a copy of the catalog.
+func NewRegistry(c *Catalog) *Registry {
+	return &Registry{catalog: c.clone()}
+}
+
+// NewDefaultRegistry returns a registry initialized with the embedded catalog.
+func NewDefaultRegistry() *Registry {
+	return NewRegistry(DefaultCatalog())
+}
+
+// defaultRegistry backs the package-level measurement functions.
+var defaultRegistry = NewDefaultRegistry()
+
+// Catalog returns a copy of the registry's current catalog.
+func (r *Registry) Catalog() *Catalog {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.catalog.clone()
+}
+
+// Firmware returns the published firmware and their MRTDs.
+func (r *Registry) Firmware() []FirmwareMRTD {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.catalog.Firmware)
+}
+
+// IsKnownFirmware reports whether the firmware hash is in the catalog.
+func (r *Registry) IsKnownFirmware(hash string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.ContainsFunc(r.catalog.Firmware, func(fw FirmwareMRTD) bool {
+		return fw.FirmwareFile == hash
+	})
+}
+
+// MRTD returns the MRTD of a firmware image: the published MRTD when the catalog lists the
+// firmware, otherwise the one computed by MeasureMRTD.
+func (r *Registry) MRTD(fw []byte) ([]byte, error) {
+	sum := sha512.Sum384(fw)
+	hash := hex.EncodeToString(sum[:])
+	r.mu.RLock()
+	i := slices.IndexFunc(r.catalog.Firmware, func(fw FirmwareMRTD) bool { return fw.FirmwareFile == hash })
+	var published string
+	if i >= 0 {
+		published = r.catalog.Firmware[i].MRTD
+	}
+	r.mu.RUnlock()
+	if i < 0 {
+		return MeasureMRTD(fw)
+	}
+	mrtd, err := hex.DecodeString(published)
+	if err != nil {
+		return nil, fmt.Errorf("firmware %s: invalid published MRTD: %w", hash[:16], err)
+	}
+	return mrtd, nil
+}
+
+// AddFirmware adds a published firmware.
+func (r *Registry) AddFirmware(fw FirmwareMRTD) error {
+	if err := fw.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.catalog.Firmware = append(r.catalog.Firmware, fw)
+	return nil
+}
+
+// MachineConfigurationNames returns the names of the machine configurations, sorted.
+func (r *Registry) MachineConfigurationNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Sorted(maps.Keys(r.catalog.MachineConfigurations))
+}
+
+// MachineConfiguration returns a machine configuration by name.
+func (r *Registry) MachineConfiguration(name string) (MachineConfiguration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	config, ok := r.catalog.MachineConfigurations[name]
+	config.AcpiHashes = slices.Clone(config.AcpiHashes)
+	return config, ok
+}
+
+// SetMachineConfiguration adds a machine configuration or replaces an existing one.
+func (r *Registry) SetMachineConfiguration(name string, config MachineConfiguration) error {
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	config.AcpiHashes = slices.Clone(config.AcpiHashes)
+	r.catalog.MachineConfigurations[name] = config
+	return nil
+}
+
+// AddAcpiHashes adds an ACPI hash set, typically for a new firmware epoch, to a machine configuration.
+func (r *Registry) AddAcpiHashes(name string, acpi AcpiHashes) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	config, ok := r.catalog.MachineConfigurations[name]
+	if !ok {
+		return fmt.Errorf("unknown machine configuration: %s", name)
+	}
+	config.AcpiHashes = append(slices.Clone(config.AcpiHashes), acpi)
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	r.catalog.MachineConfigurations[name] = config
+	return nil
+}
+
+// AddBootVariant adds a boot option variant.
+func (r *Registry) AddBootVariant(boot BootVariant) error {
+	if err := validateDigest("boot0001", boot.Boot0001); err != nil {
+		return err
+	}
+	if err := validateDigest("boot0002", boot.Boot0002); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.catalog.BootVariants = append(r.catalog.BootVariants, boot)
+	return nil
+}
+
+// SetSecureBoot replaces the Secure Boot variable hashes.
+func (r *Registry) SetSecureBoot(hashes SecureBootHashes) error {
+	digests := map[string][]byte{"SecureBoot": hashes.SecureBoot, "PK": hashes.PK, "KEK": hashes.KEK, "db": hashes.DB, "dbx": hashes.DBX}
+	for _, name := range slices.Sorted(maps.Keys(digests)) {
+		if err := validateDigest(name, digests[name]); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.catalog.SecureBoot = hashes
+	return nil
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCatalog(t *testing.T) {
+	data, err := DefaultCatalog().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const boot0000 = "23ada07f5261f12f34a0bd8e46760962d6b4d576a416f1fea1c64bc656b1d28eacf7047ae6e967c58fd2a98bfa74c298"
+	const firmware = "ff11d313b462e2c7b08143f54785f77f71f55f71673d934c8e209c086294548c8c61eff4b3a9dd0708e3e5d79e163f39"
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{name: "valid"},
+		{name: "version", old: `"version": 1`, new: `"version": 2`, want: "unsupported version 2"},
+		{name: "short digest", old: boot0000, new: boot0000[:64], want: "boot0000: expected a 48-byte digest, got 32 bytes"},
+		{name: "invalid hex", old: boot0000, new: "zz" + boot0000[2:], want: "invalid hex string"},
+		{name: "firmware hash", old: firmware, new: strings.ToUpper(firmware), want: "invalid firmware hash"},
+		{name: "MRTD hex", old: `"mrtd": "`, new: `"mrtd": "zz`, want: "invalid MRTD"},
+		{name: "short MRTD", old: `"mrtd": "`, new: `"mrtd": "00`, want: "expected a 48-byte MRTD, got 49 bytes"},
+		{name: "TD HOB digest", old: `"td_hob": "a5be8ecd`, new: `"td_hob": "`, want: "c3-standard-22: td_hob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := data
+			if tt.old != "" {
+				if !bytes.Contains(data, []byte(tt.old)) {
+					t.Fatalf("catalog does not contain %q", tt.old)
+				}
+				modified = bytes.Replace(data, []byte(tt.old), []byte(tt.new), 1)
+			}
+			c, err := ParseCatalog(modified)
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("ParseCatalog() error = %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c, DefaultCatalog()) {
+				t.Error("ParseCatalog(Marshal()) differs from the catalog")
+			}
+		})
+	}
+}
+
+// TestDefaultCatalogCaptured checks the captured catalog values that can be derived from their
+// definition.
+func TestDefaultCatalogCaptured(t *testing.T) {
+	c := DefaultCatalog()
+
+	// GCE boots with Secure Boot disabled.
+	if got := (&SecureBootVariables{}).Hashes().SecureBoot; !bytes.Equal(got, c.SecureBoot.SecureBoot) {
+		t.Errorf("SecureBoot = %x, want the disabled SecureBoot variable %x", c.SecureBoot.SecureBoot, got)
+	}
+
+	// Boot0000 is the UiApp boot manager menu.
+	config, err := DiskTopology{Interface: DiskInterfaceNVMe}.BootConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uiApp := config.Options[len(config.Options)-1]
+	data, err := uiApp.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := measureSha384(data); uiApp.Name() != "Boot0000" || !bytes.Equal(got, c.Boot0000) {
+		t.Errorf("%s = %x, want the catalog Boot0000 %x", uiApp.Name(), got, c.Boot0000)
+	}
+
+	files := make(map[string]bool)
+	for _, fw := range c.Firmware {
+		if mrtd, err := hex.DecodeString(fw.MRTD); err != nil || len(mrtd) != 48 {
+			t.Errorf("firmware %s: invalid MRTD %q", fw.FirmwareFile, fw.MRTD)
+		}
+		if files[fw.FirmwareFile] {
+			t.Errorf("firmware %s is listed twice", fw.FirmwareFile)
+		}
+		files[fw.FirmwareFile] = true
+	}
+	for name, config := range c.MachineConfigurations {
+		if len(config.AcpiHashes) == 0 {
+			t.Errorf("%s: no ACPI hashes", name)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewDefaultRegistry()
+	digest := bytes.Repeat([]byte{0xaa}, 48)
+	acpi := AcpiHashes{Epoch: "test", AcpiLoaderHash: digest, AcpiRsdpHash: digest, AcpiTablesHash: digest}
+
+	names := r.MachineConfigurationNames()
+	if len(names) == 0 {
+		t.Fatal("no machine configurations")
+	}
+	name := names[0]
+	before, _ := r.MachineConfiguration(name)
+	if err := r.AddAcpiHashes(name, acpi); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := r.MachineConfiguration(name)
+	if len(after.AcpiHashes) != len(before.AcpiHashes)+1 || after.AcpiHashes[len(after.AcpiHashes)-1].Epoch != "test" {
+		t.Errorf("AddAcpiHashes() did not append the epoch: %+v", after.AcpiHashes)
+	}
+	// The registry keeps its own copy of the catalog.
+	if c, _ := NewDefaultRegistry().MachineConfiguration(name); len(c.AcpiHashes) != len(before.AcpiHashes) {
+		t.Error("AddAcpiHashes() modified the default catalog")
+	}
+	after.AcpiHashes[0].Epoch = "modified"
+	if c, _ := r.MachineConfiguration(name); c.AcpiHashes[0].Epoch == "modified" {
+		t.Error("MachineConfiguration() returned the registry's slice")
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{name: "unknown configuration", call: func() error { return r.AddAcpiHashes("n1-standard-1", acpi) }, want: "unknown machine configuration"},
+		{name: "short ACPI digest", call: func() error {
+			bad := acpi
+			bad.Epoch = "short"
+			bad.AcpiRsdpHash = digest[:32]
+			return r.AddAcpiHashes(name, bad)
+		}, want: "short rsdp: expected a 48-byte digest"},
+		{name: "duplicate epoch", call: func() error { return r.AddAcpiHashes(name, acpi) }, want: `duplicate ACPI epoch "test"`},
+		{name: "invalid firmware", call: func() error { return r.AddFirmware(FirmwareMRTD{FirmwareFile: "firmware.fd"}) }, want: "invalid firmware hash"},
+		{name: "invalid MRTD", call: func() error {
+			return r.AddFirmware(FirmwareMRTD{FirmwareFile: hex.EncodeToString(digest), MRTD: "published"})
+		}, want: "invalid MRTD"},
+		{name: "short MRTD", call: func() error {
+			return r.AddFirmware(FirmwareMRTD{FirmwareFile: hex.EncodeToString(digest), MRTD: hex.EncodeToString(digest[:32])})
+		}, want: "expected a 48-byte MRTD, got 32 bytes"},
+		{name: "first ACPI digest", call: func() error { return r.AddAcpiHashes(name, AcpiHashes{Epoch: "empty"}) }, want: "empty loader: expected a 48-byte digest"},
+		{name: "short boot digest", call: func() error { return r.AddBootVariant(BootVariant{Boot0001: digest, Boot0002: digest[:1]}) }, want: "boot0002"},
+		{name: "first Secure Boot digest", call: func() error { return r.SetSecureBoot(SecureBootHashes{}) }, want: "KEK: expected a 48-byte digest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every call reports the same error: the digests are checked in a fixed order.
+			for range 10 {
+				if err := tt.call(); err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("error = %v, want %q", err, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// TCG event types used by the firmware.
+// See: TCG PC Client Platform Firmware Profile Specification, section 10.4.1.
+const (
+	EvPrebootCert                = 0x00000000
+	EvPostCode                   = 0x00000001
+	EvNoAction                   = 0x00000003
+	EvSeparator                  = 0x00000004
+	EvAction                     = 0x00000005
+	EvEventTag                   = 0x00000006
+	EvSCrtmContents              = 0x00000007
+	EvSCrtmVersion               = 0x00000008
+	EvCpuMicrocode               = 0x00000009
+	EvPlatformConfigFlags        = 0x0000000A
+	EvTableOfDevices             = 0x0000000B
+	EvCompactHash                = 0x0000000C
+	EvIPL                        = 0x0000000D
+	EvIPLPartitionData           = 0x0000000E
+	EvNonhostCode                = 0x0000000F
+	EvNonhostConfig              = 0x00000010
+	EvNonhostInfo                = 0x00000011
+	EvOmitBootDeviceEvents       = 0x00000012
+	EvEfiVariableDriverConfig    = 0x80000001
+	EvEfiVariableBoot            = 0x80000002
+	EvEfiBootServicesApplication = 0x80000003
+	EvEfiBootServicesDriver      = 0x80000004
+	EvEfiRuntimeServicesDriver   = 0x80000005
+	EvEfiGptEvent                = 0x80000006
+	EvEfiAction                  = 0x80000007
+	EvEfiPlatformFirmwareBlob    = 0x80000008
+	EvEfiHandoffTables           = 0x80000009
+	EvEfiPlatformFirmwareBlob2   = 0x8000000A
+	EvEfiHandoffTables2          = 0x8000000B
+	EvEfiVariableBoot2           = 0x8000000C
+	EvEfiHcrtmEvent              = 0x80000010
+	EvEfiVariableAuthority       = 0x800000E0
+	EvEfiSpdmFirmwareBlob        = 0x800000E1
+	EvEfiSpdmFirmwareConfig      = 0x800000E2
+	evLogTerminator              = 0xFFFFFFFF
+)
+
+// TCG algorithm ID of SHA-384.
+const tcgAlgSha384 uint16 = 0x000C
+
+var eventTypeNames = map[uint32]string{
+	EvPrebootCert:                "EV_PREBOOT_CERT",
+	EvPostCode:                   "EV_POST_CODE",
+	EvNoAction:                   "EV_NO_ACTION",
+	EvSeparator:                  "EV_SEPARATOR",
+	EvAction:                     "EV_ACTION",
+	EvEventTag:                   "EV_EVENT_TAG",
+	EvSCrtmContents:              "EV_S_CRTM_CONTENTS",
+	EvSCrtmVersion:               "EV_S_CRTM_VERSION",
+	EvCpuMicrocode:               "EV_CPU_MICROCODE",
+	EvPlatformConfigFlags:        "EV_PLATFORM_CONFIG_FLAGS",
+	EvTableOfDevices:             "EV_TABLE_OF_DEVICES",
+	EvCompactHash:                "EV_COMPACT_HASH",
+	EvIPL:                        "EV_IPL",
+	EvIPLPartitionData:           "EV_IPL_PARTITION_DATA",
+	EvNonhostCode:                "EV_NONHOST_CODE",
+	EvNonhostConfig:              "EV_NONHOST_CONFIG",
+	EvNonhostInfo:                "EV_NONHOST_INFO",
+	EvOmitBootDeviceEvents:       "EV_OMIT_BOOT_DEVICE_EVENTS",
+	EvEfiVariableDriverConfig:    "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	EvEfiVariableBoot:            "EV_EFI_VARIABLE_BOOT",
+	EvEfiBootServicesApplication: "EV_EFI_BOOT_SERVICES_APPLICATION",
+	EvEfiBootServicesDriver:      "EV_EFI_BOOT_SERVICES_DRIVER",
+	EvEfiRuntimeServicesDriver:   "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	EvEfiGptEvent:                "EV_EFI_GPT_EVENT",
+	EvEfiAction:                  "EV_EFI_ACTION",
+	EvEfiPlatformFirmwareBlob:    "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	EvEfiHandoffTables:           "EV_EFI_HANDOFF_TABLES",
+	EvEfiPlatformFirmwareBlob2:   "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	EvEfiHandoffTables2:          "EV_EFI_HANDOFF_TABLES2",
+	EvEfiVariableBoot2:           "EV_EFI_VARIABLE_BOOT2",
+	EvEfiHcrtmEvent:              "EV_EFI_HCRTM_EVENT",
+	EvEfiVariableAuthority:       "EV_EFI_VARIABLE_AUTHORITY",
+	EvEfiSpdmFirmwareBlob:        "EV_EFI_SPDM_FIRMWARE_BLOB",
+	EvEfiSpdmFirmwareConfig:      "EV_EFI_SPDM_FIRMWARE_CONFIG",
+	EvDstackRuntimeEvent:         "DSTACK_RUNTIME_EVENT",
+}
+
+// EventTypeName returns the TCG name of an event type.
+func EventTypeName(eventType uint32) string {
+	if name, ok := eventTypeNames[eventType]; ok {
+		return name
+	}
+	return fmt.Sprintf("EV_UNKNOWN_%#x", eventType)
+}
+
+// CcelEvent is a single event of a TDX CC event log.
+type CcelEvent struct {
+	// MrIndex is the CC measurement register index: 0 is MRTD, 1-4 are RTMR0-3.
+	MrIndex   uint32
+	EventType uint32
+	// Digest is the SHA-384 digest extended into the register.
+	Digest []byte
+	// Data is the raw event data.
+	Data []byte
+}
+
+// RTMR returns the RTMR index the event is extended into, or -1 for MRTD.
+func (e *CcelEvent) RTMR() int {
+	return int(e.MrIndex) - 1
+}
+
+// Description decodes the event data into a short human readable form.
+func (e *CcelEvent) Description() string {
+	switch e.EventType {
+	case EvEfiVariableDriverConfig, EvEfiVariableBoot, EvEfiVariableBoot2, EvEfiVariableAuthority:
+		if name, ok := decodeEfiVariableName(e.Data); ok {
+			return name
+		}
+	case EvEfiPlatformFirmwareBlob2, EvEfiHandoffTables2:
+		// UEFI_PLATFORM_FIRMWARE_BLOB2 and UEFI_HANDOFF_TABLE_POINTERS2 start with a sized description.
+		if len(e.Data) > 0 && int(e.Data[0]) < len(e.Data) {
+			return printable(e.Data[1 : 1+int(e.Data[0])])
+		}
+	case EvEfiGptEvent:
+		return "UEFI_GPT_DATA"
+	case EvEfiBootServicesApplication, EvEfiBootServicesDriver, EvEfiRuntimeServicesDriver:
+		return "UEFI_IMAGE_LOAD_EVENT"
+	case EvSeparator:
+		return fmt.Sprintf("separator %x", e.Data)
+	case EvEventTag, EvIPL:
+		// Linux and systemd log UTF-16 strings, others ASCII.
+		if s, ok := decodeUTF16(e.Data); ok {
+			return s
+		}
+	}
+	return printable(e.Data)
+}
+
+// printable returns data as text if it is mostly printable ASCII.
+func printable(data []byte) string {
+	s := strings.TrimRight(string(data), "\x00")
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			if len(data) > 32 {
+				return fmt.Sprintf("%x...", data[:32])
+			}
+			return fmt.Sprintf("%x", data)
+		}
+	}
+	return s
+}
+
+// decodeUTF16 decodes a NUL-terminated UTF-16LE string.
+func decodeUTF16(data []byte) (string, bool) {
+	if len(data) < 2 || len(data)%2 != 0 || data[1] != 0 {
+		return "", false
+	}
+	u := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		u = append(u, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00"), true
+}
+
+// decodeEfiVariableName extracts the variable name of an UEFI_VARIABLE_DATA structure.
+func decodeEfiVariableName(data []byte) (string, bool) {
+	if len(data) < 32 {
+		return "", false
+	}
+	nameLen := binary.LittleEndian.Uint64(data[16:24])
+	if nameLen > uint64(len(data)-32)/2 {
+		return "", false
+	}
+	return decodeUTF16(data[32 : 32+2*nameLen])
+}
+
+// ParseCcel parses a TCG2 crypto-agile event log as found in the ACPI CCEL table data
+// (/sys/firmware/acpi/tables/data/CCEL). The leading Spec ID event is validated and skipped; the
+// log ends at the first terminator or at the end of the data.
+func ParseCcel(data []byte) ([]CcelEvent, error) {
+	r := bytes.NewReader(data)
+	read := func(v any) error {
+		return binary.Read(r, binary.LittleEndian, v)
+	}
+
+	// The first event uses the legacy SHA-1 format and carries TCG_EfiSpecIdEvent.
+	var header struct {
+		PCRIndex  uint32
+		EventType uint32
+		Digest    [20]byte
+		EventSize uint32
+	}
+	if err := read(&header); err != nil {
+		return nil, fmt.Errorf("event log: failed to read header: %w", err)
+	}
+	if header.EventType != EvNoAction || int64(header.EventSize) > int64(r.Len()) {
+		return nil, fmt.Errorf("event log: invalid Spec ID event")
+	}
+	spec := make([]byte, header.EventSize)
+	_, _ = r.Read(spec)
+	if len(spec) < 28 || !bytes.HasPrefix(spec, []byte("Spec ID Event03\x00")) {
+		return nil, fmt.Errorf("event log: not a crypto-agile log")
+	}
+	numAlgs := binary.LittleEndian.Uint32(spec[24:28])
+	if uint64(len(spec)) < 28+4*uint64(numAlgs) {
+		return nil, fmt.Errorf("event log: truncated Spec ID event")
+	}
+	digestSizes := make(map[uint16]int)
+	for i := range int(numAlgs) {
+		alg := binary.LittleEndian.Uint16(spec[28+4*i:])
+		digestSizes[alg] = int(binary.LittleEndian.Uint16(spec[30+4*i:]))
+	}
+	if digestSizes[tcgAlgSha384] != 48 {
+		return nil, fmt.Errorf("event log: no SHA-384 bank")
+	}
+
+	var events []CcelEvent
+	for r.Len() >= 8 {
+		var e CcelEvent
+		var count uint32
+		if err := read(&e.MrIndex); err != nil {
+			return nil, err
+		}
+		if err := read(&e.EventType); err != nil {
+			return nil, err
+		}
+		if e.EventType == evLogTerminator || (e.MrIndex == 0 && e.EventType == 0) {
+			break
+		}
+		if err := read(&count); err != nil {
+			return nil, fmt.Errorf("event log: event %d: %w", len(events), err)
+		}
+		for range count {
+			var alg uint16
+			if err := read(&alg); err != nil {
+				return nil, fmt.Errorf("event log: event %d: %w", len(events), err)
+			}
+			size, ok := digestSizes[alg]
+			if !ok {
+				return nil, fmt.Errorf("event log: event %d: unknown digest algorithm %#x", len(events), alg)
+			}
+			digest := make([]byte, size)
+			if _, err := io.ReadFull(r, digest); err != nil {
+				return nil, fmt.Errorf("event log: event %d: truncated digest", len(events))
+			}
+			if alg == tcgAlgSha384 {
+				e.Digest = digest
+			}
+		}
+		var size uint32
+		if err := read(&size); err != nil {
+			return nil, fmt.Errorf("event log: event %d: %w", len(events), err)
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("event log: event %d: truncated data", len(events))
+		}
+		e.Data = make([]byte, size)
+		_, _ = r.Read(e.Data)
+
+		if e.Digest == nil && e.EventType != EvNoAction {
+			return nil, fmt.Errorf("event log: event %d has no SHA-384 digest", len(events))
+		}
+		if e.MrIndex > 4 {
+			return nil, fmt.Errorf("event log: event %d has invalid MR index %d", len(events), e.MrIndex)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Event returns the event as extended into its RTMR.
+func (e *CcelEvent) Event() Event {
+	return Event{Register: e.RTMR(), Type: e.EventType, Description: e.Description(), Digest: e.Digest, Preimage: e.Data}
+}
+
+// CcelEventLog returns the log of the events extended into RTMR0-3. EV_NO_ACTION events are not extended.
+func CcelEventLog(events []CcelEvent) *EventLog {
+	log := NewEventLog()
+	for _, e := range events {
+		if e.EventType == EvNoAction || e.RTMR() < 0 || e.RTMR() >= rtmrCount {
+			continue
+		}
+		_ = log.Extend(e.Event())
+	}
+	return log
+}
+
+// ReplayCcel recomputes RTMR0-3 from the events. EV_NO_ACTION events are not extended.
+func ReplayCcel(events []CcelEvent) [4][]byte {
+	return CcelEventLog(events).RTMRs()
+}
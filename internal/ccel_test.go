@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const tcgAlgSha256 uint16 = 0x000B
+
+// ccelEvent is an event of a test CC event log.
+type ccelEvent struct {
+	mrIndex   uint32
+	eventType uint32
+	data      []byte
+}
+
+// testCcel encodes a crypto-agile event log with SHA-256 and SHA-384 banks, terminated by a
+// zeroed event like the unused remainder of the CCEL area.
+func testCcel(banks map[uint16]int, events ...ccelEvent) []byte {
+	var b bytes.Buffer
+	put := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+
+	spec := append([]byte("Spec ID Event03\x00"), make([]byte, 8)...)
+	spec = binary.LittleEndian.AppendUint32(spec, uint32(len(banks)))
+	for _, alg := range []uint16{tcgAlgSha256, tcgAlgSha384} {
+		if size, ok := banks[alg]; ok {
+			spec = binary.LittleEndian.AppendUint16(spec, alg)
+			spec = binary.LittleEndian.AppendUint16(spec, uint16(size))
+		}
+	}
+	spec = append(spec, 0) // vendorInfoSize
+	put(uint32(0))
+	put(uint32(EvNoAction))
+	put([20]byte{})
+	put(uint32(len(spec)))
+	b.Write(spec)
+
+	for _, e := range events {
+		put(e.mrIndex)
+		put(e.eventType)
+		put(uint32(2))
+		put(tcgAlgSha256)
+		sha256Digest := sha256.Sum256(e.data)
+		b.Write(sha256Digest[:])
+		put(tcgAlgSha384)
+		b.Write(measureSha384(e.data))
+		put(uint32(len(e.data)))
+		b.Write(e.data)
+	}
+	b.Write(make([]byte, 16))
+	return b.Bytes()
+}
+
+var testCcelBanks = map[uint16]int{tcgAlgSha256: 32, tcgAlgSha384: 48}
+
+func TestParseCcel(t *testing.T) {
+	separator := []byte{0, 0, 0, 0}
+	data := testCcel(testCcelBanks,
+		ccelEvent{mrIndex: 1, eventType: EvSeparator, data: separator},
+		ccelEvent{mrIndex: 2, eventType: EvEfiAction, data: []byte("Calling EFI Application from Boot Option")},
+		ccelEvent{mrIndex: 3, eventType: EvNoAction, data: []byte("ignored")},
+	)
+	events, err := ParseCcel(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if got := events[1].Description(); got != "Calling EFI Application from Boot Option" {
+		t.Errorf("Description() = %q", got)
+	}
+	if got := events[0].RTMR(); got != 0 {
+		t.Errorf("RTMR() = %d, want 0", got)
+	}
+
+	rtmrs := ReplayCcel(events)
+	zero := make([]byte, 48)
+	want := [4][]byte{
+		extendMR(zero, measureSha384(separator)),
+		extendMR(zero, measureSha384([]byte("Calling EFI Application from Boot Option"))),
+		zero,
+		zero,
+	}
+	for i := range rtmrs {
+		if !bytes.Equal(rtmrs[i], want[i]) {
+			t.Errorf("RTMR%d = %x, want %x", i, rtmrs[i], want[i])
+		}
+	}
+}
+
+func TestParseCcelMalformed(t *testing.T) {
+	valid := testCcel(testCcelBanks, ccelEvent{mrIndex: 1, eventType: EvSeparator, data: []byte{0, 0, 0, 0}})
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "empty", data: nil, wantErr: "failed to read header"},
+		{name: "no SHA-384 bank", data: testCcel(map[uint16]int{tcgAlgSha256: 32}), wantErr: "no SHA-384 bank"},
+		{name: "not crypto-agile", data: bytes.Replace(valid, []byte("Spec ID Event03"), []byte("Spec ID Event02"), 1), wantErr: "not a crypto-agile log"},
+		{name: "truncated data", data: valid[:len(valid)-16-2], wantErr: "truncated data"},
+		{name: "invalid MR index", data: testCcel(testCcelBanks, ccelEvent{mrIndex: 5, eventType: EvSeparator}), wantErr: "invalid MR index"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCcel(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseCcel() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
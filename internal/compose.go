@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Runners of an app-compose.json.
+const (
+	RunnerDockerCompose = "docker-compose"
+	RunnerBash          = "bash"
+)
+
+// AppCompose holds the fields of a dstack app-compose.json that affect the measurements. The
+// compose hash covers the whole document, including fields not listed here.
+type AppCompose struct {
+	ManifestVersion         int      `json:"manifest_version"`
+	Name                    string   `json:"name"`
+	Runner                  string   `json:"runner"`
+	DockerComposeFile       string   `json:"docker_compose_file,omitempty"`
+	BashScript              string   `json:"bash_script,omitempty"`
+	PreLaunchScript         string   `json:"pre_launch_script,omitempty"`
+	KmsEnabled              bool     `json:"kms_enabled"`
+	GatewayEnabled          bool     `json:"gateway_enabled"`
+	LocalKeyProviderEnabled bool     `json:"local_key_provider_enabled"`
+	KeyProviderID           string   `json:"key_provider_id,omitempty"`
+	PublicLogs              bool     `json:"public_logs"`
+	PublicSysinfo           bool     `json:"public_sysinfo"`
+	AllowedEnvs             []string `json:"allowed_envs,omitempty"`
+	NoInstanceID            bool     `json:"no_instance_id"`
+	SecureTime              bool     `json:"secure_time"`
+
+	// document is the parsed JSON the compose hash is computed from.
+	document map[string]any
+}
+
+// ParseAppCompose parses an app-compose.json.
+func ParseAppCompose(data []byte) (*AppCompose, error) {
+	var c AppCompose
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("app compose: %w", err)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&c.document); err != nil {
+		return nil, fmt.Errorf("app compose: %w", err)
+	}
+	if c.document == nil {
+		return nil, fmt.Errorf("app compose: document is not an object")
+	}
+	return &c, nil
+}
+
+// Normalize returns the canonical form of the document dstack computes the compose hash from:
+// the fields the runner does not use are dropped, an empty pre_launch_script is removed, and the
+// document is encoded as compact JSON with sorted keys, as JSON.stringify does.
+func (c *AppCompose) Normalize() ([]byte, error) {
+	doc := maps.Clone(c.document)
+	switch c.Runner {
+	case RunnerDockerCompose:
+		delete(doc, "bash_script")
+	case RunnerBash:
+		delete(doc, "docker_compose_file")
+	}
+	if s, ok := doc["pre_launch_script"].(string); ok && s == "" {
+		delete(doc, "pre_launch_script")
+	}
+	var buf bytes.Buffer
+	if err := writeCanonicalJSON(&buf, doc); err != nil {
+		return nil, fmt.Errorf("app compose: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ComposeHash returns the SHA-256 of the normalized document.
+func (c *AppCompose) ComposeHash() ([]byte, error) {
+	normalized, err := c.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(normalized)
+	return h[:], nil
+}
+
+// AppID returns the app ID derived from the compose hash, see AppIDFromComposeHash.
+func (c *AppCompose) AppID() ([]byte, error) {
+	h, err := c.ComposeHash()
+	if err != nil {
+		return nil, err
+	}
+	return AppIDFromComposeHash(h), nil
+}
+
+// AppIDFromComposeHash returns the app ID derived from a compose hash: its first 20 bytes. Apps
+// registered with a KMS may use a different ID.
+func AppIDFromComposeHash(composeHash []byte) []byte {
+	return composeHash[:appIDSize]
+}
+
+// writeCanonicalJSON encodes v as compact JSON with object keys sorted recursively.
+func writeCanonicalJSON(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		buf.WriteByte('{')
+		for i, k := range slices.Sorted(maps.Keys(v)) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		writeJSONString(buf, v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteString(formatJSNumber(f))
+	case bool, nil:
+		data, _ := json.Marshal(v)
+		buf.Write(data)
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+	return nil
+}
+
+// writeJSONString encodes a string as JSON.stringify does: unlike encoding/json, only quotes,
+// backslashes and control characters are escaped.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// formatJSNumber formats a number as JavaScript's Number.prototype.toString does.
+func formatJSNumber(f float64) string {
+	if f == 0 {
+		return "0"
+	}
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	// Go pads the exponent to two digits; JavaScript does not.
+	mantissa, exp, _ := strings.Cut(s, "e")
+	sign := exp[0]
+	exp = strings.TrimLeft(exp[1:], "0")
+	return mantissa + "e" + string(sign) + exp
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestAppComposeNormalize(t *testing.T) {
+	// The expected documents and hashes are produced by JSON.stringify on the documents with
+	// sorted keys.
+	tests := []struct {
+		name     string
+		compose  string
+		want     string
+		wantHash string
+	}{
+		{
+			name: "docker-compose",
+			compose: `{"runner":"docker-compose","name":"app \"ü\" <&>\u2028","docker_compose_file":"services:\n\tweb: {}\r\n",` +
+				`"bash_script":"echo hi","pre_launch_script":"","manifest_version":2,` +
+				`"features":["kms",{"z":1.50,"a":[1e21,1e-7,0.000001,-0,100,12345678901234567890]}],` +
+				`"ctl":"\u0001\u001f\b\f","kms_enabled":true,"nothing":null}`,
+			want: `{"ctl":"\u0001\u001f\b\f","docker_compose_file":"services:\n\tweb: {}\r\n",` +
+				`"features":["kms",{"a":[1e+21,1e-7,0.000001,0,100,12345678901234567000],"z":1.5}],` +
+				`"kms_enabled":true,"manifest_version":2,"name":"app \"ü\" <&>` + "\u2028" + `","nothing":null,"runner":"docker-compose"}`,
+			wantHash: "b68f40f22696c97aa174b94186f2518d6e33305351c0983232bad002d3ecd44b",
+		},
+		{
+			name:    "bash",
+			compose: "{\n  \"runner\": \"bash\",\n  \"bash_script\": \"echo hi\",\n  \"docker_compose_file\": \"services: {}\",\n  \"pre_launch_script\": \"true\"\n}\n",
+			want:    `{"bash_script":"echo hi","pre_launch_script":"true","runner":"bash"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseAppCompose([]byte(tt.compose))
+			if err != nil {
+				t.Fatal(err)
+			}
+			normalized, err := c.Normalize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(normalized) != tt.want {
+				t.Errorf("Normalize() = %s\nwant %s", normalized, tt.want)
+			}
+			if tt.wantHash == "" {
+				return
+			}
+			hash, err := c.ComposeHash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(hash); got != tt.wantHash {
+				t.Errorf("ComposeHash() = %s, want %s", got, tt.wantHash)
+			}
+			appID, err := c.AppID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(appID, hash[:20]) {
+				t.Errorf("AppID() = %x, want the first 20 bytes of the compose hash", appID)
+			}
+		})
+	}
+}
+
+func TestParseAppComposeMalformed(t *testing.T) {
+	for _, compose := range []string{`{"runner":`, `null`, `{"manifest_version":"2"}`} {
+		if _, err := ParseAppCompose([]byte(compose)); err == nil || !strings.Contains(err.Error(), "app compose") {
+			t.Errorf("ParseAppCompose(%s) error = %v, want an app compose error", compose, err)
+		}
+	}
+}
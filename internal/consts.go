@@ -1,159 +1,8 @@
 package internal
 
-import (
-	"encoding/hex"
-	"fmt"
-)
-
-func mustDecodeHex(s string) []byte {
-	b, err := hex.DecodeString(s)
-	if err != nil {
-		panic(fmt.Sprintf("invalid hex string: %s", s))
-	}
-	return b
-}
-
 // Constant measurements
 const (
 	XFAM         = "e700060000000000"
 	TDAttributes = "0000001000000000"
 	Empty        = "000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
 )
-
-// FirmwareMRTD pairs a firmware file name (from gs://gce_tcb_integrity/ovmf_x64_csm)
-// with its corresponding MRTD (from gs://gce_tcb_integrity/ovmf_x64_csm/tdx)
-type FirmwareMRTD struct {
-	FirmwareFile string
-	MRTD         string
-}
-
-// FirmwareMRTDs contains all supported firmware/MRTD pairs
-var FirmwareMRTDs = []FirmwareMRTD{
-	{
-		FirmwareFile: "ff11d313b462e2c7b08143f54785f77f71f55f71673d934c8e209c086294548c8c61eff4b3a9dd0708e3e5d79e163f39",
-		MRTD:         "a5844e88897b70c318bef929ef4dfd6c7304c52c4bc9c3f39132f0fdccecf3eb5bab70110ee42a12509a31c037288694",
-	},
-	{
-		FirmwareFile: "afa88de3952c1b3f696fb5c526493742ff25131848bd769305c69166103a53790d010ffb34149b5f428df6eaa39a2749",
-		MRTD:         "8370d8f6d02f2d13e211e91c93fde923049522b241425a29a7bf0071ef49b250af4ef49d852fa3e10065d1b51dfce8fb",
-	},
-	{
-		FirmwareFile: "f53fdf89544e1e6d785eee42d0a4bb38e26b36e951be537ac22114d210f2d5239eba243dd71991afe8345e7020974a46",
-		MRTD:         "feb7486608382c1ff0e15b4648ddc0acea6ca974eb53e3529f4c4bd5ffbaa20bf335cb75965cea65fe473aed9647c162",
-	},
-}
-
-// bootVariant contains NVMe driver boot option measurements.
-type bootVariant struct {
-	Boot0001 []byte
-	Boot0002 []byte
-}
-
-var bootVariants = []bootVariant{
-	{
-		Boot0001: mustDecodeHex("A25333C7AEC2E0993034938C7F11893B3C2BCAF67E88C342A3D586F6F7FAE2C6A1247A9ED86988080A6D4BE497D4FBB6"),
-		Boot0002: mustDecodeHex("9068065754FF3AE3DD58A5897535EEAF62A19A6757D82DD91349C41BAE2E3F208E268ABBA2A4378BC5C8D1ACF2FD260F"),
-	},
-}
-
-var boot0000Hash = mustDecodeHex("23ADA07F5261F12F34A0BD8E46760962D6B4D576A416F1FEA1C64BC656B1D28EACF7047AE6E967C58FD2A98BFA74C298")
-
-// Hardcoded SHA384 hashes of TDX EFI variables
-var (
-	secureBootHash = mustDecodeHex("CFA4E2C606F572627BF06D5669CC2AB1128358D27B45BC63EE9EA56EC109CFAFB7194006F847A6A74B5EAED6B73332EC")
-	pkHash         = mustDecodeHex("905F6243BAF0D7C63CD672F89B16E15F99597E8D0392955E685172D447100123F7C490D178543922FADDF896625DABAB")
-	kekHash        = mustDecodeHex("BE013B0D9188E72B870F598899C35864D6B25F029A7B5F21A037BACF61CA3646207AF2BC714D471407C9939317763C4A")
-	dbHash         = mustDecodeHex("723AD4D64F430BF6D325AB9D6C29147993DED5630002E42E13DF696EBC680C4BC14C392D2E113E141154E21723F890F6")
-	dbxHash        = mustDecodeHex("C61BAE1A3F7B7E6CC3B9B03F630B77292EBD232AE60E0E1916F980955EC38459529574B49F1898C367EAF6D8A62311F5")
-)
-
-// acpiHashes holds the measured hashes for one set of ACPI tables (tied to a specific firmware version).
-// A machine configuration may have multiple valid sets when GCP updates their firmware.
-type acpiHashes struct {
-	AcpiLoaderHash []byte
-	AcpiRsdpHash   []byte
-	AcpiTablesHash []byte
-}
-
-// configurationEvents maps machine configuration to hardcoded TD HOB and ACPI table hashes
-type configurationEvents struct {
-	TdHobHash  []byte
-	AcpiHashes []acpiHashes
-}
-
-var machineConfigurations = map[string]configurationEvents{
-	"c3-standard-4": {
-		TdHobHash: mustDecodeHex("458994DAA60DEAC8DEA19DBA79748F6FF93FD0AEBB8E3E0BE5A65EB12309D342C3CE31CC67AF7BBD22AF1A44E7D9FE21"),
-		AcpiHashes: []acpiHashes{
-			{
-				// Pre-March 2026 firmware
-				AcpiLoaderHash: mustDecodeHex("F29E022D067DA7289C935EEC2477C46032F2E0659A11E658F0AE05068AEA420189E77E302B715084DACC7C0C4C118EA6"),
-				AcpiRsdpHash:   mustDecodeHex("509DCFE10BEB5D470C40F25E30895370948831B9CF79DB15D977E7BBA8EB42F7200212071AD8B19D6011759779ECED5A"),
-				AcpiTablesHash: mustDecodeHex("0F0B426CBD5BD9C2A4A5E640E6C4556B8DF071DCC973DCF95465AE5514C0EBA6DC960A6B7B21D29099CADA75DC1B46D5"),
-			},
-			{
-				// March 2026 firmware (from mripper 2026-03-13)
-				AcpiLoaderHash: mustDecodeHex("02D9B85E7DF1E92D15D85988B161FDF60626BFF433AF8055F367B134260D59F6A0DAB0965254627AECB1367373D74B3A"),
-				AcpiRsdpHash:   mustDecodeHex("BA3706E632A5CB239F1C85FEBAFCFEADEBDFE3ED1A4D716D46387AD0803B4C4A7FECBCAD2C05CD390E5F4F3548E303DC"),
-				AcpiTablesHash: mustDecodeHex("D221BAE226ED9811EC5977C8F15DBE8C97FF80D67BBD4246D5ECF60F7C61081E597E18DF601A657A46CBDEB773AB8F88"),
-			},
-			{
-				// April 2026 firmware (from mripper 2026-04-14)
-				AcpiLoaderHash: mustDecodeHex("595AFD922C90EBBE335C7973D0BD3FFCC7820B41F81929AD80B3B5E919B51FC07C0FF23EBB14088563E2B2886412415C"),
-				AcpiRsdpHash:   mustDecodeHex("F877ABF8389A35D12290902A3D769A970BBBC16DC6FC568817C09FD6534C2752F3BCFF8C2AFEB65F8BE93E248E58052D"),
-				AcpiTablesHash: mustDecodeHex("7605E3E2CAD7BE3AFF8D19DBA4FBAF8B12B3322CF9D1AFDD1587EC75C12588C628595008B49243D58843ED0E1BAD63E9"),
-			},
-		},
-	},
-	"c3-standard-8": {
-		TdHobHash: mustDecodeHex("AA9E81FEEB58A9EB3A9F4110CC7B5696240437EA4C1A9C30518CFC44FA305183E6473E6BC02DDC4DE09D0C49C49FADB5"),
-		AcpiHashes: []acpiHashes{
-			{
-				// April 2026 firmware (from mripper 2026-06-10)
-				AcpiLoaderHash: mustDecodeHex("817ED5D198C9F02B43CAB233916B71C0A02B7C27507DC2331A619BF314635A4D82F52A69DC29CE2490694B1058147CD8"),
-				AcpiRsdpHash:   mustDecodeHex("98EE59933BE736E33F9D2D5BE7777C9F30FDF93056A4893638F559C130BFE852D63D5559B2E72F5E1B7E48F35657B8C4"),
-				AcpiTablesHash: mustDecodeHex("7D11E4C6983FBF869814962A69BAC39A6CD5947467841DE602A169AF3F9A77974EE740F62336A94BF694F056476FA32D"),
-			},
-		},
-	},
-	"c3-standard-22": {
-		TdHobHash: mustDecodeHex("A5BE8ECD74020972E328FBBE94D2886817EF0D2E8A4E94E9572E8E1B221F3F608CDDC868CF8B08E8E645E4AAEBA68279"),
-		AcpiHashes: []acpiHashes{
-			{
-				// March 2026 firmware (from mripper 2026-03-13)
-				AcpiLoaderHash: mustDecodeHex("29342AB42C2814109D694110D1C9A7558E08C7C87E478B348FC4944FCAE2105C708813DC0A01FD29A2189D760D41AD03"),
-				AcpiRsdpHash:   mustDecodeHex("440EEF6064096F13201108D30C9B466C0C6B6ED207C8028F7425442C164E80080D8A9BBB6F6B56BE48FDF2C830D99F86"),
-				AcpiTablesHash: mustDecodeHex("2A42ACBB09B7D0E59B59E09F775CB5B7748D0906D87BB886CF87081B6AA1213E42BB745E1AC19064C0CEA19A6CFA5AEB"),
-			},
-			{
-				// April 2026 firmware (from mripper 2026-04-14)
-				AcpiLoaderHash: mustDecodeHex("E604EB632926426EA42BF22C97845E499B116D9988D163897C06595C501D924BA4B32600DF960A70482C5E7665FDE31F"),
-				AcpiRsdpHash:   mustDecodeHex("FA3427613D7EA513391E308DD91F254D52744131E080D01E5C09C170E897EDEF34AFB1F83EFEA74D6729BDAD929032BF"),
-				AcpiTablesHash: mustDecodeHex("B9D101B755CF100437205FA4CDEC9660E451D31D3707EBA607D5E2AEA8CD76976F71A9EDE56D091787E7A81189B3A549"),
-			},
-		},
-	},
-	"c3-standard-44": {
-		TdHobHash: mustDecodeHex("21092EADB73948AEBB405B826354C23C3025635C89A8D91F85905AFB120B7D98025A6C3083E8E82B5320695B253CE341"),
-		AcpiHashes: []acpiHashes{
-			{
-				// Pre-March 2026 firmware
-				AcpiLoaderHash: mustDecodeHex("8B8256B4DD618EA330A3C499FD211B9FA681B8205C470013B9C13CA3263C5DA5B2E253F89EE0CA5111A41F8054856DF3"),
-				AcpiRsdpHash:   mustDecodeHex("C104E3179249648403077F70784B26C9844394177179145E28844B2DC7E40B34D0FAD0BA22B3A3CEF00197D2BD58F4C4"),
-				AcpiTablesHash: mustDecodeHex("C4AE73D7E84F15AA17F7FCF50C83B2846E7E6628CFF7F993531B6D8DE129BD84359E234FEEAF5E4C4A4C87A167161960"),
-			},
-			{
-				// March 2026 firmware (from mripper 2026-03-13)
-				AcpiLoaderHash: mustDecodeHex("0FB22EA8315F50939D88E835E425B083B4E87C5A738B6B09E03191D0583BBA7E35091DE84770CE643BD17828C96A50E6"),
-				AcpiRsdpHash:   mustDecodeHex("EB2ECD4E4FF962F12888ED1E0209437D1C1DBD9CCE050286E10DD79B33D000075BD4287B6066C482A1D4851C07485E97"),
-				AcpiTablesHash: mustDecodeHex("0381C7A53B1FA332467E6EA7240FB38B8EA5E6740AF0B5C496C8D66E0647DA7706B6E149B9FD00C420572B419FFC9608"),
-			},
-			{
-				// April 2026 firmware (from mripper 2026-04-14)
-				AcpiLoaderHash: mustDecodeHex("7A40E09EE7FE41BAC83BF518A611F2D223BD433189E0757CC9893646A850B77578266FF53652F38F2B28B91E3471E708"),
-				AcpiRsdpHash:   mustDecodeHex("F1466AD49807C50B0DF671C155C03A85ABCE04AAD460C8A078F412299056834B3DC3BCBB8B0816D86997EEDC21BCE1E0"),
-				AcpiTablesHash: mustDecodeHex("71F14359DC15C2BA4F9C31FCC04F75D57849D3C0476AB72AEF4DBFF02182FF8EB7C18DD8D89CC6DEF235DC2C56A6EE49"),
-			},
-		},
-	},
-}
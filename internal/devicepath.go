@@ -0,0 +1,307 @@
+package internal
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Device path node types and subtypes (UEFI specification, chapter 10).
+const (
+	devicePathHardware      = 0x01
+	devicePathAcpi          = 0x02
+	devicePathMessaging     = 0x03
+	devicePathMedia         = 0x04
+	devicePathEnd           = 0x7f
+	devicePathSubPci        = 0x01
+	devicePathSubAcpi       = 0x01
+	devicePathSubScsi       = 0x02
+	devicePathSubNVMe       = 0x17
+	devicePathSubHardDrive  = 0x01
+	devicePathSubFilePath   = 0x04
+	devicePathSubFvFile     = 0x06
+	devicePathSubFv         = 0x07
+	devicePathSubEndEntire  = 0xff
+	pciRootHID              = 0x0a0341d0 // EISA_PNP_ID(0x0A03)
+	hardDriveMBRTypeGPT     = 0x02
+	hardDriveSignatureGUID  = 0x02
+	devicePathNodeHeaderLen = 4
+)
+
+// DevicePath is an encoded EFI device path. Paths built from nodes are terminated with
+// EndDevicePath; a single node is a path without terminator.
+type DevicePath []byte
+
+// devicePathNode encodes a device path node.
+func devicePathNode(nodeType, subType byte, data []byte) DevicePath {
+	node := []byte{nodeType, subType}
+	node = binary.LittleEndian.AppendUint16(node, uint16(devicePathNodeHeaderLen+len(data)))
+	return append(node, data...)
+}
+
+// PciRootNode returns the PciRoot(uid) node of a PCI root bridge.
+func PciRootNode(uid uint32) DevicePath {
+	data := binary.LittleEndian.AppendUint32(nil, pciRootHID)
+	return devicePathNode(devicePathAcpi, devicePathSubAcpi, binary.LittleEndian.AppendUint32(data, uid))
+}
+
+// PciNode returns the Pci(device,function) node of a PCI device.
+func PciNode(device, function uint8) DevicePath {
+	return devicePathNode(devicePathHardware, devicePathSubPci, []byte{function, device})
+}
+
+// NVMeNode returns the NVMe(namespace,eui64) node of an NVMe namespace.
+func NVMeNode(namespace uint32, eui64 [8]byte) DevicePath {
+	data := binary.LittleEndian.AppendUint32(nil, namespace)
+	return devicePathNode(devicePathMessaging, devicePathSubNVMe, append(data, eui64[:]...))
+}
+
+// ScsiNode returns the Scsi(target,lun) node of a SCSI logical unit.
+func ScsiNode(target, lun uint16) DevicePath {
+	data := binary.LittleEndian.AppendUint16(nil, target)
+	return devicePathNode(devicePathMessaging, devicePathSubScsi, binary.LittleEndian.AppendUint16(data, lun))
+}
+
+// HardDriveNode returns the HD(partition,GPT,signature,start,size) node of a GPT partition.
+func HardDriveNode(partition uint32, signature string, start, size uint64) (DevicePath, error) {
+	guid, err := parseGUID(signature)
+	if err != nil {
+		return nil, err
+	}
+	data := binary.LittleEndian.AppendUint32(nil, partition)
+	data = binary.LittleEndian.AppendUint64(data, start)
+	data = binary.LittleEndian.AppendUint64(data, size)
+	data = append(data, guid...)
+	data = append(data, hardDriveMBRTypeGPT, hardDriveSignatureGUID)
+	return devicePathNode(devicePathMedia, devicePathSubHardDrive, data), nil
+}
+
+// FileNode returns the File(path) node of a file path, e.g. \EFI\BOOT\BOOTX64.EFI.
+func FileNode(path string) DevicePath {
+	return devicePathNode(devicePathMedia, devicePathSubFilePath, encodeUTF16String(path))
+}
+
+// FvNode returns the Fv(guid) node of a firmware volume.
+func FvNode(guid string) (DevicePath, error) {
+	data, err := parseGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	return devicePathNode(devicePathMedia, devicePathSubFv, data), nil
+}
+
+// FvFileNode returns the FvFile(guid) node of a file in a firmware volume.
+func FvFileNode(guid string) (DevicePath, error) {
+	data, err := parseGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	return devicePathNode(devicePathMedia, devicePathSubFvFile, data), nil
+}
+
+// EndDevicePath returns the node terminating a device path.
+func EndDevicePath() DevicePath {
+	return devicePathNode(devicePathEnd, devicePathSubEndEntire, nil)
+}
+
+// NewDevicePath concatenates nodes into a terminated device path.
+func NewDevicePath(nodes ...DevicePath) DevicePath {
+	var path DevicePath
+	for _, n := range nodes {
+		path = append(path, n...)
+	}
+	return append(path, EndDevicePath()...)
+}
+
+// encodeUTF16String encodes a NUL-terminated UTF-16LE string.
+func encodeUTF16String(s string) []byte {
+	var out []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, c)
+	}
+	return append(out, 0x00, 0x00)
+}
+
+// parseGUID validates a textual GUID and encodes it into binary form.
+func parseGUID(guid string) ([]byte, error) {
+	atoms := strings.Split(guid, "-")
+	if len(atoms) != 5 {
+		return nil, fmt.Errorf("invalid GUID %q", guid)
+	}
+	for i, atom := range atoms {
+		if _, err := hex.DecodeString(atom); err != nil || len(atom) != []int{8, 4, 4, 4, 12}[i] {
+			return nil, fmt.Errorf("invalid GUID %q", guid)
+		}
+	}
+	return encodeGUID(guid), nil
+}
+
+// ParseDevicePath parses the text representation of a device path, as printed by the UEFI
+// shell or efibootmgr, e.g. PciRoot(0x0)/Pci(0x4,0x0)/NVMe(0x1,00-00-00-00-00-00-00-00). The
+// supported nodes are PciRoot, Pci, NVMe, Scsi, HD (GPT only), Fv, FvFile and file paths, given
+// either as File(path) or as a bare path starting with a backslash.
+func ParseDevicePath(text string) (DevicePath, error) {
+	var nodes []DevicePath
+	for _, elem := range splitDevicePath(text) {
+		node, err := parseDevicePathNode(elem)
+		if err != nil {
+			return nil, fmt.Errorf("device path %q: %w", text, err)
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("device path %q: no nodes", text)
+	}
+	return NewDevicePath(nodes...), nil
+}
+
+// splitDevicePath splits a device path into its nodes. A bare file path is kept as one node,
+// since it contains no slashes.
+func splitDevicePath(text string) []string {
+	var elems []string
+	depth, start := 0, 0
+	for i, c := range text {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '/':
+			if depth == 0 {
+				elems = append(elems, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if text[start:] != "" {
+		elems = append(elems, text[start:])
+	}
+	return elems
+}
+
+func parseDevicePathNode(elem string) (DevicePath, error) {
+	if strings.HasPrefix(elem, `\`) {
+		return FileNode(elem), nil
+	}
+	open := strings.IndexByte(elem, '(')
+	if open < 0 || !strings.HasSuffix(elem, ")") {
+		return nil, fmt.Errorf("invalid node %q", elem)
+	}
+	name := elem[:open]
+	var args []string
+	if inner := elem[open+1 : len(elem)-1]; inner != "" {
+		args = strings.Split(inner, ",")
+	}
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	// Trailing arguments are optional in the text representation and default to zero.
+	arg := func(i int, bits int) (uint64, error) {
+		if i >= len(args) {
+			return 0, nil
+		}
+		v, err := strconv.ParseUint(args[i], 0, bits)
+		if err != nil {
+			return 0, fmt.Errorf("%s: invalid argument %q", name, args[i])
+		}
+		return v, nil
+	}
+	wantArgs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return fmt.Errorf("%s: expected %d to %d arguments, got %d", name, min, max, len(args))
+		}
+		return nil
+	}
+
+	switch name {
+	case "PciRoot":
+		if err := wantArgs(0, 1); err != nil {
+			return nil, err
+		}
+		uid, err := arg(0, 32)
+		if err != nil {
+			return nil, err
+		}
+		return PciRootNode(uint32(uid)), nil
+	case "Pci":
+		if err := wantArgs(1, 2); err != nil {
+			return nil, err
+		}
+		dev, err := arg(0, 8)
+		if err != nil {
+			return nil, err
+		}
+		fn, err := arg(1, 8)
+		if err != nil {
+			return nil, err
+		}
+		return PciNode(uint8(dev), uint8(fn)), nil
+	case "NVMe":
+		if err := wantArgs(1, 2); err != nil {
+			return nil, err
+		}
+		ns, err := arg(0, 32)
+		if err != nil {
+			return nil, err
+		}
+		var eui [8]byte
+		if len(args) > 1 {
+			b, err := hex.DecodeString(strings.ReplaceAll(args[1], "-", ""))
+			if err != nil || len(b) != len(eui) {
+				return nil, fmt.Errorf("NVMe: invalid EUI-64 %q", args[1])
+			}
+			copy(eui[:], b)
+		}
+		return NVMeNode(uint32(ns), eui), nil
+	case "Scsi":
+		if err := wantArgs(1, 2); err != nil {
+			return nil, err
+		}
+		target, err := arg(0, 16)
+		if err != nil {
+			return nil, err
+		}
+		lun, err := arg(1, 16)
+		if err != nil {
+			return nil, err
+		}
+		return ScsiNode(uint16(target), uint16(lun)), nil
+	case "HD":
+		if err := wantArgs(5, 5); err != nil {
+			return nil, err
+		}
+		if args[1] != "GPT" {
+			return nil, fmt.Errorf("HD: unsupported partition format %q", args[1])
+		}
+		partition, err := arg(0, 32)
+		if err != nil {
+			return nil, err
+		}
+		start, err := arg(3, 64)
+		if err != nil {
+			return nil, err
+		}
+		size, err := arg(4, 64)
+		if err != nil {
+			return nil, err
+		}
+		return HardDriveNode(uint32(partition), strings.ToLower(args[2]), start, size)
+	case "File":
+		return FileNode(elem[open+1 : len(elem)-1]), nil
+	case "Fv":
+		if err := wantArgs(1, 1); err != nil {
+			return nil, err
+		}
+		return FvNode(strings.ToLower(args[0]))
+	case "FvFile":
+		if err := wantArgs(1, 1); err != nil {
+			return nil, err
+		}
+		return FvFileNode(strings.ToLower(args[0]))
+	default:
+		return nil, fmt.Errorf("unsupported node %q", name)
+	}
+}
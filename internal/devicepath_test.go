@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseDevicePath(t *testing.T) {
+	const end = "7fff0400"
+	tests := []struct {
+		text string
+		want string
+	}{
+		{
+			text: "PciRoot(0x0)/Pci(0x4,0x0)/NVMe(0x1,00-00-00-00-00-00-00-00)",
+			want: "02010c00" + "d041030a" + "00000000" +
+				"01010600" + "0004" +
+				"03171000" + "01000000" + "0000000000000000" + end,
+		},
+		{
+			text: "PciRoot(0x0)/Pci(0x3,0x0)/Scsi(0x1,0x0)",
+			want: "02010c00d041030a00000000" + "010106000003" + "030208000100" + "0000" + end,
+		},
+		{
+			// Omitted trailing arguments default to zero.
+			text: "PciRoot()/Pci(0x5)/NVMe(2)",
+			want: "02010c00d041030a00000000" + "010106000005" + "031710000200000000000000" + "00000000" + end,
+		},
+		{
+			text: `HD(1,GPT,2A0B7E7C-5F3D-4E65-9B7A-0E2C4C5D6E7F,0x800,0x32000)/\EFI\BOOT\BOOTX64.EFI`,
+			want: "04012a00" + "01000000" + "0008000000000000" + "0020030000000000" +
+				"7c7e0b2a3d5f654e9b7a0e2c4c5d6e7f" + "0202" +
+				"04043000" + hex.EncodeToString(encodeUTF16String(`\EFI\BOOT\BOOTX64.EFI`)) + end,
+		},
+		{
+			text: `File(\EFI\Linux\dstack.efi)`,
+			want: "04043000" + hex.EncodeToString(encodeUTF16String(`\EFI\Linux\dstack.efi`)) + end,
+		},
+		{
+			text: "Fv(7CB8BDC9-F8EB-4F34-AAEA-3EE4AF6516A1)/FvFile(462caa21-7614-4503-836e-8ab6f4662331)",
+			want: "04071400c9bdb87cebf8344faaea3ee4af6516a1" + "0406140021aa2c4614760345836e8ab6f4662331" + end,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			path, err := ParseDevicePath(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(path); got != tt.want {
+				t.Errorf("ParseDevicePath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDevicePathMalformed(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "", want: "no nodes"},
+		{text: "PciRoot(0x0)/Usb(0x1,0x0)", want: `unsupported node "Usb"`},
+		{text: "PciRoot(0x0", want: "invalid node"},
+		{text: "Pci(0x100,0x0)", want: "invalid argument"},
+		{text: "Pci(0x1,0x0,0x0)", want: "expected 1 to 2 arguments"},
+		{text: "NVMe(0x1,00-00)", want: "invalid EUI-64"},
+		{text: "HD(1,MBR,0x1234,0x800,0x1000)", want: "unsupported partition format"},
+		{text: "HD(1,GPT,not-a-guid,0x800,0x1000)", want: "invalid GUID"},
+		{text: "Fv(7cb8bdc9-f8eb-4f34-aaea-3ee4af6516)", want: "invalid GUID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := ParseDevicePath(tt.text)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseDevicePath() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
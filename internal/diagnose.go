@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Divergence describes an event where an observed log departs from the expected one.
+type Divergence struct {
+	// Index is the position of the event in the register's log (EV_NO_ACTION events excluded).
+	Index    int
+	Expected *Event
+	Observed *CcelEvent
+	// Reason names what differs, Hint suggests which catalog entry is missing.
+	Reason string
+	Hint   string
+}
+
+// Diagnosis is the result of aligning an observed register log with the expected one.
+type Diagnosis struct {
+	Register int
+	// Variant is the best matching RTMR0 variant; nil for other registers.
+	Variant *RTMR0Variant
+	// Matched is the number of leading events that match.
+	Matched     int
+	Divergences []Divergence
+}
+
+// Match reports whether the observed log matches the expected one event by event.
+func (d *Diagnosis) Match() bool {
+	return len(d.Divergences) == 0
+}
+
+// registerEvents returns the observed events extended into the given RTMR.
+func registerEvents(events []CcelEvent, rtmr int) []CcelEvent {
+	var out []CcelEvent
+	for _, e := range events {
+		if e.EventType != EvNoAction && e.RTMR() == rtmr {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// DiagnoseLog aligns the observed events of one RTMR with the expected log.
+func DiagnoseLog(rtmr int, log *EventLog, events []CcelEvent) Diagnosis {
+	expected := log.Events
+	observed := registerEvents(events, rtmr)
+	d := Diagnosis{Register: rtmr, Matched: -1}
+
+	for i := range max(len(expected), len(observed)) {
+		var exp *Event
+		var obs *CcelEvent
+		if i < len(expected) {
+			exp = &expected[i]
+		}
+		if i < len(observed) {
+			obs = &observed[i]
+		}
+		if exp != nil && obs != nil && bytes.Equal(exp.Digest, obs.Digest) {
+			continue
+		}
+		if d.Matched < 0 {
+			d.Matched = i
+		}
+		d.Divergences = append(d.Divergences, explainDivergence(i, exp, obs))
+	}
+	if d.Matched < 0 {
+		d.Matched = len(expected)
+	}
+	return d
+}
+
+// DiagnoseRTMR0 aligns the observed RTMR0 events with every expected variant and returns the
+// diagnosis for the closest one: the longest matching prefix, then the fewest differing events.
+// It fails without variants, as there is nothing to compare the events with.
+func DiagnoseRTMR0(variants []RTMR0Variant, events []CcelEvent) (Diagnosis, error) {
+	if len(variants) == 0 {
+		return Diagnosis{}, fmt.Errorf("no expected RTMR0 variants to diagnose the event log against")
+	}
+	var best Diagnosis
+	for i := range variants {
+		d := DiagnoseLog(0, variants[i].Log, events)
+		d.Variant = &variants[i]
+		if i == 0 || d.Matched > best.Matched || (d.Matched == best.Matched && len(d.Divergences) < len(best.Divergences)) {
+			best = d
+		}
+	}
+	for i := range best.Divergences {
+		best.Divergences[i].Hint = strings.ReplaceAll(best.Divergences[i].Hint, "<config>", best.Variant.Configuration)
+	}
+	best.addAcpiHint(events)
+	return best, nil
+}
+
+// addAcpiHint lists the observed ACPI digests when an ACPI event diverges, as they make up the
+// catalog entry for a new epoch.
+func (d *Diagnosis) addAcpiHint(events []CcelEvent) {
+	observed := registerEvents(events, 0)
+	var digests []string
+	for i, e := range d.Variant.Log.Events {
+		if strings.HasPrefix(e.Description, "ACPI ") && i < len(observed) {
+			digests = append(digests, fmt.Sprintf("%s=%X", e.Description, observed[i].Digest))
+		}
+	}
+	for i := range d.Divergences {
+		if exp := d.Divergences[i].Expected; exp != nil && strings.HasPrefix(exp.Description, "ACPI ") && len(digests) > 0 {
+			d.Divergences[i].Hint += "; observed " + strings.Join(digests, ", ")
+		}
+	}
+}
+
+// explainDivergence names a differing event and suggests the catalog entry it points at.
+func explainDivergence(index int, exp *Event, obs *CcelEvent) Divergence {
+	div := Divergence{Index: index, Expected: exp, Observed: obs}
+	switch {
+	case exp == nil:
+		div.Reason = fmt.Sprintf("unexpected extra event %s %q", EventTypeName(obs.EventType), obs.Description())
+		div.Hint = "the guest logs events this tool does not model"
+		return div
+	case obs == nil:
+		div.Reason = fmt.Sprintf("%s event missing", exp.Description)
+		div.Hint = "the observed log ends early"
+		return div
+	case exp.Type != obs.EventType:
+		div.Reason = fmt.Sprintf("%s expected but got %s %q: unexpected event structure", exp.Description, EventTypeName(obs.EventType), obs.Description())
+		div.Hint = "the event order differs from the catalog; compare with the explain output"
+		return div
+	}
+
+	switch name := exp.Description; {
+	case name == "TD HOB":
+		div.Reason = "TD HOB hash differs: memory size or layout not in catalog"
+		div.Hint = "record the VM's machine configuration with catalog ingest, or fix the TD HOB hash of <config> in the catalog"
+	case name == "CFV":
+		div.Reason = "CFV hash differs: unknown firmware"
+		div.Hint = "add the firmware to the catalog"
+	case name == "SecureBoot" || name == "PK" || name == "KEK" || name == "db" || name == "dbx":
+		div.Reason = fmt.Sprintf("%s differs: Secure Boot configuration not in catalog", name)
+		div.Hint = "the VM uses custom Shielded VM Secure Boot keys or a new default; update the Secure Boot hashes in the catalog"
+	case strings.HasPrefix(name, "ACPI "):
+		div.Reason = fmt.Sprintf("%s hash differs: unknown epoch", name)
+		div.Hint = "add an ACPI hash set for the new firmware epoch to <config> in the catalog"
+	case name == "BootOrder":
+		div.Reason = "BootOrder differs"
+		div.Hint = "the VM has a different boot option layout (e.g. disk interface or extra disks); pass -boot-disk and -data-disks, or -boot-options"
+	case strings.HasPrefix(name, "Boot"):
+		div.Reason = fmt.Sprintf("%s differs", name)
+		div.Hint = "add a boot variant with the observed boot option digests to the catalog, or describe the boot options with -boot-options"
+	case name == "UEFI_GPT_DATA":
+		div.Reason = "UEFI_GPT_DATA differs: disk layout differs from the image"
+		div.Hint = "the boot disk was not built from this UKI or was resized"
+	case name == "UKI" || name == "kernel":
+		div.Reason = fmt.Sprintf("%s authenticode hash differs", name)
+		div.Hint = "the VM booted a different image"
+	case name == "kernel cmdline" || name == "initrd":
+		div.Reason = fmt.Sprintf("%s differs", name)
+		div.Hint = "the VM booted a different image"
+	default:
+		div.Reason = fmt.Sprintf("%s differs", name)
+	}
+	return div
+}
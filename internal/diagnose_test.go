@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// testEvent returns an expected event whose digest is the hash of its description.
+func testEvent(register int, eventType uint32, description string) Event {
+	return Event{Register: register, Type: eventType, Description: description, Digest: measureSha384([]byte(description))}
+}
+
+// testEventLog extends a new event log with the events.
+func testEventLog(t *testing.T, events []Event) *EventLog {
+	t.Helper()
+	log := NewEventLog()
+	for _, e := range events {
+		if err := log.Extend(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return log
+}
+
+// observe returns the events as they would appear in the CC event log.
+func observe(events []Event) []CcelEvent {
+	var out []CcelEvent
+	for i, e := range events {
+		if i == 0 {
+			out = append(out, CcelEvent{MrIndex: uint32(e.Register + 1), EventType: EvNoAction, Digest: make([]byte, 48)})
+		}
+		out = append(out, CcelEvent{MrIndex: uint32(e.Register + 1), EventType: e.Type, Digest: e.Digest})
+	}
+	return out
+}
+
+func TestDiagnoseLog(t *testing.T) {
+	expected := []Event{
+		testEvent(2, EvEfiVariableBoot, "BootOrder"),
+		testEvent(2, EvEfiVariableBoot, "Boot0000"),
+		testEvent(2, EvSeparator, "separator"),
+	}
+	tests := []struct {
+		name        string
+		observed    []Event
+		wantMatched int
+		wantReasons []string
+	}{
+		{name: "match", observed: expected, wantMatched: 3},
+		{
+			name:        "different digest",
+			observed:    []Event{expected[0], testEvent(2, EvEfiVariableBoot, "Boot0001"), expected[2]},
+			wantMatched: 1,
+			wantReasons: []string{"Boot0000 differs"},
+		},
+		{
+			name:        "different structure",
+			observed:    []Event{expected[0], testEvent(2, EvEfiAction, "action"), expected[2]},
+			wantMatched: 1,
+			wantReasons: []string{"unexpected event structure"},
+		},
+		{
+			name:        "missing event",
+			observed:    expected[:2],
+			wantMatched: 2,
+			wantReasons: []string{"separator event missing"},
+		},
+		{
+			name:        "extra event",
+			observed:    append(expected[:3:3], testEvent(2, EvEfiAction, "extra")),
+			wantMatched: 3,
+			wantReasons: []string{"unexpected extra event EV_EFI_ACTION"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Events of other registers are ignored.
+			events := append(observe(tt.observed), observe([]Event{testEvent(1, EvSeparator, "other")})...)
+			d := DiagnoseLog(2, testEventLog(t, expected), events)
+			if d.Register != 2 || d.Matched != tt.wantMatched {
+				t.Errorf("DiagnoseLog() register %d matched %d, want 2 and %d", d.Register, d.Matched, tt.wantMatched)
+			}
+			if d.Match() != (len(tt.wantReasons) == 0) {
+				t.Errorf("Match() = %v with divergences %+v", d.Match(), d.Divergences)
+			}
+			if len(d.Divergences) != len(tt.wantReasons) {
+				t.Fatalf("got %d divergences, want %d: %+v", len(d.Divergences), len(tt.wantReasons), d.Divergences)
+			}
+			for i, want := range tt.wantReasons {
+				if !strings.Contains(d.Divergences[i].Reason, want) {
+					t.Errorf("divergence %d reason = %q, want %q", i, d.Divergences[i].Reason, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnoseRTMR0(t *testing.T) {
+	epoch := func(name string) []Event {
+		events := []Event{
+			testEvent(0, EvEfiHandoffTables2, "TD HOB"),
+			testEvent(0, EvEfiPlatformFirmwareBlob2, "CFV"),
+			testEvent(0, EvPostCode, "ACPI loader"),
+			testEvent(0, EvPostCode, "ACPI RSDP"),
+			testEvent(0, EvSeparator, "separator"),
+		}
+		events[2].Digest = measureSha384([]byte(name))
+		return events
+	}
+	variants := []RTMR0Variant{
+		{Configuration: "c3-standard-4", AcpiEpoch: "old", Log: testEventLog(t, epoch("old"))},
+		{Configuration: "c3-standard-4", AcpiEpoch: "new", Log: testEventLog(t, epoch("new"))},
+	}
+	diagnose := func(t *testing.T, variants []RTMR0Variant, observed []Event) Diagnosis {
+		t.Helper()
+		d, err := DiagnoseRTMR0(variants, observe(observed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	t.Run("match", func(t *testing.T) {
+		d := diagnose(t, variants, epoch("new"))
+		if !d.Match() || d.Variant != &variants[1] {
+			t.Errorf("DiagnoseRTMR0() = %+v, want a match of the second variant", d)
+		}
+	})
+
+	t.Run("unknown epoch", func(t *testing.T) {
+		d := diagnose(t, variants, epoch("unknown"))
+		if d.Match() || d.Matched != 2 || len(d.Divergences) != 1 {
+			t.Fatalf("DiagnoseRTMR0() = %+v, want one divergence after 2 events", d)
+		}
+		div := d.Divergences[0]
+		if !strings.Contains(div.Reason, "ACPI loader hash differs: unknown epoch") {
+			t.Errorf("reason = %q", div.Reason)
+		}
+		// The hint names the configuration and lists the observed digests for a new catalog entry.
+		for _, want := range []string{"c3-standard-4", "ACPI loader=", "ACPI RSDP="} {
+			if !strings.Contains(div.Hint, want) {
+				t.Errorf("hint = %q, want %q", div.Hint, want)
+			}
+		}
+	})
+
+	t.Run("closest variant", func(t *testing.T) {
+		// The second variant matches further into the log, so it is the one diagnosed.
+		observed := epoch("new")
+		observed[4] = testEvent(0, EvSeparator, "error")
+		d := diagnose(t, variants, observed)
+		if d.Variant != &variants[1] || d.Matched != 4 {
+			t.Errorf("DiagnoseRTMR0() variant %+v matched %d, want the second variant matching 4", d.Variant, d.Matched)
+		}
+	})
+
+	t.Run("fewest divergences", func(t *testing.T) {
+		// Both variants match two events; the one with fewer divergences after them is diagnosed.
+		extra := append(epoch("extra"), testEvent(0, EvEfiAction, "extra"))
+		variants := []RTMR0Variant{
+			{Configuration: "c3-standard-22", AcpiEpoch: "extra", Log: testEventLog(t, extra)},
+			{Configuration: "c3-standard-4", AcpiEpoch: "old", Log: testEventLog(t, epoch("old"))},
+		}
+		d := diagnose(t, variants, epoch("unknown"))
+		if d.Variant != &variants[1] || d.Matched != 2 || len(d.Divergences) != 1 {
+			t.Errorf("DiagnoseRTMR0() = %+v, want the second variant with one divergence", d)
+		}
+	})
+
+	t.Run("several divergences", func(t *testing.T) {
+		observed := epoch("new")[:4]
+		observed[0] = testEvent(0, EvEfiHandoffTables2, "other TD HOB")
+		d := diagnose(t, variants, observed)
+		if d.Matched != 0 {
+			t.Errorf("Matched = %d, want 0", d.Matched)
+		}
+		want := []struct {
+			index        int
+			reason, hint string
+		}{
+			{0, "TD HOB hash differs", "TD HOB hash of c3-standard-4"},
+			{4, "separator event missing", "the observed log ends early"},
+		}
+		if len(d.Divergences) != len(want) {
+			t.Fatalf("divergences = %+v, want %d", d.Divergences, len(want))
+		}
+		for i, w := range want {
+			div := d.Divergences[i]
+			if div.Index != w.index || !strings.Contains(div.Reason, w.reason) || !strings.Contains(div.Hint, w.hint) {
+				t.Errorf("divergence %d = %d %q (%q), want %d %q (%q)", i, div.Index, div.Reason, div.Hint, w.index, w.reason, w.hint)
+			}
+		}
+	})
+
+	t.Run("no variants", func(t *testing.T) {
+		if _, err := DiagnoseRTMR0(nil, observe(epoch("new"))); err == nil || !strings.Contains(err.Error(), "no expected RTMR0 variants") {
+			t.Errorf("DiagnoseRTMR0(nil) error = %v, want no expected RTMR0 variants", err)
+		}
+	})
+}
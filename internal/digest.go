@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// measureDigest computes the digest of data with the given hash algorithm.
+func measureDigest(alg crypto.Hash, data []byte) []byte {
+	h := alg.New()
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+// extendDigest returns the value of a register of the given algorithm's bank after extending it
+// with a digest.
+func extendDigest(alg crypto.Hash, value []byte, digest []byte) []byte {
+	h := alg.New()
+	_, _ = h.Write(value)
+	_, _ = h.Write(digest)
+	return h.Sum(nil)
+}
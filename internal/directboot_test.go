@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// testPE returns a PE32+ image without sections, padded to size bytes.
+func testPE(size int) []byte {
+	const (
+		peOffset      = 0x40
+		optHeaderSize = 112 + 16*8
+		headersSize   = 0x200
+	)
+	pe := make([]byte, size)
+	copy(pe, "MZ")
+	binary.LittleEndian.PutUint32(pe[0x3c:], peOffset)
+	copy(pe[peOffset:], "PE\x00\x00")
+	file := pe[peOffset+4:]
+	binary.LittleEndian.PutUint16(file[0:], 0x8664) // Machine: x86-64
+	binary.LittleEndian.PutUint16(file[16:], optHeaderSize)
+	binary.LittleEndian.PutUint16(file[18:], 0x22) // Characteristics: executable, large address aware
+	opt := file[20:]
+	binary.LittleEndian.PutUint16(opt[0:], 0x20b) // PE32+
+	binary.LittleEndian.PutUint32(opt[32:], 0x1000)
+	binary.LittleEndian.PutUint32(opt[36:], 0x200)
+	binary.LittleEndian.PutUint32(opt[56:], headersSize)
+	binary.LittleEndian.PutUint32(opt[60:], headersSize)
+	binary.LittleEndian.PutUint16(opt[68:], 10) // Subsystem: EFI application
+	binary.LittleEndian.PutUint32(opt[108:], 16)
+	return pe
+}
+
+func TestExpectedDirectBootRTMR1And2Logs(t *testing.T) {
+	kernel := testPE(0x1000)
+	initrd := []byte("initrd")
+	rtmr1, rtmr2, err := ExpectedDirectBootRTMR1And2Logs(kernel, initrd, "console=ttyS0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var descriptions []string
+	for _, e := range rtmr1.Events {
+		descriptions = append(descriptions, e.Description)
+	}
+	want := []string{
+		"Calling EFI Application from Boot Option",
+		"separator",
+		"UEFI_GPT_DATA",
+		"kernel",
+		"Exit Boot Services Invocation",
+		"Exit Boot Services Returned with Success",
+	}
+	if !slices.Equal(descriptions, want) {
+		t.Errorf("RTMR1 events = %q, want %q", descriptions, want)
+	}
+
+	descriptions = nil
+	for _, e := range rtmr2.Events {
+		descriptions = append(descriptions, e.Description)
+	}
+	if want := []string{"kernel cmdline", "initrd"}; !slices.Equal(descriptions, want) {
+		t.Errorf("RTMR2 events = %q, want %q", descriptions, want)
+	}
+
+	gotRTMR1, gotRTMR2, err := MeasureDirectBootRTMR1And2(kernel, initrd, "console=ttyS0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotRTMR1, rtmr1.RTMR(1)) || !bytes.Equal(gotRTMR2, rtmr2.RTMR(2)) {
+		t.Error("MeasureDirectBootRTMR1And2 differs from the replayed logs")
+	}
+
+	if _, _, err := ExpectedDirectBootRTMR1And2Logs([]byte("not a PE"), initrd, ""); err == nil {
+		t.Error("ExpectedDirectBootRTMR1And2Logs accepted a kernel that is not a PE image")
+	}
+}
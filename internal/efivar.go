@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+)
+
+// Vendor GUIDs of the Secure Boot variables.
+const (
+	EfiGlobalVariableGuid        = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	EfiImageSecurityDatabaseGuid = "d719b2cb-3d3a-4596-a3bc-dad00e67656f"
+)
+
+const (
+	efiCertX509Guid      = "a5c059a1-94e4-4aa7-87b5-ab155c2bf072"
+	efiCertTypePkcs7Guid = "4aafd29d-68df-49ee-8aa9-347d375665a7"
+
+	efiSignatureListHeaderSize = 28
+	efiTimeSize                = 16
+	winCertificateHeaderSize   = 8
+	winCertTypeEfiGuid         = 0x0EF1
+)
+
+// SecureBootVariables holds the data of the Secure Boot variables measured into RTMR0. A nil
+// key database is measured as an absent variable.
+type SecureBootVariables struct {
+	// Enabled is the value of the SecureBoot variable.
+	Enabled bool
+	// PK, KEK, DB and DBX hold EFI_SIGNATURE_LISTs.
+	PK  []byte
+	KEK []byte
+	DB  []byte
+	DBX []byte
+}
+
+// Hashes returns the digests of the EV_EFI_VARIABLE_DRIVER_CONFIG events of the variables.
+func (v *SecureBootVariables) Hashes() SecureBootHashes {
+	enabled := []byte{0x00}
+	if v.Enabled {
+		enabled = []byte{0x01}
+	}
+	h := SecureBootHashes{data: map[string][]byte{
+		"SecureBoot": efiVariableData(EfiGlobalVariableGuid, "SecureBoot", enabled),
+		"PK":         efiVariableData(EfiGlobalVariableGuid, "PK", v.PK),
+		"KEK":        efiVariableData(EfiGlobalVariableGuid, "KEK", v.KEK),
+		"db":         efiVariableData(EfiImageSecurityDatabaseGuid, "db", v.DB),
+		"dbx":        efiVariableData(EfiImageSecurityDatabaseGuid, "dbx", v.DBX),
+	}}
+	for _, name := range secureBootVariableNames {
+		*h.digest(name) = measureSha384(h.data[name])
+	}
+	return h
+}
+
+// validateSignatureLists checks that data is a sequence of well-formed EFI_SIGNATURE_LISTs.
+func validateSignatureLists(data []byte) error {
+	for off := 0; off < len(data); {
+		if len(data)-off < efiSignatureListHeaderSize {
+			return fmt.Errorf("signature list: truncated header at offset %d", off)
+		}
+		listSize := int(binary.LittleEndian.Uint32(data[off+16:]))
+		headerSize := int(binary.LittleEndian.Uint32(data[off+20:]))
+		sigSize := int(binary.LittleEndian.Uint32(data[off+24:]))
+		if listSize > len(data)-off || listSize < efiSignatureListHeaderSize+headerSize {
+			return fmt.Errorf("signature list: invalid size %d at offset %d", listSize, off)
+		}
+		if sigSize < 16 || (listSize-efiSignatureListHeaderSize-headerSize)%sigSize != 0 {
+			return fmt.Errorf("signature list: invalid signature size %d at offset %d", sigSize, off)
+		}
+		off += listSize
+	}
+	return nil
+}
+
+// X509SignatureList wraps a DER-encoded certificate into an EFI_SIGNATURE_LIST owned by owner.
+func X509SignatureList(owner string, der []byte) ([]byte, error) {
+	ownerGUID, err := parseGUID(owner)
+	if err != nil {
+		return nil, fmt.Errorf("signature owner: %w", err)
+	}
+	sigSize := 16 + len(der)
+	out := encodeGUID(efiCertX509Guid)
+	out = binary.LittleEndian.AppendUint32(out, uint32(efiSignatureListHeaderSize+sigSize))
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	out = binary.LittleEndian.AppendUint32(out, uint32(sigSize))
+	out = append(out, ownerGUID...)
+	return append(out, der...), nil
+}
+
+// authVariablePayload returns the variable data of an EFI_VARIABLE_AUTHENTICATION_2 file, as
+// produced by sign-efi-sig-list, or false if data is not one.
+func authVariablePayload(data []byte) ([]byte, bool) {
+	if len(data) < efiTimeSize+winCertificateHeaderSize+16 {
+		return nil, false
+	}
+	cert := data[efiTimeSize:]
+	length := int(binary.LittleEndian.Uint32(cert))
+	certType := binary.LittleEndian.Uint16(cert[6:])
+	if certType != winCertTypeEfiGuid || !bytes.Equal(cert[8:24], encodeGUID(efiCertTypePkcs7Guid)) {
+		return nil, false
+	}
+	if length < winCertificateHeaderSize+16 || length > len(cert) {
+		return nil, false
+	}
+	return cert[length:], true
+}
+
+// ParseSignatureDatabase converts a key database file into the EFI_SIGNATURE_LISTs stored in the
+// variable. It accepts authenticated variable (.auth) files, raw signature lists (.esl), and DER
+// or PEM certificates, which are wrapped into a list owned by owner. The owner must be a valid GUID
+// even when no certificate is wrapped.
+func ParseSignatureDatabase(data []byte, owner string) ([]byte, error) {
+	if _, err := parseGUID(owner); err != nil {
+		return nil, fmt.Errorf("signature owner: %w", err)
+	}
+	if payload, ok := authVariablePayload(data); ok {
+		if err := validateSignatureLists(payload); err != nil {
+			return nil, fmt.Errorf("authenticated variable: %w", err)
+		}
+		return payload, nil
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		return X509SignatureList(owner, block.Bytes)
+	}
+	// A DER certificate starts with a SEQUENCE; a signature list with a GUID.
+	if len(data) > 0 && data[0] == 0x30 && validateSignatureLists(data) != nil {
+		return X509SignatureList(owner, data)
+	}
+	if err := validateSignatureLists(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
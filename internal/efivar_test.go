@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+const testOwner = "77fa9abd-0359-4d32-bd60-28f4e78f784b"
+
+func TestSecureBootVariablesHashes(t *testing.T) {
+	// GCE boots with Secure Boot disabled, which the catalog captured.
+	const disabled = "cfa4e2c606f572627bf06d5669cc2ab1128358d27b45bc63ee9ea56ec109cfafb7194006f847a6a74b5eaed6b73332ec"
+	hashes := (&SecureBootVariables{}).Hashes()
+	if got := hex.EncodeToString(hashes.SecureBoot); got != disabled {
+		t.Errorf("SecureBoot = %s, want %s", got, disabled)
+	}
+	if enabled := (&SecureBootVariables{Enabled: true}).Hashes(); bytes.Equal(enabled.SecureBoot, hashes.SecureBoot) {
+		t.Error("enabling Secure Boot does not change its hash")
+	}
+	// db and dbx belong to the image security database, PK and KEK to the global variables.
+	if bytes.Equal(hashes.PK, hashes.DB) || bytes.Equal(hashes.KEK, hashes.DBX) {
+		t.Error("absent variables of different names or vendors hash the same")
+	}
+}
+
+func TestX509SignatureList(t *testing.T) {
+	der := []byte{0x30, 0x03, 0x02, 0x01, 0x00}
+	list, err := X509SignatureList(testOwner, der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSignatureLists(list); err != nil {
+		t.Fatal(err)
+	}
+	want := encodeGUID(efiCertX509Guid)
+	want = binary.LittleEndian.AppendUint32(want, uint32(efiSignatureListHeaderSize+16+len(der)))
+	want = binary.LittleEndian.AppendUint32(want, 0)
+	want = binary.LittleEndian.AppendUint32(want, uint32(16+len(der)))
+	want = append(want, encodeGUID(testOwner)...)
+	want = append(want, der...)
+	if !bytes.Equal(list, want) {
+		t.Errorf("X509SignatureList() = %x, want %x", list, want)
+	}
+
+	for _, owner := range []string{"", "owner", "77fa9abd-0359-4d32-bd60-28f4e78f784", "77fa9abd0-359-4d32-bd60-28f4e78f784b", "77fa9abd-0359-4d32-bd60-28f4e78f784g"} {
+		if _, err := X509SignatureList(owner, der); err == nil || !strings.Contains(err.Error(), "signature owner: invalid GUID") {
+			t.Errorf("X509SignatureList(%q) error = %v, want an invalid owner", owner, err)
+		}
+	}
+}
+
+func TestParseSignatureDatabase(t *testing.T) {
+	der := []byte{0x30, 0x03, 0x02, 0x01, 0x00}
+	esl, err := X509SignatureList(testOwner, der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An EFI_VARIABLE_AUTHENTICATION_2 header: EFI_TIME then a WIN_CERTIFICATE_UEFI_GUID with an
+	// empty PKCS#7 signature.
+	auth := make([]byte, efiTimeSize)
+	auth = binary.LittleEndian.AppendUint32(auth, winCertificateHeaderSize+16+4)
+	auth = binary.LittleEndian.AppendUint16(auth, 0x0200)
+	auth = binary.LittleEndian.AppendUint16(auth, winCertTypeEfiGuid)
+	auth = append(auth, encodeGUID(efiCertTypePkcs7Guid)...)
+	auth = append(auth, 0xde, 0xad, 0xbe, 0xef)
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	tests := []struct {
+		name  string
+		data  []byte
+		owner string
+		want  []byte
+		err   string
+	}{
+		{name: "signature list", data: esl, want: esl},
+		{name: "two signature lists", data: append(esl, esl...), want: append(esl, esl...)},
+		{name: "auth", data: append(auth, esl...), want: esl},
+		{name: "DER", data: der, want: esl},
+		{name: "PEM", data: pemCert, want: esl},
+		{name: "empty", data: nil, want: nil},
+		{name: "PEM key", data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), err: `unexpected PEM block "PRIVATE KEY"`},
+		{name: "truncated list", data: esl[:20], err: "truncated header"},
+		{name: "bad list size", data: esl[:len(esl)-1], err: "invalid size"},
+		{name: "bad auth payload", data: append(auth, esl[:20]...), err: "authenticated variable: signature list: truncated header"},
+		{name: "DER with invalid owner", data: der, owner: "not-a-guid", err: `signature owner: invalid GUID "not-a-guid"`},
+		{name: "signature list with invalid owner", data: esl, owner: "77fa9abd-0359-4d32-bd60", err: "signature owner: invalid GUID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := tt.owner
+			if owner == "" {
+				owner = testOwner
+			}
+			got, err := ParseSignatureDatabase(tt.data, owner)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseSignatureDatabase() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ParseSignatureDatabase() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Digest sources of an event.
+const (
+	// DigestComputed marks digests computed from the inputs (firmware, image, machine shape).
+	DigestComputed = "computed"
+	// DigestCatalog marks digests taken from the hardcoded catalog of captured values.
+	DigestCatalog = "catalog"
+)
+
+// rtmrCount is the number of runtime measurement registers.
+const rtmrCount = 4
+
+// Event is an event measured into a runtime measurement register.
+type Event struct {
+	// Register is the RTMR index (0-3).
+	Register int
+	// Type is the TCG event type.
+	Type        uint32
+	Description string
+	Digest      []byte
+	// Preimage is the event data, when known and small enough to keep. For most event types the
+	// digest is computed over it.
+	Preimage []byte
+	// Source is DigestComputed or DigestCatalog; empty for observed events.
+	Source string
+
+	// measured is the data Digest is the hash of, when known, and digests holds the digests of
+	// other algorithms for events whose digest is not a plain hash of their data.
+	measured []byte
+	digests  map[crypto.Hash][]byte
+}
+
+// DigestFor returns the digest of the event in the bank of the given hash algorithm. Digest is the
+// SHA-384 digest; digests of other algorithms can only be computed when the measured data is known,
+// which is not the case for digests taken from the catalog or from an observed log.
+func (e *Event) DigestFor(alg crypto.Hash) ([]byte, error) {
+	switch {
+	case alg == crypto.SHA384:
+		return e.Digest, nil
+	case e.digests[alg] != nil:
+		return e.digests[alg], nil
+	case e.measured != nil:
+		return measureDigest(alg, e.measured), nil
+	case e.Source == DigestCatalog:
+		return nil, fmt.Errorf("%s: no %s digest, only the SHA-384 digest is in the catalog", e.Description, alg)
+	}
+	return nil, fmt.Errorf("%s: no %s digest, the measured data is unknown", e.Description, alg)
+}
+
+// Observer is notified of every event extended into an EventLog.
+type Observer interface {
+	// Extended is called with the event's index in the log and the register value after extending it.
+	Extended(index int, e *Event, value []byte)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(index int, e *Event, value []byte)
+
+// Extended calls f.
+func (f ObserverFunc) Extended(index int, e *Event, value []byte) {
+	f(index, e, value)
+}
+
+// DebugObserver prints every extended event to w.
+func DebugObserver(w io.Writer) Observer {
+	return ObserverFunc(func(index int, e *Event, value []byte) {
+		fmt.Fprintf(w, "RTMR%d[%d]: %x  %s %s\n", e.Register, index, e.Digest, EventTypeName(e.Type), e.Description)
+	})
+}
+
+// EventLog is an ordered log of events and the register values they extend to.
+type EventLog struct {
+	Events    []Event
+	rtmrs     [rtmrCount][]byte
+	observers []Observer
+}
+
+// NewEventLog returns an empty event log notifying the given observers of every extended event.
+func NewEventLog(observers ...Observer) *EventLog {
+	return &EventLog{observers: observers}
+}
+
+// Extend appends an event to the log and extends its register.
+func (l *EventLog) Extend(e Event) error {
+	if e.Register < 0 || e.Register >= rtmrCount {
+		return fmt.Errorf("event log: invalid register %d", e.Register)
+	}
+	l.Events = append(l.Events, e)
+	l.extend(len(l.Events)-1, l.observers)
+	return nil
+}
+
+func (l *EventLog) extend(index int, observers []Observer) {
+	e := &l.Events[index]
+	mr := l.rtmrs[e.Register]
+	if mr == nil {
+		mr = make([]byte, sha512.Size384) // Initialize to zero.
+	}
+	l.rtmrs[e.Register] = extendMR(mr, e.Digest)
+	for _, o := range observers {
+		o.Extended(index, e, l.rtmrs[e.Register])
+	}
+}
+
+// Replay recomputes the register values from the events. Only the given observers are notified,
+// and only of this replay.
+func (l *EventLog) Replay(observers ...Observer) [rtmrCount][]byte {
+	l.rtmrs = [rtmrCount][]byte{}
+	for i := range l.Events {
+		l.extend(i, observers)
+	}
+	return l.RTMRs()
+}
+
+// RTMR returns the current value of a register.
+func (l *EventLog) RTMR(register int) []byte {
+	if l.rtmrs[register] == nil {
+		return make([]byte, sha512.Size384)
+	}
+	return l.rtmrs[register]
+}
+
+// RTMRs returns the current values of all registers.
+func (l *EventLog) RTMRs() [rtmrCount][]byte {
+	var rtmrs [rtmrCount][]byte
+	for i := range rtmrs {
+		rtmrs[i] = l.RTMR(i)
+	}
+	return rtmrs
+}
+
+// Digests returns the digests of the events, in order.
+func (l *EventLog) Digests() [][]byte {
+	digests := make([][]byte, len(l.Events))
+	for i, e := range l.Events {
+		digests[i] = e.Digest
+	}
+	return digests
+}
+
+type eventJSON struct {
+	Register    int    `json:"register"`
+	EventType   string `json:"event_type"`
+	Description string `json:"description"`
+	Digest      string `json:"digest"`
+	Preimage    string `json:"preimage,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Value       string `json:"value"`
+}
+
+// Marshal encodes the events as JSON, together with the running register value after each event.
+func (l *EventLog) Marshal() ([]byte, error) {
+	events := []eventJSON{}
+	var rtmrs [rtmrCount][]byte
+	for _, e := range l.Events {
+		mr := rtmrs[e.Register]
+		if mr == nil {
+			mr = make([]byte, sha512.Size384)
+		}
+		rtmrs[e.Register] = extendMR(mr, e.Digest)
+		events = append(events, eventJSON{
+			Register:    e.Register,
+			EventType:   EventTypeName(e.Type),
+			Description: e.Description,
+			Digest:      hex.EncodeToString(e.Digest),
+			Preimage:    hex.EncodeToString(e.Preimage),
+			Source:      e.Source,
+			Value:       hex.EncodeToString(rtmrs[e.Register]),
+		})
+	}
+	return json.Marshal(events)
+}
+
+// extendMR returns the value of a measurement register after extending it with a digest.
+func extendMR(mr []byte, digest []byte) []byte {
+	return extendDigest(crypto.SHA384, mr, digest)
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEventLog(t *testing.T) {
+	events := []Event{
+		testEvent(1, EvEfiAction, "action"),
+		testEvent(2, EvIPL, "cmdline"),
+		testEvent(1, EvSeparator, "separator"),
+	}
+	var notified []string
+	log := NewEventLog(ObserverFunc(func(index int, e *Event, value []byte) {
+		notified = append(notified, e.Description)
+		if !bytes.Equal(value, rtmrValueAfter(t, events, index)) {
+			t.Errorf("event %d notified with value %x", index, value)
+		}
+	}))
+	for _, e := range events {
+		if err := log.Extend(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	zero := make([]byte, 48)
+	want := [rtmrCount][]byte{
+		zero,
+		extendMR(extendMR(zero, events[0].Digest), events[2].Digest),
+		extendMR(zero, events[1].Digest),
+		zero,
+	}
+	if got := log.RTMRs(); !equalRTMRs(got, want) {
+		t.Errorf("RTMRs() = %x, want %x", got, want)
+	}
+	if got := strings.Join(notified, ","); got != "action,cmdline,separator" {
+		t.Errorf("observer notified of %s", got)
+	}
+	if digests := log.Digests(); len(digests) != 3 || !bytes.Equal(digests[1], events[1].Digest) {
+		t.Errorf("Digests() = %x", digests)
+	}
+
+	notified = nil
+	if got := log.Replay(); !equalRTMRs(got, want) {
+		t.Errorf("Replay() = %x, want %x", got, want)
+	}
+	if len(notified) != 0 {
+		t.Errorf("Replay() notified %d events of the log's observers, want 0", len(notified))
+	}
+
+	var replayed int
+	scoped := ObserverFunc(func(index int, e *Event, value []byte) { replayed++ })
+	if got := log.Replay(scoped); !equalRTMRs(got, want) {
+		t.Errorf("Replay(o) = %x, want %x", got, want)
+	}
+	log.Replay()
+	if replayed != 3 {
+		t.Errorf("Replay(o) notified %d events, want 3 from its own replay only", replayed)
+	}
+
+	if err := log.Extend(Event{Register: rtmrCount}); err == nil || !strings.Contains(err.Error(), "invalid register") {
+		t.Errorf("Extend() error = %v, want invalid register", err)
+	}
+}
+
+func TestEventLogMarshal(t *testing.T) {
+	log := NewEventLog()
+	first := testEvent(1, EvEfiAction, "action")
+	first.Preimage = []byte("action")
+	first.Source = DigestComputed
+	for _, e := range []Event{first, testEvent(2, EvIPL, "cmdline"), testEvent(1, EvSeparator, "separator")} {
+		if err := log.Extend(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := log.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []eventJSON
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Marshal() encoded %d events, want 3", len(got))
+	}
+	want0 := eventJSON{
+		Register:    1,
+		EventType:   "EV_EFI_ACTION",
+		Description: "action",
+		Digest:      hex.EncodeToString(first.Digest),
+		Preimage:    hex.EncodeToString([]byte("action")),
+		Source:      DigestComputed,
+		Value:       hex.EncodeToString(extendMR(make([]byte, 48), first.Digest)),
+	}
+	if got[0] != want0 {
+		t.Errorf("event 0 = %+v, want %+v", got[0], want0)
+	}
+	// Values are per register: the separator extends RTMR1 after the action.
+	if want := hex.EncodeToString(log.RTMR(1)); got[2].Value != want {
+		t.Errorf("event 2 value = %s, want %s", got[2].Value, want)
+	}
+}
+
+// rtmrValueAfter returns the value of the register of events[index] after extending it.
+func rtmrValueAfter(t *testing.T, events []Event, index int) []byte {
+	t.Helper()
+	mr := make([]byte, 48)
+	for _, e := range events[:index+1] {
+		if e.Register == events[index].Register {
+			mr = extendMR(mr, e.Digest)
+		}
+	}
+	return mr
+}
+
+func equalRTMRs(a, b [rtmrCount][]byte) bool {
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -60,6 +60,9 @@ func parseGuidTable(fw []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if entry.Size < fwGuidEntrySize {
+		return nil, fmt.Errorf("firmware file: Guid table smaller than its footer: %d < %d", entry.Size, fwGuidEntrySize)
+	}
 	if len(fw) < int(entry.Size) {
 		return nil, fmt.Errorf("firmware file: Guid table larger than firmware: %d < %d", len(fw), entry.Size)
 	}
@@ -81,6 +84,9 @@ func ParseGuidMap(fw []byte) (map[string][]byte, error) {
 			return nil, err
 		}
 
+		if entry.Size < fwGuidEntrySize {
+			return nil, fmt.Errorf("firmware file: table entry (%v) smaller than its header (%v)", int(entry.Size), fwGuidEntrySize)
+		}
 		if len(guidTable) < int(entry.Size) {
 			return nil, fmt.Errorf("firmware file: table entry (%v) larger than guid table (%v)", int(entry.Size), len(guidTable))
 		}
@@ -108,6 +114,18 @@ type TdxMetadataSection struct {
 	Attributes    uint32
 }
 
+// TDVF metadata section types.
+// See: https://github.com/tianocore/edk2/blob/master/OvmfPkg/Include/WorkArea.h
+const (
+	TdxSectionTypeBFV          = 0
+	TdxSectionTypeCFV          = 1
+	TdxSectionTypeTdHob        = 2
+	TdxSectionTypeTempMem      = 3
+	TdxSectionTypePermMem      = 4
+	TdxSectionTypePayload      = 5
+	TdxSectionTypePayloadParam = 6
+)
+
 const TdxMetadataOffsetGuid = "e47a6535-984a-4798-865e-4685a7bf8ec2"
 
 func getTdxMetadataOffset(fw []byte) (int, error) {
@@ -115,7 +133,11 @@ func getTdxMetadataOffset(fw []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int(binary.LittleEndian.Uint32(guidmap[TdxMetadataOffsetGuid][:4])), nil
+	entry, ok := guidmap[TdxMetadataOffsetGuid]
+	if !ok || len(entry) < 4 {
+		return 0, fmt.Errorf("TDX Firmware Metadata: no metadata offset entry in GUID table")
+	}
+	return int(binary.LittleEndian.Uint32(entry[:4])), nil
 }
 
 func GetTdxMetadataSections(fw []byte) ([]TdxMetadataSection, error) {
@@ -155,21 +177,24 @@ func GetConfigurationFirmwareVolume(fw []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	var cfvSection TdxMetadataSection
-	for _, section := range sections {
+	var cfvSection *TdxMetadataSection
+	for i, section := range sections {
 		// cfv is first entry of type 1
-		if section.Type == 1 {
-			cfvSection = section
+		if section.Type == TdxSectionTypeCFV {
+			cfvSection = &sections[i]
 			break
 		}
 	}
-	base := int(cfvSection.ImageOffset)
-	limit := int(cfvSection.ImageOffset + cfvSection.RawDataSize)
-	if base > len(fw) {
+	if cfvSection == nil {
+		return nil, fmt.Errorf("TDX Firmware Metadata: no CFV section")
+	}
+	base := uint64(cfvSection.ImageOffset)
+	limit := base + uint64(cfvSection.RawDataSize)
+	if base > uint64(len(fw)) {
 		return nil, fmt.Errorf("TDX Firmware Metadata: CFV Section offset too large: %v vs %v", base, len(fw))
 	}
-	if base > len(fw) || limit < base {
-		return nil, fmt.Errorf("TDX Firmware Metadata: Invalid CFV Section Size too large")
+	if limit > uint64(len(fw)) {
+		return nil, fmt.Errorf("TDX Firmware Metadata: CFV Section extends past the end of the firmware: %v vs %v", limit, len(fw))
 	}
 	return fw[base:limit], nil
 }
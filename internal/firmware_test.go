@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// guidTableGuid is the GUID of the footer entry of the OVMF GUIDed table.
+const guidTableGuid = "96b582de-1fb2-45f7-baea-a366c55a082d"
+
+// guidTableEntry encodes a GUIDed table entry: its data followed by its size and GUID.
+func guidTableEntry(guid string, data []byte, size int) []byte {
+	out := append([]byte(nil), data...)
+	out = binary.LittleEndian.AppendUint16(out, uint16(size))
+	return append(out, encodeGUID(guid)...)
+}
+
+// testFirmware builds a firmware image of the given size whose GUIDed table points at a TDVF
+// metadata descriptor holding the sections.
+func testFirmware(t *testing.T, size int, sections []TdxMetadataSection) []byte {
+	t.Helper()
+	fw := make([]byte, size)
+
+	metadataOffset := size - 0x1000
+	var metadata bytes.Buffer
+	descriptor := TdxMetadataDescriptor{
+		Signature:        [4]byte{'T', 'D', 'V', 'F'},
+		MetadataLength:   uint32(16 + 32*len(sections)),
+		Version:          1,
+		NumberOfSections: uint32(len(sections)),
+	}
+	if err := binary.Write(&metadata, binary.LittleEndian, descriptor); err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.Write(&metadata, binary.LittleEndian, sections); err != nil {
+		t.Fatal(err)
+	}
+	copy(fw[metadataOffset:], metadata.Bytes())
+
+	offset := binary.LittleEndian.AppendUint32(nil, uint32(size-metadataOffset))
+	table := guidTableEntry(TdxMetadataOffsetGuid, offset, len(offset)+fwGuidEntrySize)
+	table = guidTableEntry(guidTableGuid, table, len(table)+fwGuidEntrySize)
+	copy(fw[size-fwGuidTableOffsetFromEnd-len(table):], table)
+	return fw
+}
+
+func TestParseGuidMap(t *testing.T) {
+	fw := testFirmware(t, 0x10000, nil)
+	guidMap, err := ParseGuidMap(fw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := guidMap[TdxMetadataOffsetGuid]
+	if !ok {
+		t.Fatalf("metadata offset entry missing from %v", guidMap)
+	}
+	if got := binary.LittleEndian.Uint32(entry); got != 0x1000 {
+		t.Errorf("metadata offset = %#x, want 0x1000", got)
+	}
+}
+
+func TestParseGuidMapMalformed(t *testing.T) {
+	tableEnd := 0x10000 - fwGuidTableOffsetFromEnd
+	tests := []struct {
+		name    string
+		corrupt func(fw []byte)
+		want    string
+	}{
+		{
+			name: "entry smaller than its header",
+			corrupt: func(fw []byte) {
+				// The entry preceding the table footer.
+				binary.LittleEndian.PutUint16(fw[tableEnd-2*fwGuidEntrySize:], 3)
+			},
+			want: "smaller than its header",
+		},
+		{
+			name: "table smaller than its footer",
+			corrupt: func(fw []byte) {
+				binary.LittleEndian.PutUint16(fw[tableEnd-fwGuidEntrySize:], 0)
+			},
+			want: "smaller than its footer",
+		},
+		{
+			name: "entry larger than table",
+			corrupt: func(fw []byte) {
+				binary.LittleEndian.PutUint16(fw[tableEnd-2*fwGuidEntrySize:], 0x1000)
+			},
+			want: "larger than guid table",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := testFirmware(t, 0x10000, nil)
+			tt.corrupt(fw)
+			_, err := ParseGuidMap(fw)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseGuidMap() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConfigurationFirmwareVolume(t *testing.T) {
+	tests := []struct {
+		name    string
+		section TdxMetadataSection
+		want    string
+	}{
+		{name: "valid", section: TdxMetadataSection{ImageOffset: 0x100, RawDataSize: 0x200, Type: TdxSectionTypeCFV}},
+		{name: "past the end", section: TdxMetadataSection{ImageOffset: 0xff00, RawDataSize: 0x200, Type: TdxSectionTypeCFV}, want: "past the end"},
+		{name: "offset too large", section: TdxMetadataSection{ImageOffset: 0x20000, Type: TdxSectionTypeCFV}, want: "offset too large"},
+		{name: "size overflows", section: TdxMetadataSection{ImageOffset: 0x100, RawDataSize: 0xffffff80, Type: TdxSectionTypeCFV}, want: "past the end"},
+		{name: "no CFV", section: TdxMetadataSection{ImageOffset: 0x100, RawDataSize: 0x200, Type: TdxSectionTypeBFV}, want: "no CFV section"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := testFirmware(t, 0x10000, []TdxMetadataSection{tt.section})
+			for i := range 0x200 {
+				fw[0x100+i] = byte(i)
+			}
+			cfv, err := GetConfigurationFirmwareVolume(fw)
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("GetConfigurationFirmwareVolume() error = %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(cfv, fw[0x100:0x300]) {
+				t.Errorf("CFV = %x..., want the section data", cfv[:8])
+			}
+		})
+	}
+}
+
+func TestGetTdxMetadataSections(t *testing.T) {
+	sections := []TdxMetadataSection{
+		{ImageOffset: 0x100, RawDataSize: 0x200, MemoryAddress: 0xfffe0000, MemorySize: 0x1000, Type: TdxSectionTypeBFV, Attributes: TdxSectionAttributeMrExtend},
+		{MemoryAddress: 0x800000, MemorySize: 0x2000, Type: TdxSectionTypeTempMem},
+	}
+	got, err := GetTdxMetadataSections(testFirmware(t, 0x10000, sections))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(sections) || got[0] != sections[0] || got[1] != sections[1] {
+		t.Errorf("GetTdxMetadataSections() = %+v, want %+v", got, sections)
+	}
+}
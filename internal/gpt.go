@@ -2,7 +2,6 @@ package internal
 
 import (
 	"bytes"
-	"crypto/sha512"
 	"encoding/binary"
 	"hash/crc32"
 	"math"
@@ -29,9 +28,9 @@ const (
 	espPartitionGUID = "87654321-4321-8765-4321-876543218765"
 )
 
-// Generates the deterministic UEFI disk GUID hash for TDX measurements.
-// Sizes are derived from the EFI file size in the same way as mkosi.postoutput
-func calculateUEFIDiskGUIDHash(efiSize int) []byte {
+// Generates the deterministic UEFI_GPT_DATA measured for the boot disk image.
+// Sizes are derived from the size of the files on the ESP in the same way as mkosi.postoutput
+func uefiGPTData(efiSize int) []byte {
 	// Compute partition geometry to match systemd-repart + sgdisk behavior
 	espBytes := int(math.Ceil(float64(efiSize+32*mib)/4096)) * 4096 // repart rounds SizeMaxBytes up to 4096
 	if espBytes < espMinSize4K {
@@ -113,8 +112,5 @@ func calculateUEFIDiskGUIDHash(efiSize int) []byte {
 	binary.Write(&measurementBuf, binary.LittleEndian, header)
 	binary.Write(&measurementBuf, binary.LittleEndian, uint64(1)) // Number of actual partitions
 	binary.Write(&measurementBuf, binary.LittleEndian, partition)
-
-	// Calculate SHA384
-	hash := sha512.Sum384(measurementBuf.Bytes())
-	return hash[:]
+	return measurementBuf.Bytes()
 }
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestUefiGPTData(t *testing.T) {
+	// Offsets in UEFI_GPT_DATA: the 92-byte header, the partition count and the ESP entry.
+	const (
+		alternateLBAOffset = 32
+		endingLBAOffset    = 92 + 8 + 40
+	)
+	tests := []struct {
+		name          string
+		efiSize       int
+		wantEndingLBA uint64
+		wantDiskBytes uint64
+	}{
+		// Small ESP contents use the minimum vfat ESP size.
+		{name: "minimum", efiSize: 64 * mib, wantEndingLBA: espStartingLBA + espMinSize4K/512 - 1, wantDiskBytes: gib},
+		// The ESP grows with its files plus 32 MiB, rounded up to 4 KiB.
+		{name: "large", efiSize: 300*mib + 1, wantEndingLBA: espStartingLBA + (332*mib+4096)/512 - 1, wantDiskBytes: gib},
+		{name: "over a GiB", efiSize: 1000 * mib, wantEndingLBA: espStartingLBA + 1032*mib/512 - 1, wantDiskBytes: 2 * gib},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := uefiGPTData(tt.efiSize)
+			if got := binary.LittleEndian.Uint64(data[endingLBAOffset:]); got != tt.wantEndingLBA {
+				t.Errorf("ESP EndingLBA = %d, want %d", got, tt.wantEndingLBA)
+			}
+			if got := binary.LittleEndian.Uint64(data[alternateLBAOffset:]); got != tt.wantDiskBytes/512-1 {
+				t.Errorf("AlternateLBA = %d, want %d", got, tt.wantDiskBytes/512-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// rtmr0Structure is the RTMR0 event sequence of a GCE TDX VM. Variable events are identified by
+// the variable name in their data, the other events by type and position only.
+var rtmr0Structure = []struct {
+	eventType uint32
+	name      string
+	variable  bool
+}{
+	{EvEfiHandoffTables2, "TD HOB", false},
+	{EvEfiPlatformFirmwareBlob2, "CFV", false},
+	{EvEfiVariableDriverConfig, "SecureBoot", true},
+	{EvEfiVariableDriverConfig, "PK", true},
+	{EvEfiVariableDriverConfig, "KEK", true},
+	{EvEfiVariableDriverConfig, "db", true},
+	{EvEfiVariableDriverConfig, "dbx", true},
+	{EvSeparator, "separator", false},
+	{EvPlatformConfigFlags, "ACPI table loader", false},
+	{EvPlatformConfigFlags, "ACPI RSDP", false},
+	{EvPlatformConfigFlags, "ACPI tables", false},
+	{EvEfiVariableBoot, "BootOrder", true},
+	{EvEfiVariableBoot, "Boot0001", true},
+	{EvEfiVariableBoot, "Boot0002", true},
+	{EvEfiVariableBoot, "Boot0000", true},
+}
+
+// CapturedRTMR0 holds the digests of the RTMR0 events of a captured event log.
+type CapturedRTMR0 struct {
+	TdHobHash  []byte
+	CfvHash    []byte
+	SecureBoot SecureBootHashes
+	Acpi       AcpiHashes
+	BootOrder  []byte
+	Boot       BootVariant
+	Boot0000   []byte
+}
+
+// CaptureRTMR0 extracts the RTMR0 digests from a captured event log. It fails if the RTMR0
+// events do not follow the structure of a GCE TDX VM.
+func CaptureRTMR0(events []CcelEvent) (*CapturedRTMR0, error) {
+	observed := registerEvents(events, 0)
+	if len(observed) != len(rtmr0Structure) {
+		return nil, fmt.Errorf("event log: expected %d RTMR0 events, got %d", len(rtmr0Structure), len(observed))
+	}
+	digests := make(map[string][]byte, len(observed))
+	for i, want := range rtmr0Structure {
+		e := &observed[i]
+		if e.EventType != want.eventType {
+			return nil, fmt.Errorf("event log: RTMR0 event %d: expected %s (%s), got %s %q", i, EventTypeName(want.eventType), want.name, EventTypeName(e.EventType), e.Description())
+		}
+		if want.variable {
+			if name, ok := decodeEfiVariableName(e.Data); !ok || name != want.name {
+				return nil, fmt.Errorf("event log: RTMR0 event %d: expected variable %s, got %q", i, want.name, e.Description())
+			}
+		}
+		digests[want.name] = e.Digest
+	}
+
+	return &CapturedRTMR0{
+		TdHobHash: digests["TD HOB"],
+		CfvHash:   digests["CFV"],
+		SecureBoot: SecureBootHashes{
+			SecureBoot: digests["SecureBoot"],
+			PK:         digests["PK"],
+			KEK:        digests["KEK"],
+			DB:         digests["db"],
+			DBX:        digests["dbx"],
+		},
+		Acpi: AcpiHashes{
+			AcpiLoaderHash: digests["ACPI table loader"],
+			AcpiRsdpHash:   digests["ACPI RSDP"],
+			AcpiTablesHash: digests["ACPI tables"],
+		},
+		BootOrder: digests["BootOrder"],
+		Boot: BootVariant{
+			Boot0001: digests["Boot0001"],
+			Boot0002: digests["Boot0002"],
+		},
+		Boot0000: digests["Boot0000"],
+	}, nil
+}
+
+// Ingest adds the TD HOB, ACPI and boot option digests of a captured log to the catalog as
+// entries of the given machine configuration. New ACPI hashes are labeled with epoch and source.
+// It fails if the log disagrees with the catalog's machine-independent values, or with the TD HOB
+// of an existing machine configuration. It returns a description of each change made.
+func (c *Catalog) Ingest(machine string, captured *CapturedRTMR0, epoch string, source string) ([]string, error) {
+	fixed := []struct {
+		name     string
+		got      []byte
+		expected []byte
+	}{
+		{"SecureBoot", captured.SecureBoot.SecureBoot, c.SecureBoot.SecureBoot},
+		{"PK", captured.SecureBoot.PK, c.SecureBoot.PK},
+		{"KEK", captured.SecureBoot.KEK, c.SecureBoot.KEK},
+		{"db", captured.SecureBoot.DB, c.SecureBoot.DB},
+		{"dbx", captured.SecureBoot.DBX, c.SecureBoot.DBX},
+		{"BootOrder", captured.BootOrder, measureSha384(bootOrderData)},
+		{"Boot0000", captured.Boot0000, c.Boot0000},
+	}
+	for _, f := range fixed {
+		if !bytes.Equal(f.got, f.expected) {
+			return nil, fmt.Errorf("%s digest %x differs from the catalog value %x", f.name, f.got, f.expected)
+		}
+	}
+
+	var changes []string
+	if c.MachineConfigurations == nil {
+		c.MachineConfigurations = make(map[string]MachineConfiguration)
+	}
+	config, ok := c.MachineConfigurations[machine]
+	switch {
+	case !ok:
+		config.TdHobHash = captured.TdHobHash
+		changes = append(changes, fmt.Sprintf("added machine configuration %s", machine))
+	case !bytes.Equal(config.TdHobHash, captured.TdHobHash):
+		return nil, fmt.Errorf("TD HOB digest %x differs from the catalog value %x of %s; is this a different machine type?", captured.TdHobHash, config.TdHobHash, machine)
+	}
+
+	known := slices.ContainsFunc(config.AcpiHashes, func(a AcpiHashes) bool {
+		return bytes.Equal(a.AcpiLoaderHash, captured.Acpi.AcpiLoaderHash) &&
+			bytes.Equal(a.AcpiRsdpHash, captured.Acpi.AcpiRsdpHash) &&
+			bytes.Equal(a.AcpiTablesHash, captured.Acpi.AcpiTablesHash)
+	})
+	if !known {
+		if slices.ContainsFunc(config.AcpiHashes, func(a AcpiHashes) bool { return a.Epoch == epoch }) {
+			return nil, fmt.Errorf("%s already has an ACPI epoch %q with other hashes; label the new hashes with another epoch", machine, epoch)
+		}
+		acpi := captured.Acpi
+		acpi.Epoch = epoch
+		acpi.Source = source
+		config.AcpiHashes = append(slices.Clone(config.AcpiHashes), acpi)
+		changes = append(changes, fmt.Sprintf("added ACPI epoch %q to %s", epoch, machine))
+	}
+	c.MachineConfigurations[machine] = config
+
+	if !slices.ContainsFunc(c.BootVariants, func(b BootVariant) bool {
+		return bytes.Equal(b.Boot0001, captured.Boot.Boot0001) && bytes.Equal(b.Boot0002, captured.Boot.Boot0002)
+	}) {
+		c.BootVariants = append(c.BootVariants, captured.Boot)
+		changes = append(changes, "added boot variant")
+	}
+	return changes, nil
+}
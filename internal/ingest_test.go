@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testVariableData encodes a UEFI_VARIABLE_DATA header naming the variable.
+func testVariableData(name string) []byte {
+	data := make([]byte, 32)
+	binary.LittleEndian.PutUint64(data[16:], uint64(len(name)))
+	for _, u := range utf16.Encode([]rune(name)) {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return data
+}
+
+// testCapturedLog returns the RTMR0 events of a VM of the catalog's c3-standard-4 configuration,
+// with the ACPI and boot option digests replaced by the given ones when not nil.
+func testCapturedLog(t *testing.T, acpi *AcpiHashes, boot *BootVariant) []CcelEvent {
+	t.Helper()
+	c := DefaultCatalog()
+	config, ok := c.MachineConfigurations["c3-standard-4"]
+	if !ok {
+		t.Fatal("no c3-standard-4 configuration")
+	}
+	if acpi == nil {
+		acpi = &config.AcpiHashes[0]
+	}
+	if boot == nil {
+		boot = &c.BootVariants[0]
+	}
+	digests := map[string][]byte{
+		"TD HOB":            config.TdHobHash,
+		"CFV":               measureSha384([]byte("CFV")),
+		"SecureBoot":        c.SecureBoot.SecureBoot,
+		"PK":                c.SecureBoot.PK,
+		"KEK":               c.SecureBoot.KEK,
+		"db":                c.SecureBoot.DB,
+		"dbx":               c.SecureBoot.DBX,
+		"separator":         measureSha384([]byte{0, 0, 0, 0}),
+		"ACPI table loader": acpi.AcpiLoaderHash,
+		"ACPI RSDP":         acpi.AcpiRsdpHash,
+		"ACPI tables":       acpi.AcpiTablesHash,
+		"BootOrder":         measureSha384(bootOrderData),
+		"Boot0001":          boot.Boot0001,
+		"Boot0002":          boot.Boot0002,
+		"Boot0000":          c.Boot0000,
+	}
+	events := []CcelEvent{{MrIndex: 1, EventType: EvNoAction, Digest: make([]byte, 48)}}
+	for _, s := range rtmr0Structure {
+		e := CcelEvent{MrIndex: 1, EventType: s.eventType, Digest: digests[s.name]}
+		if s.variable {
+			e.Data = testVariableData(s.name)
+		}
+		events = append(events, e)
+	}
+	// RTMR1 events are not part of the capture.
+	return append(events, CcelEvent{MrIndex: 2, EventType: EvSeparator, Digest: make([]byte, 48)})
+}
+
+func TestCaptureRTMR0(t *testing.T) {
+	c := DefaultCatalog()
+	captured, err := CaptureRTMR0(testCapturedLog(t, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(captured.SecureBoot, c.SecureBoot) {
+		t.Errorf("SecureBoot = %+v, want %+v", captured.SecureBoot, c.SecureBoot)
+	}
+	acpi := c.MachineConfigurations["c3-standard-4"].AcpiHashes[0]
+	if !bytes.Equal(captured.Acpi.AcpiLoaderHash, acpi.AcpiLoaderHash) || !bytes.Equal(captured.Acpi.AcpiTablesHash, acpi.AcpiTablesHash) {
+		t.Errorf("Acpi = %+v, want %+v", captured.Acpi, acpi)
+	}
+	if !bytes.Equal(captured.Boot0000, c.Boot0000) || !reflect.DeepEqual(captured.Boot, c.BootVariants[0]) {
+		t.Errorf("boot options = %x %+v", captured.Boot0000, captured.Boot)
+	}
+
+	tests := []struct {
+		name   string
+		modify func([]CcelEvent) []CcelEvent
+		want   string
+	}{
+		{name: "missing event", modify: func(e []CcelEvent) []CcelEvent { return slices.Delete(e, 8, 9) }, want: "expected 15 RTMR0 events, got 14"},
+		{name: "wrong type", modify: func(e []CcelEvent) []CcelEvent { e[8].EventType = EvEfiAction; return e }, want: "RTMR0 event 7: expected EV_SEPARATOR (separator)"},
+		{name: "wrong variable", modify: func(e []CcelEvent) []CcelEvent { e[4].Data = testVariableData("db"); return e }, want: "expected variable PK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CaptureRTMR0(tt.modify(testCapturedLog(t, nil, nil)))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("CaptureRTMR0() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngest(t *testing.T) {
+	digest := func(s string) []byte { return measureSha384([]byte(s)) }
+	newAcpi := &AcpiHashes{AcpiLoaderHash: digest("loader"), AcpiRsdpHash: digest("rsdp"), AcpiTablesHash: digest("tables")}
+	newBoot := &BootVariant{Boot0001: digest("boot0001"), Boot0002: digest("boot0002")}
+
+	t.Run("known", func(t *testing.T) {
+		c := DefaultCatalog()
+		captured, err := CaptureRTMR0(testCapturedLog(t, nil, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err := c.Ingest("c3-standard-4", captured, "2026-10", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 || !reflect.DeepEqual(c, DefaultCatalog()) {
+			t.Errorf("Ingest() of a known log changed the catalog: %v", changes)
+		}
+	})
+
+	t.Run("new epoch", func(t *testing.T) {
+		c := DefaultCatalog()
+		captured, err := CaptureRTMR0(testCapturedLog(t, newAcpi, newBoot))
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err := c.Ingest("c3-standard-4", captured, "2026-10", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{`added ACPI epoch "2026-10" to c3-standard-4`, "added boot variant"}
+		if !slices.Equal(changes, want) {
+			t.Errorf("Ingest() = %q, want %q", changes, want)
+		}
+
+		// The ingested catalog round-trips and now knows the captured log.
+		data, err := c.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseCatalog(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acpi := parsed.MachineConfigurations["c3-standard-4"].AcpiHashes
+		if last := acpi[len(acpi)-1]; last.Epoch != "2026-10" || last.Source != "test" || !bytes.Equal(last.AcpiRsdpHash, newAcpi.AcpiRsdpHash) {
+			t.Errorf("ingested epoch = %+v", last)
+		}
+		if !reflect.DeepEqual(parsed, c) {
+			t.Error("ParseCatalog(c.Marshal()) differs from the ingested catalog")
+		}
+		if changes, err := parsed.Ingest("c3-standard-4", captured, "2026-11", "test"); err != nil || len(changes) != 0 {
+			t.Errorf("Ingest() again = %q, %v, want no changes", changes, err)
+		}
+		fw, _ := testShapeFirmware(t)
+		variants, err := NewRegistry(parsed).ExpectedRTMR0Logs(fw, []string{"c3-standard-4"}, MachineShape{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.ContainsFunc(variants, func(v RTMR0Variant) bool { return v.AcpiEpoch == "2026-10" }) {
+			t.Error("the ingested epoch is not measured")
+		}
+	})
+
+	t.Run("duplicate epoch", func(t *testing.T) {
+		// A label names one set of ACPI hashes per machine configuration.
+		c := DefaultCatalog()
+		epoch := c.MachineConfigurations["c3-standard-4"].AcpiHashes[0].Epoch
+		captured, err := CaptureRTMR0(testCapturedLog(t, newAcpi, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Ingest("c3-standard-4", captured, epoch, "test"); err == nil || !strings.Contains(err.Error(), "label the new hashes with another epoch") {
+			t.Fatalf("Ingest() error = %v, want a duplicate epoch error", err)
+		}
+		if !reflect.DeepEqual(c, DefaultCatalog()) {
+			t.Error("failed Ingest() changed the catalog")
+		}
+
+		// Nor does a catalog that repeats a label load.
+		config := c.MachineConfigurations["c3-standard-4"]
+		config.AcpiHashes = append(config.AcpiHashes, config.AcpiHashes[0])
+		c.MachineConfigurations["c3-standard-4"] = config
+		data, err := c.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseCatalog(data); err == nil || !strings.Contains(err.Error(), "duplicate ACPI epoch") {
+			t.Errorf("ParseCatalog() error = %v, want duplicate ACPI epoch", err)
+		}
+	})
+
+	t.Run("new machine", func(t *testing.T) {
+		c := DefaultCatalog()
+		captured, err := CaptureRTMR0(testCapturedLog(t, newAcpi, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		captured.TdHobHash = digest("TD HOB")
+		changes, err := c.Ingest("c3-standard-176", captured, "2026-10", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"added machine configuration c3-standard-176", `added ACPI epoch "2026-10" to c3-standard-176`}
+		if !slices.Equal(changes, want) {
+			t.Errorf("Ingest() = %q, want %q", changes, want)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		modify func(*CapturedRTMR0)
+		want   string
+	}{
+		{name: "Secure Boot", modify: func(c *CapturedRTMR0) { c.SecureBoot.DB = digest("db") }, want: "db digest"},
+		{name: "BootOrder", modify: func(c *CapturedRTMR0) { c.BootOrder = digest("BootOrder") }, want: "BootOrder digest"},
+		{name: "TD HOB", modify: func(c *CapturedRTMR0) { c.TdHobHash = digest("TD HOB") }, want: "is this a different machine type?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultCatalog()
+			captured, err := CaptureRTMR0(testCapturedLog(t, newAcpi, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(captured)
+			if _, err := c.Ingest("c3-standard-4", captured, "2026-10", "test"); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Ingest() error = %v, want %q", err, tt.want)
+			}
+			if !reflect.DeepEqual(c, DefaultCatalog()) {
+				t.Error("failed Ingest() changed the catalog")
+			}
+		})
+	}
+}
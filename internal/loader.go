@@ -0,0 +1,381 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Table loader allocation zones.
+const (
+	TableLoaderZoneHigh = 1
+	TableLoaderZoneFSeg = 2
+)
+
+// Table loader commands.
+// See: https://github.com/qemu/qemu/blob/master/hw/acpi/bios-linker-loader.c
+const (
+	TableLoaderCmdAllocate     = 1
+	TableLoaderCmdAddPointer   = 2
+	TableLoaderCmdAddChecksum  = 3
+	TableLoaderCmdWritePointer = 4
+)
+
+const (
+	tableLoaderEntrySize    = 128
+	tableLoaderFileNameSize = 56
+)
+
+// Base addresses used by the emulator when allocating files. The firmware picks its own
+// addresses, so these only need to be plausible and non-overlapping.
+const (
+	tableLoaderHighBase = 0x7f000000
+	tableLoaderFSegBase = 0x000f0000
+	tableLoaderFSegEnd  = 0x00100000
+)
+
+// TableLoaderCommand is a single command of the QEMU etc/table-loader fw_cfg file.
+type TableLoaderCommand struct {
+	Command uint32
+	// File is the allocated file (ALLOCATE), the checksummed file (ADD_CHECKSUM) or the file
+	// containing the pointer (ADD_POINTER, WRITE_POINTER).
+	File string
+	// SrcFile is the file the pointer refers to (ADD_POINTER, WRITE_POINTER).
+	SrcFile string
+	// Align and Zone describe an allocation (ALLOCATE).
+	Align uint32
+	Zone  uint8
+	// Offset is the offset of the pointer (ADD_POINTER, WRITE_POINTER) or the checksum (ADD_CHECKSUM).
+	Offset uint32
+	// SrcOffset is added to the address of SrcFile (WRITE_POINTER).
+	SrcOffset uint32
+	// Start and Length delimit the checksummed range (ADD_CHECKSUM).
+	Start  uint32
+	Length uint32
+	// Size is the pointer size in bytes (ADD_POINTER, WRITE_POINTER).
+	Size uint8
+}
+
+func (c TableLoaderCommand) String() string {
+	switch c.Command {
+	case TableLoaderCmdAllocate:
+		return fmt.Sprintf("ALLOCATE file=%s align=%d zone=%d", c.File, c.Align, c.Zone)
+	case TableLoaderCmdAddPointer:
+		return fmt.Sprintf("ADD_POINTER dest=%s src=%s offset=%#x size=%d", c.File, c.SrcFile, c.Offset, c.Size)
+	case TableLoaderCmdAddChecksum:
+		return fmt.Sprintf("ADD_CHECKSUM file=%s offset=%#x start=%#x length=%d", c.File, c.Offset, c.Start, c.Length)
+	case TableLoaderCmdWritePointer:
+		return fmt.Sprintf("WRITE_POINTER dest=%s src=%s offset=%#x src_offset=%#x size=%d", c.File, c.SrcFile, c.Offset, c.SrcOffset, c.Size)
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", c.Command)
+	}
+}
+
+// encode serializes the command into a 128-byte BiosLinkerLoaderEntry.
+func (c TableLoaderCommand) encode() []byte {
+	e := make([]byte, tableLoaderEntrySize)
+	binary.LittleEndian.PutUint32(e[0:4], c.Command)
+	switch c.Command {
+	case TableLoaderCmdAllocate:
+		copy(e[4:4+tableLoaderFileNameSize-1], c.File)
+		binary.LittleEndian.PutUint32(e[60:64], c.Align)
+		e[64] = c.Zone
+	case TableLoaderCmdAddPointer:
+		copy(e[4:4+tableLoaderFileNameSize-1], c.File)
+		copy(e[60:60+tableLoaderFileNameSize-1], c.SrcFile)
+		binary.LittleEndian.PutUint32(e[116:120], c.Offset)
+		e[120] = c.Size
+	case TableLoaderCmdAddChecksum:
+		copy(e[4:4+tableLoaderFileNameSize-1], c.File)
+		binary.LittleEndian.PutUint32(e[60:64], c.Offset)
+		binary.LittleEndian.PutUint32(e[64:68], c.Start)
+		binary.LittleEndian.PutUint32(e[68:72], c.Length)
+	case TableLoaderCmdWritePointer:
+		copy(e[4:4+tableLoaderFileNameSize-1], c.File)
+		copy(e[60:60+tableLoaderFileNameSize-1], c.SrcFile)
+		binary.LittleEndian.PutUint32(e[116:120], c.Offset)
+		binary.LittleEndian.PutUint32(e[120:124], c.SrcOffset)
+		e[124] = c.Size
+	}
+	return e
+}
+
+// EncodeTableLoader serializes commands into an etc/table-loader blob.
+func EncodeTableLoader(commands []TableLoaderCommand) []byte {
+	var buf []byte
+	for _, c := range commands {
+		buf = append(buf, c.encode()...)
+	}
+	return buf
+}
+
+// ParseTableLoader decodes an etc/table-loader blob. Zero entries (padding) are skipped.
+func ParseTableLoader(data []byte) ([]TableLoaderCommand, error) {
+	if len(data)%tableLoaderEntrySize != 0 {
+		return nil, fmt.Errorf("table loader: size %d is not a multiple of %d", len(data), tableLoaderEntrySize)
+	}
+
+	fileName := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return string(b)
+	}
+
+	var commands []TableLoaderCommand
+	for off := 0; off < len(data); off += tableLoaderEntrySize {
+		e := data[off : off+tableLoaderEntrySize]
+		c := TableLoaderCommand{Command: binary.LittleEndian.Uint32(e[0:4])}
+		switch c.Command {
+		case 0:
+			continue
+		case TableLoaderCmdAllocate:
+			c.File = fileName(e[4:60])
+			c.Align = binary.LittleEndian.Uint32(e[60:64])
+			c.Zone = e[64]
+		case TableLoaderCmdAddPointer:
+			c.File = fileName(e[4:60])
+			c.SrcFile = fileName(e[60:116])
+			c.Offset = binary.LittleEndian.Uint32(e[116:120])
+			c.Size = e[120]
+		case TableLoaderCmdAddChecksum:
+			c.File = fileName(e[4:60])
+			c.Offset = binary.LittleEndian.Uint32(e[60:64])
+			c.Start = binary.LittleEndian.Uint32(e[64:68])
+			c.Length = binary.LittleEndian.Uint32(e[68:72])
+		case TableLoaderCmdWritePointer:
+			c.File = fileName(e[4:60])
+			c.SrcFile = fileName(e[60:116])
+			c.Offset = binary.LittleEndian.Uint32(e[116:120])
+			c.SrcOffset = binary.LittleEndian.Uint32(e[120:124])
+			c.Size = e[124]
+		default:
+			return nil, fmt.Errorf("table loader: unknown command %d at entry %d", c.Command, off/tableLoaderEntrySize)
+		}
+		commands = append(commands, c)
+	}
+	return commands, nil
+}
+
+// LoadedFile is a fw_cfg file placed in guest memory by the table loader.
+type LoadedFile struct {
+	Address uint64
+	Data    []byte
+}
+
+// InstalledTable is an ACPI table reachable from the RSDP after the table loader ran.
+type InstalledTable struct {
+	Signature string
+	Address   uint64
+	Length    int
+}
+
+// TableLoaderState is guest memory as seen by the firmware after running the table loader.
+type TableLoaderState struct {
+	Files map[string]*LoadedFile
+	// Written holds the writable fw_cfg files updated by WRITE_POINTER commands. They are written
+	// back to QEMU rather than allocated in guest memory.
+	Written map[string][]byte
+}
+
+// ExecuteTableLoader runs the table loader commands over the given fw_cfg files the way OVMF does
+// (see OvmfPkg/AcpiPlatformDxe/QemuFwCfgAcpi.c): files are allocated, pointers are relocated to the
+// allocation addresses and checksums are computed. The input files are not modified.
+func ExecuteTableLoader(commands []TableLoaderCommand, files map[string][]byte) (*TableLoaderState, error) {
+	state := &TableLoaderState{Files: make(map[string]*LoadedFile), Written: make(map[string][]byte)}
+	high := uint64(tableLoaderHighBase)
+	fseg := uint64(tableLoaderFSegBase)
+
+	lookup := func(name string) (*LoadedFile, error) {
+		f, ok := state.Files[name]
+		if !ok {
+			return nil, fmt.Errorf("table loader: file %q used before allocation", name)
+		}
+		return f, nil
+	}
+
+	for i, c := range commands {
+		switch c.Command {
+		case TableLoaderCmdAllocate:
+			data, ok := files[c.File]
+			if !ok {
+				return nil, fmt.Errorf("table loader: command %d allocates missing file %q", i, c.File)
+			}
+			if _, ok := state.Files[c.File]; ok {
+				return nil, fmt.Errorf("table loader: command %d allocates %q twice", i, c.File)
+			}
+			if c.Align == 0 || c.Align&(c.Align-1) != 0 {
+				return nil, fmt.Errorf("table loader: command %d has invalid alignment %d", i, c.Align)
+			}
+			align := uint64(c.Align)
+			var addr uint64
+			switch c.Zone {
+			case TableLoaderZoneHigh:
+				addr = (high + align - 1) &^ (align - 1)
+				high = addr + uint64(len(data))
+			case TableLoaderZoneFSeg:
+				addr = (fseg + align - 1) &^ (align - 1)
+				fseg = addr + uint64(len(data))
+				if fseg > tableLoaderFSegEnd {
+					return nil, fmt.Errorf("table loader: command %d overflows the FSEG zone", i)
+				}
+			default:
+				return nil, fmt.Errorf("table loader: command %d has unknown zone %d", i, c.Zone)
+			}
+			state.Files[c.File] = &LoadedFile{Address: addr, Data: bytes.Clone(data)}
+
+		case TableLoaderCmdAddPointer, TableLoaderCmdWritePointer:
+			var dst []byte
+			if c.Command == TableLoaderCmdAddPointer {
+				f, err := lookup(c.File)
+				if err != nil {
+					return nil, err
+				}
+				dst = f.Data
+			} else if written, ok := state.Written[c.File]; ok {
+				dst = written
+			} else {
+				data, ok := files[c.File]
+				if !ok {
+					return nil, fmt.Errorf("table loader: command %d writes missing file %q", i, c.File)
+				}
+				dst = bytes.Clone(data)
+				state.Written[c.File] = dst
+			}
+			src, err := lookup(c.SrcFile)
+			if err != nil {
+				return nil, err
+			}
+			switch c.Size {
+			case 1, 2, 4, 8:
+			default:
+				return nil, fmt.Errorf("table loader: command %d has invalid pointer size %d", i, c.Size)
+			}
+			if uint64(c.Offset)+uint64(c.Size) > uint64(len(dst)) {
+				return nil, fmt.Errorf("table loader: command %d points outside of %q", i, c.File)
+			}
+			field := dst[c.Offset : c.Offset+uint32(c.Size)]
+			var value uint64
+			if c.Command == TableLoaderCmdAddPointer {
+				// The field holds an offset into the source file.
+				for j := range field {
+					value |= uint64(field[j]) << (8 * j)
+				}
+			} else {
+				value = uint64(c.SrcOffset)
+			}
+			if value >= uint64(len(src.Data)) {
+				return nil, fmt.Errorf("table loader: command %d refers past the end of %q", i, c.SrcFile)
+			}
+			putUintN(field, int(c.Size), src.Address+value)
+
+		case TableLoaderCmdAddChecksum:
+			f, err := lookup(c.File)
+			if err != nil {
+				return nil, err
+			}
+			if uint64(c.Start)+uint64(c.Length) > uint64(len(f.Data)) || c.Offset >= uint32(len(f.Data)) {
+				return nil, fmt.Errorf("table loader: command %d checksums outside of %q", i, c.File)
+			}
+			f.Data[c.Offset] -= checksum(f.Data[c.Start : c.Start+c.Length])
+
+		default:
+			return nil, fmt.Errorf("table loader: unknown command %d", c.Command)
+		}
+	}
+	return state, nil
+}
+
+// read returns length bytes of guest memory at the given address, if they belong to a loaded file.
+func (s *TableLoaderState) read(addr uint64, length int) ([]byte, bool) {
+	for _, f := range s.Files {
+		if addr >= f.Address && addr+uint64(length) <= f.Address+uint64(len(f.Data)) {
+			off := addr - f.Address
+			return f.Data[off : off+uint64(length)], true
+		}
+	}
+	return nil, false
+}
+
+// InstalledTables follows the RSDP to every ACPI table and validates their checksums, returning the
+// tables ordered by address.
+func (s *TableLoaderState) InstalledTables() ([]InstalledTable, error) {
+	rsdpFile, ok := s.Files[acpiRsdpFile]
+	if !ok {
+		return nil, fmt.Errorf("ACPI: %s was not allocated", acpiRsdpFile)
+	}
+	rsdp := rsdpFile.Data
+	if len(rsdp) < acpiRsdpSize || string(rsdp[0:8]) != "RSD PTR " {
+		return nil, fmt.Errorf("ACPI: invalid RSDP")
+	}
+	if checksum(rsdp[:acpiRsdpSize]) != 0 {
+		return nil, fmt.Errorf("ACPI: bad RSDP checksum")
+	}
+
+	seen := make(map[uint64]bool)
+	var tables []InstalledTable
+	var visit func(addr uint64) error
+	visit = func(addr uint64) error {
+		if seen[addr] {
+			return nil
+		}
+		seen[addr] = true
+
+		header, ok := s.read(addr, 8)
+		if !ok {
+			return fmt.Errorf("ACPI: table at %#x is outside of loaded files", addr)
+		}
+		signature := string(header[0:4])
+		length := int(binary.LittleEndian.Uint32(header[4:8]))
+		data, ok := s.read(addr, length)
+		if !ok {
+			return fmt.Errorf("ACPI: %s at %#x overflows its file", signature, addr)
+		}
+		tables = append(tables, InstalledTable{Signature: signature, Address: addr, Length: length})
+
+		// FACS has no checksum and no header beyond the length.
+		if signature == "FACS" {
+			return nil
+		}
+		if length < acpiTableHeaderSize {
+			return fmt.Errorf("ACPI: %s at %#x is too short", signature, addr)
+		}
+		if checksum(data) != 0 {
+			return fmt.Errorf("ACPI: bad %s checksum", signature)
+		}
+
+		switch signature {
+		case "RSDT":
+			for off := acpiTableHeaderSize; off+4 <= length; off += 4 {
+				if err := visit(uint64(binary.LittleEndian.Uint32(data[off:]))); err != nil {
+					return err
+				}
+			}
+		case "FACP":
+			for _, off := range []int{36, 40} {
+				if ptr := binary.LittleEndian.Uint32(data[off:]); ptr != 0 {
+					if err := visit(uint64(ptr)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := visit(uint64(binary.LittleEndian.Uint32(rsdp[16:20]))); err != nil {
+		return nil, err
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Address < tables[j].Address })
+	return tables, nil
+}
+
+// checksum returns the 8-bit sum of the given bytes.
+func checksum(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rawLoaderEntry lays out a BiosLinkerLoaderEntry field by field, following the struct in QEMU's
+// hw/acpi/bios-linker-loader.c rather than TableLoaderCommand.encode.
+func rawLoaderEntry(command uint32, fields ...any) []byte {
+	e := make([]byte, tableLoaderEntrySize)
+	binary.LittleEndian.PutUint32(e, command)
+	for i := 0; i < len(fields); i += 2 {
+		off := fields[i].(int)
+		switch v := fields[i+1].(type) {
+		case string:
+			copy(e[off:], v)
+		case uint8:
+			e[off] = v
+		case uint32:
+			binary.LittleEndian.PutUint32(e[off:], v)
+		}
+	}
+	return e
+}
+
+// testLoaderFiles returns an RSDP, an SSDT holding a 4-byte address field (like the VGIA field of
+// the QEMU VMGENID SSDT) followed by an RSDT, a VMGENID buffer and the address file QEMU reads back.
+func testLoaderFiles() map[string][]byte {
+	tables := make([]byte, 80)
+	copy(tables[0:], "SSDT")
+	binary.LittleEndian.PutUint32(tables[4:], 40)
+	copy(tables[40:], "RSDT")
+	binary.LittleEndian.PutUint32(tables[44:], 40)
+	// The RSDT entry refers to the SSDT at offset 0.
+
+	rsdp := make([]byte, acpiRsdpSize)
+	copy(rsdp, "RSD PTR ")
+	copy(rsdp[9:], "BOCHS ")
+	binary.LittleEndian.PutUint32(rsdp[16:], 40)
+
+	return map[string][]byte{
+		acpiRsdpFile:        rsdp,
+		acpiTablesFile:      tables,
+		"etc/vmgenid_guid":  make([]byte, 4096),
+		"etc/vmgenid_addr":  make([]byte, 8),
+		"etc/unused_sample": {1},
+	}
+}
+
+// testLoaderBlob is the table loader QEMU would emit for testLoaderFiles.
+func testLoaderBlob() []byte {
+	return slices.Concat(
+		rawLoaderEntry(TableLoaderCmdAllocate, 4, acpiRsdpFile, 60, uint32(16), 64, uint8(TableLoaderZoneFSeg)),
+		rawLoaderEntry(TableLoaderCmdAllocate, 4, acpiTablesFile, 60, uint32(64), 64, uint8(TableLoaderZoneHigh)),
+		rawLoaderEntry(TableLoaderCmdAllocate, 4, "etc/vmgenid_guid", 60, uint32(4096), 64, uint8(TableLoaderZoneHigh)),
+		rawLoaderEntry(TableLoaderCmdAddPointer, 4, acpiTablesFile, 60, "etc/vmgenid_guid", 116, uint32(36), 120, uint8(4)),
+		rawLoaderEntry(TableLoaderCmdAddChecksum, 4, acpiTablesFile, 60, uint32(9), 64, uint32(0), 68, uint32(40)),
+		rawLoaderEntry(TableLoaderCmdAddPointer, 4, acpiTablesFile, 60, acpiTablesFile, 116, uint32(76), 120, uint8(4)),
+		rawLoaderEntry(TableLoaderCmdAddChecksum, 4, acpiTablesFile, 60, uint32(49), 64, uint32(40), 68, uint32(40)),
+		rawLoaderEntry(TableLoaderCmdWritePointer, 4, "etc/vmgenid_addr", 60, "etc/vmgenid_guid", 116, uint32(0), 120, uint32(40), 124, uint8(8)),
+		rawLoaderEntry(TableLoaderCmdAddPointer, 4, acpiRsdpFile, 60, acpiTablesFile, 116, uint32(16), 120, uint8(4)),
+		rawLoaderEntry(TableLoaderCmdAddChecksum, 4, acpiRsdpFile, 60, uint32(8), 64, uint32(0), 68, uint32(20)),
+	)
+}
+
+func TestExecuteTableLoader(t *testing.T) {
+	blob := testLoaderBlob()
+	commands, err := ParseTableLoader(append(blob, make([]byte, tableLoaderEntrySize)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 10 {
+		t.Fatalf("parsed %d commands, want 10 (padding skipped)", len(commands))
+	}
+	if got := EncodeTableLoader(commands); !bytes.Equal(got, blob) {
+		t.Errorf("EncodeTableLoader(ParseTableLoader(blob)) differs from blob:\n%x\n%x", got, blob)
+	}
+
+	files := testLoaderFiles()
+	original := bytes.Clone(files[acpiTablesFile])
+	state, err := ExecuteTableLoader(commands, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(files[acpiTablesFile], original) {
+		t.Error("ExecuteTableLoader modified its input")
+	}
+
+	// FSEG starts at 0xf0000; the tables come first in the high zone and the VMGENID buffer is
+	// aligned to the next page.
+	wantAddr := map[string]uint64{acpiRsdpFile: 0xf0000, acpiTablesFile: 0x7f000000, "etc/vmgenid_guid": 0x7f001000}
+	for name, want := range wantAddr {
+		if f := state.Files[name]; f == nil || f.Address != want {
+			t.Errorf("%s allocated at %+v, want %#x", name, f, want)
+		}
+	}
+	if _, ok := state.Files["etc/unused_sample"]; ok {
+		t.Error("a file without ALLOCATE was loaded")
+	}
+
+	tables := state.Files[acpiTablesFile].Data
+	rsdp := state.Files[acpiRsdpFile].Data
+	// ADD_POINTER adds the source address to the offset already in the field.
+	for _, p := range []struct {
+		name string
+		got  uint32
+		want uint32
+	}{
+		{"SSDT VMGENID field", binary.LittleEndian.Uint32(tables[36:]), 0x7f001000},
+		{"RSDT entry", binary.LittleEndian.Uint32(tables[76:]), 0x7f000000},
+		{"RSDP RSDT address", binary.LittleEndian.Uint32(rsdp[16:]), 0x7f000028},
+	} {
+		if p.got != p.want {
+			t.Errorf("%s = %#x, want %#x", p.name, p.got, p.want)
+		}
+	}
+	// ADD_CHECKSUM makes each range sum to zero.
+	for _, r := range []struct {
+		name string
+		data []byte
+	}{{"SSDT", tables[0:40]}, {"RSDT", tables[40:80]}, {"RSDP", rsdp}} {
+		if checksum(r.data) != 0 {
+			t.Errorf("%s checksum does not sum to zero", r.name)
+		}
+	}
+	// WRITE_POINTER updates the fw_cfg file itself with the source address plus src_offset.
+	if got := binary.LittleEndian.Uint64(state.Written["etc/vmgenid_addr"]); got != 0x7f001028 {
+		t.Errorf("etc/vmgenid_addr = %#x, want 0x7f001028", got)
+	}
+	if !bytes.Equal(files["etc/vmgenid_addr"], make([]byte, 8)) {
+		t.Error("WRITE_POINTER modified its input")
+	}
+
+	installed, err := state.InstalledTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InstalledTable{
+		{Signature: "SSDT", Address: 0x7f000000, Length: 40},
+		{Signature: "RSDT", Address: 0x7f000028, Length: 40},
+	}
+	if !slices.Equal(installed, want) {
+		t.Errorf("InstalledTables() = %+v, want %+v", installed, want)
+	}
+}
+
+func TestTableLoaderRoundTrip(t *testing.T) {
+	built, err := BuildAcpiTables(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands, err := ParseTableLoader(built.Loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(commands, built.Commands) {
+		t.Errorf("ParseTableLoader(EncodeTableLoader()) = %v, want %v", commands, built.Commands)
+	}
+
+	// Linking what the loader installed again gives back the same loader and RSDP.
+	linked, err := LinkAcpiTables(built.Tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(linked.Loader, built.Loader) || !bytes.Equal(linked.Rsdp, built.Rsdp) {
+		t.Error("LinkAcpiTables is not stable")
+	}
+
+	state, err := built.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := state.InstalledTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signatures []string
+	for _, table := range installed {
+		signatures = append(signatures, table.Signature)
+	}
+	if want := []string{"FACS", "DSDT", "FACP", "APIC", "MCFG", "WAET", "RSDT"}; !slices.Equal(signatures, want) {
+		t.Errorf("installed tables = %v, want %v", signatures, want)
+	}
+}
+
+func TestExecuteTableLoaderInvalid(t *testing.T) {
+	valid := func() []TableLoaderCommand {
+		commands, err := ParseTableLoader(testLoaderBlob())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return commands
+	}
+	tests := []struct {
+		name   string
+		modify func([]TableLoaderCommand) []TableLoaderCommand
+		want   string
+	}{
+		{
+			name:   "pointer before allocation",
+			modify: func(c []TableLoaderCommand) []TableLoaderCommand { return c[3:] },
+			want:   "used before allocation",
+		},
+		{
+			name: "missing file",
+			modify: func(c []TableLoaderCommand) []TableLoaderCommand {
+				c[2].File = "etc/missing"
+				return c
+			},
+			want: "allocates missing file",
+		},
+		{
+			name: "bad alignment",
+			modify: func(c []TableLoaderCommand) []TableLoaderCommand {
+				c[1].Align = 3
+				return c
+			},
+			want: "invalid alignment",
+		},
+		{
+			name: "pointer outside of file",
+			modify: func(c []TableLoaderCommand) []TableLoaderCommand {
+				c[3].Offset = 78
+				return c
+			},
+			want: "points outside of",
+		},
+		{
+			name: "bad pointer size",
+			modify: func(c []TableLoaderCommand) []TableLoaderCommand {
+				c[7].Size = 3
+				return c
+			},
+			want: "invalid pointer size",
+		},
+		{
+			name: "checksum outside of file",
+			modify: func(c []TableLoaderCommand) []TableLoaderCommand {
+				c[9].Length = 21
+				return c
+			},
+			want: "checksums outside of",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteTableLoader(tt.modify(valid()), testLoaderFiles())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ExecuteTableLoader() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTableLoader(make([]byte, 100)); err == nil {
+		t.Error("ParseTableLoader accepted a truncated entry")
+	}
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// EFI_LOAD_OPTION attributes.
+const (
+	LoadOptionActive      = 0x00000001
+	LoadOptionHidden      = 0x00000008
+	LoadOptionCategoryApp = 0x00000100
+)
+
+// LoadOption describes an EFI_LOAD_OPTION stored in a Boot#### variable.
+type LoadOption struct {
+	// Number is the #### of the Boot#### variable.
+	Number      uint16 `json:"number"`
+	Description string `json:"description"`
+	Attributes  uint32 `json:"attributes"`
+	// DevicePath is the text representation of the file path list, see ParseDevicePath.
+	DevicePath   string   `json:"device_path"`
+	OptionalData HexBytes `json:"optional_data,omitempty"`
+}
+
+// Name returns the name of the option's Boot#### variable.
+func (o *LoadOption) Name() string {
+	return fmt.Sprintf("Boot%04X", o.Number)
+}
+
+// Encode encodes the option as an EFI_LOAD_OPTION.
+func (o *LoadOption) Encode() ([]byte, error) {
+	path, err := ParseDevicePath(o.DevicePath)
+	if err != nil {
+		return nil, err
+	}
+	out := binary.LittleEndian.AppendUint32(nil, o.Attributes)
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(path)))
+	out = append(out, encodeUTF16String(o.Description)...)
+	out = append(out, path...)
+	return append(out, o.OptionalData...), nil
+}
+
+// BootConfiguration is the set of boot options of a VM, in BootOrder order.
+type BootConfiguration struct {
+	Options []LoadOption `json:"options"`
+}
+
+// ParseBootConfiguration parses and validates a JSON boot configuration.
+func ParseBootConfiguration(data []byte) (*BootConfiguration, error) {
+	var c BootConfiguration
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("boot configuration: %w", err)
+	}
+	if len(c.Options) == 0 {
+		return nil, fmt.Errorf("boot configuration: no boot options")
+	}
+	seen := make(map[uint16]bool)
+	for _, o := range c.Options {
+		if seen[o.Number] {
+			return nil, fmt.Errorf("boot configuration: duplicate boot option %s", o.Name())
+		}
+		seen[o.Number] = true
+		if _, err := o.Encode(); err != nil {
+			return nil, fmt.Errorf("boot configuration: %s: %w", o.Name(), err)
+		}
+	}
+	return &c, nil
+}
+
+// LoadBootConfiguration reads a JSON boot configuration from a file.
+func LoadBootConfiguration(path string) (*BootConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot configuration: %w", err)
+	}
+	return ParseBootConfiguration(data)
+}
+
+// BootOrder returns the data of the BootOrder variable.
+func (c *BootConfiguration) BootOrder() []byte {
+	var out []byte
+	for _, o := range c.Options {
+		out = binary.LittleEndian.AppendUint16(out, o.Number)
+	}
+	return out
+}
+
+// Events returns the EV_EFI_VARIABLE_BOOT events of the BootOrder and Boot#### variables. The
+// firmware measures the variable data alone, and the boot options in BootOrder order.
+func (c *BootConfiguration) Events() ([]Event, error) {
+	events := []Event{computedEvent(EvEfiVariableBoot, "BootOrder", c.BootOrder())}
+	for _, o := range c.Options {
+		data, err := o.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", o.Name(), err)
+		}
+		events = append(events, computedEvent(EvEfiVariableBoot, o.Name(), data))
+	}
+	return events, nil
+}
+
+// Disk interfaces of a DiskTopology.
+const (
+	DiskInterfaceNVMe   = "nvme"
+	DiskInterfaceSCSI   = "scsi"
+	DiskInterfaceVirtio = "virtio"
+)
+
+// Locations of the storage controllers on the root bridge and of the UiApp boot manager menu
+// registered by the firmware as Boot0000.
+const (
+	scsiControllerSlot  = 0x3
+	nvmeControllerSlot  = 0x4
+	virtioBlkFirstSlot  = 0x4
+	dxeFvGuid           = "7cb8bdc9-f8eb-4f34-aaea-3ee4af6516a1"
+	uiAppFileGuid       = "462caa21-7614-4503-836e-8ab6f4662331"
+	nvmeDiskDescription = "nvme_card-pd"
+	scsiDiskDescription = "Google PersistentDisk"
+	// autoCreatedBootOptionGuid is the optional data the boot manager tags the boot options it
+	// creates for the devices it enumerates with.
+	autoCreatedBootOptionGuid = "8108ac4e-9f11-4d59-850e-e21a522c59b2"
+	// nvmeFixedNamespaces is the number of namespaces the NVMe controller of a VM exposes without
+	// data disks: the boot disk and a second namespace, enumerated as Boot0001 and Boot0002.
+	nvmeFixedNamespaces = 2
+)
+
+// DiskTopology describes the disks attached to a VM. The boot disk comes first, followed by
+// DataDisks disks on the same interface.
+type DiskTopology struct {
+	// Interface is the disk interface: nvme, scsi or virtio (virtio-blk).
+	Interface string
+	DataDisks int
+}
+
+// BootConfiguration returns the boot options the firmware creates for the topology: one option
+// per enumerated disk device, followed by the UiApp menu in Boot0000. The NVMe boot disk without
+// data disks reproduces the captured boot options; the other topologies are not captured.
+func (t DiskTopology) BootConfiguration() (*BootConfiguration, error) {
+	if t.DataDisks < 0 {
+		return nil, fmt.Errorf("invalid number of data disks: %d", t.DataDisks)
+	}
+	devices := t.DataDisks + 1
+	if t.Interface == DiskInterfaceNVMe {
+		devices = t.DataDisks + nvmeFixedNamespaces
+	}
+	var c BootConfiguration
+	for i := range devices {
+		var description, path string
+		switch t.Interface {
+		case DiskInterfaceNVMe:
+			// Each device is a namespace of the same controller.
+			description = "UEFI " + nvmeDiskDescription
+			path = fmt.Sprintf("PciRoot(0x0)/Pci(0x%x,0x0)/NVMe(0x%x,00-00-00-00-00-00-00-00)", nvmeControllerSlot, i+1)
+		case DiskInterfaceSCSI:
+			// Each disk is a target of the same controller; targets start at 1.
+			description = "UEFI " + scsiDiskDescription
+			path = fmt.Sprintf("PciRoot(0x0)/Pci(0x%x,0x0)/Scsi(0x%x,0x0)", scsiControllerSlot, i+1)
+		case DiskInterfaceVirtio:
+			description = "UEFI Misc Device"
+			path = fmt.Sprintf("PciRoot(0x0)/Pci(0x%x,0x0)", virtioBlkFirstSlot+i)
+		default:
+			return nil, fmt.Errorf("unknown disk interface %q", t.Interface)
+		}
+		// The boot manager makes identical descriptions unique by numbering them.
+		if i > 0 {
+			description = fmt.Sprintf("%s %d", description, i+1)
+		}
+		c.Options = append(c.Options, LoadOption{
+			Number:       uint16(i + 1),
+			Description:  description,
+			Attributes:   LoadOptionActive,
+			DevicePath:   path,
+			OptionalData: encodeGUID(autoCreatedBootOptionGuid),
+		})
+	}
+	c.Options = append(c.Options, LoadOption{
+		Number:      0,
+		Description: "UiApp",
+		Attributes:  LoadOptionCategoryApp | LoadOptionActive | LoadOptionHidden,
+		DevicePath:  fmt.Sprintf("Fv(%s)/FvFile(%s)", dxeFvGuid, uiAppFileGuid),
+	})
+	return &c, nil
+}
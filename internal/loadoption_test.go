@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestLoadOptionEncode(t *testing.T) {
+	o := LoadOption{
+		Number:      0,
+		Description: "UiApp",
+		Attributes:  LoadOptionCategoryApp | LoadOptionActive | LoadOptionHidden,
+		DevicePath:  "Fv(7cb8bdc9-f8eb-4f34-aaea-3ee4af6516a1)/FvFile(462caa21-7614-4503-836e-8ab6f4662331)",
+	}
+	data, err := o.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hex.DecodeString("09010000" + "2c00" +
+		"550069004100700070000000" +
+		"0407" + "1400" + "c9bdb87cebf8344faaea3ee4af6516a1" +
+		"0406" + "1400" + "21aa2c4614760345836e8ab6f4662331" +
+		"7fff0400")
+	if !bytes.Equal(data, want) {
+		t.Errorf("Encode() = %x, want %x", data, want)
+	}
+	if got := o.Name(); got != "Boot0000" {
+		t.Errorf("Name() = %q, want Boot0000", got)
+	}
+}
+
+// TestDiskTopologyCatalog checks that the boot options of the default GCE boot disk reproduce the
+// captured boot variant.
+func TestDiskTopologyCatalog(t *testing.T) {
+	config, err := DiskTopology{Interface: DiskInterfaceNVMe}.BootConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(config.BootOrder(), bootOrderData) {
+		t.Errorf("BootOrder = %x, want %x", config.BootOrder(), bootOrderData)
+	}
+	events, err := config.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog := DefaultCatalog()
+	if _, ok := capturedBootVariant(catalog, events); !ok {
+		for _, e := range events {
+			t.Logf("%s: %x", e.Description, e.Digest)
+		}
+		t.Fatal("boot options match no catalog boot variant")
+	}
+}
+
+func TestDiskTopology(t *testing.T) {
+	tests := []struct {
+		topology DiskTopology
+		want     []string
+		wantErr  bool
+	}{
+		{
+			topology: DiskTopology{Interface: DiskInterfaceNVMe, DataDisks: 1},
+			want: []string{
+				"UEFI nvme_card-pd",
+				"UEFI nvme_card-pd 2",
+				"UEFI nvme_card-pd 3",
+				"UiApp",
+			},
+		},
+		{
+			topology: DiskTopology{Interface: DiskInterfaceSCSI, DataDisks: 1},
+			want:     []string{"UEFI Google PersistentDisk", "UEFI Google PersistentDisk 2", "UiApp"},
+		},
+		{
+			topology: DiskTopology{Interface: DiskInterfaceVirtio},
+			want:     []string{"UEFI Misc Device", "UiApp"},
+		},
+		{topology: DiskTopology{Interface: "ide"}, wantErr: true},
+		{topology: DiskTopology{Interface: DiskInterfaceNVMe, DataDisks: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		config, err := tt.topology.BootConfiguration()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%+v: BootConfiguration() succeeded, want error", tt.topology)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.topology, err)
+		}
+		var got []string
+		for _, o := range config.Options {
+			got = append(got, o.Description)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%+v: descriptions = %q, want %q", tt.topology, got, tt.want)
+		}
+	}
+}
+
+func TestExpectedRTMR0LogsBoot(t *testing.T) {
+	fw, _ := testShapeFirmware(t)
+	captured, err := DiskTopology{Interface: DiskInterfaceNVMe}.BootConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncaptured, err := DiskTopology{Interface: DiskInterfaceSCSI}.BootConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		boot           *BootConfiguration
+		allow          bool
+		wantErr        bool
+		wantVariant    int
+		wantUnverified []string
+	}{
+		{name: "captured", boot: captured, wantVariant: 0},
+		{name: "not captured", boot: uncaptured, wantErr: true},
+		{name: "not captured allowed", boot: uncaptured, allow: true, wantVariant: computedBootVariant, wantUnverified: []string{"boot options"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shape := MachineShape{Boot: tt.boot, AllowUnverified: tt.allow}
+			variants, err := ExpectedRTMR0Logs(fw, []string{"c3-standard-4"}, shape)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnverifiedMeasurement) {
+					t.Fatalf("ExpectedRTMR0Logs() error = %v, want ErrUnverifiedMeasurement", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range variants {
+				if v.BootVariant != tt.wantVariant {
+					t.Errorf("BootVariant = %d, want %d", v.BootVariant, tt.wantVariant)
+				}
+				if !slices.Equal(v.Unverified, tt.wantUnverified) {
+					t.Errorf("Unverified = %v, want %v", v.Unverified, tt.wantUnverified)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RecordedMeasurements holds the reference values recorded in an image's metadata.json. Absent
+// values are not checked.
+type RecordedMeasurements struct {
+	MRTD         HexBytes `json:"mrtd,omitempty"`
+	RTMR0        HexBytes `json:"rtmr0,omitempty"`
+	RTMR1        HexBytes `json:"rtmr1,omitempty"`
+	RTMR2        HexBytes `json:"rtmr2,omitempty"`
+	MRAggregated HexBytes `json:"mr_aggregated,omitempty"`
+	MRImage      HexBytes `json:"mr_image,omitempty"`
+}
+
+// ImageMetadata is the metadata.json of a dstack image release directory. Paths are relative to
+// the directory of the metadata file until resolved by LoadImageMetadata.
+type ImageMetadata struct {
+	// Bios is the path of the firmware image built with the image. GCE boots its own published
+	// firmware, so it is only measured on explicit request.
+	Bios string `json:"bios,omitempty"`
+	// UKI is the path of the unified kernel image.
+	UKI string `json:"uki,omitempty"`
+	// Kernel, Initrd and Cmdline describe the boot of a kernel without a UKI. When a UKI is given,
+	// the initrd and cmdline it embeds are measured instead.
+	Kernel  string `json:"kernel,omitempty"`
+	Initrd  string `json:"initrd,omitempty"`
+	Cmdline string `json:"cmdline,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Measurements are the reference values recorded for the image.
+	Measurements *RecordedMeasurements `json:"measurements,omitempty"`
+}
+
+// ParseImageMetadata parses a metadata.json.
+func ParseImageMetadata(data []byte) (*ImageMetadata, error) {
+	var m ImageMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("image metadata: %w", err)
+	}
+	if m.UKI == "" && m.Kernel == "" {
+		return nil, fmt.Errorf("image metadata: neither uki nor kernel is set")
+	}
+	if m.UKI != "" && m.Kernel != "" {
+		return nil, fmt.Errorf("image metadata: uki and kernel are both set")
+	}
+	return &m, nil
+}
+
+// LoadImageMetadata reads a metadata.json and resolves its paths relative to the file.
+func LoadImageMetadata(path string) (*ImageMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image metadata: %w", err)
+	}
+	m, err := ParseImageMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	for _, p := range []*string{&m.Bios, &m.UKI, &m.Kernel, &m.Initrd} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return m, nil
+}
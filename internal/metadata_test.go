@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImageMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "uki", data: `{"uki": "dstack-uki.efi", "bios": "ovmf.fd", "version": "0.5.0"}`},
+		{name: "kernel", data: `{"kernel": "bzImage", "initrd": "initramfs.cpio.gz", "cmdline": "console=ttyS0"}`},
+		{name: "neither", data: `{"version": "0.5.0"}`, wantErr: "neither uki nor kernel"},
+		{name: "both", data: `{"uki": "dstack-uki.efi", "kernel": "bzImage"}`, wantErr: "both set"},
+		{name: "bad measurement", data: `{"uki": "a.efi", "measurements": {"mrtd": "zz"}}`, wantErr: "image metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseImageMetadata([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseImageMetadata() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadImageMetadataResolvesPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metadata.json")
+	data := `{"uki": "dstack-uki.efi", "bios": "/abs/ovmf.fd", "measurements": {"rtmr1": "0102"}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadImageMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "dstack-uki.efi"); m.UKI != want {
+		t.Errorf("UKI = %q, want %q", m.UKI, want)
+	}
+	if m.Bios != "/abs/ovmf.fd" {
+		t.Errorf("Bios = %q, want the absolute path unchanged", m.Bios)
+	}
+	if got := m.Measurements.RTMR1; string(got) != "\x01\x02" {
+		t.Errorf("RTMR1 = %x, want 0102", got)
+	}
+}
@@ -2,13 +2,17 @@ package internal
 
 import (
 	"bytes"
+	"cmp"
 	"crypto"
+	"crypto/sha256"
 	"crypto/sha512"
-	"debug/pe"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/foxboron/go-uefi/authenticode"
@@ -18,114 +22,18 @@ import (
 
 // measureSha384 computes a SHA384 of the given blob.
 func measureSha384(data []byte) []byte {
-	h := sha512.Sum384(data)
-	return h[:]
+	return measureDigest(crypto.SHA384, data)
 }
 
-// measureTdxKernelCmdline measures the kernel cmdline.
-func measureTdxKernelCmdline(cmdline string) []byte {
+// kernelCmdlineData returns the measured form of the kernel cmdline.
+func kernelCmdlineData(cmdline string) []byte {
 	// Add a NUL byte at the end.
 	d := append([]byte(cmdline), 0x00)
 	// Convert to UTF-16LE.
 	utf16le := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder()
 	xr := transform.NewReader(bytes.NewReader(d), utf16le)
 	converted, _ := io.ReadAll(xr)
-	return measureSha384(converted)
-}
-
-// measureTdxQemuTdHob measures the TD HOB.
-func measureTdxQemuTdHob(memorySize uint64 /*, meta *tdvfMetadata*/) []byte {
-	// Construct a TD hob in the same way as QEMU does. Note that all fields are little-endian.
-	// See: https://github.com/intel-staging/qemu-tdx/blob/tdx-qemu-next/hw/i386/tdvf-hob.c
-	var tdHob []byte
-	// Discover the TD HOB base address from TDVF metadata.
-	tdHobBaseAddr := uint64(0x809000) // TD HOB base address.
-	/*if meta != nil {
-		for _, s := range meta.sections {
-			if s.secType == tdvfSectionTdHob {
-				tdHobBaseAddr = s.memoryAddress
-				break
-			}
-		}
-	}*/
-
-	// Start with EFI_HOB_TYPE_HANDOFF.
-	tdHob = append(tdHob,
-		0x01, 0x00, // Header.HobType (EFI_HOB_TYPE_HANDOFF)
-		0x38, 0x00, // Header.HobLength (56 bytes)
-		0x00, 0x00, 0x00, 0x00, // Header.Reserved
-		0x09, 0x00, 0x00, 0x00, // Version (EFI_HOB_HANDOFF_TABLE_VERSION)
-		0x00, 0x00, 0x00, 0x00, // BootMode
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // EfiMemoryTop
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // EfiMemoryBottom
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // EfiFreeMemoryTop
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // EfiFreeMemoryBottom
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // EfiEndOfHobList (filled later)
-	)
-
-	// The rest of the HOBs are EFI_HOB_TYPE_RESOURCE_DESCRIPTOR.
-	remainingMemory := memorySize
-	addMemoryResourceHob := func(resourceType uint8, start, length uint64) {
-		tdHob = append(tdHob,
-			0x03, 0x00, // Header.HobType (EFI_HOB_TYPE_RESOURCE_DESCRIPTOR)
-			0x30, 0x00, // Header.HobLength (48 bytes)
-			0x00, 0x00, 0x00, 0x00, // Header.Reserved
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Owner
-			resourceType, 0x00, 0x00, 0x00, // ResourceType
-			0x07, 0x00, 0x00, 0x00, // ResourceAttribute
-		)
-
-		var val [8]byte
-		binary.LittleEndian.PutUint64(val[:], start)
-		tdHob = append(tdHob, val[:]...) // PhysicalStart
-		binary.LittleEndian.PutUint64(val[:], length)
-		tdHob = append(tdHob, val[:]...) // Length
-
-		// Subtract from remaining memory.
-		remainingMemory -= length
-	}
-
-	addMemoryResourceHob(0x07, 0x0000000000000000, 0x0000000000800000)
-	addMemoryResourceHob(0x00, 0x0000000000800000, 0x0000000000006000)
-	addMemoryResourceHob(0x07, 0x0000000000806000, 0x0000000000003000)
-	addMemoryResourceHob(0x00, 0x0000000000809000, 0x0000000000002000)
-	addMemoryResourceHob(0x00, 0x000000000080B000, 0x0000000000002000)
-	addMemoryResourceHob(0x07, 0x000000000080D000, 0x0000000000004000)
-	addMemoryResourceHob(0x00, 0x0000000000811000, 0x000000000000f000)
-
-	// Handle memory split at 2816 MiB (0xB0000000).
-	if memorySize >= 0xB0000000 {
-		addMemoryResourceHob(0x07, 0x0000000000820000, 0x000000007F7E0000)
-		addMemoryResourceHob(0x07, 0x0000000100000000, remainingMemory)
-	} else {
-		addMemoryResourceHob(0x07, 0x0000000000820000, remainingMemory)
-	}
-
-	// Update EfiEndOfHobList.
-	var val [8]byte
-	binary.LittleEndian.PutUint64(val[:], tdHobBaseAddr+uint64(len(tdHob))+8)
-	copy(tdHob[48:56], val[:])
-
-	// Measure the TD HOB.
-	return measureSha384(tdHob)
-}
-
-// measureLog computes a measurement of the given RTMR event log by simulating extending the RTMR.
-func measureLog(log [][]byte, debug bool, rtmrName string) []byte {
-	if debug && rtmrName != "" {
-		fmt.Printf("\n=== %s Event Hashes ===\n", rtmrName)
-	}
-	var mr [48]byte // Initialize to zero.
-	for i, entry := range log {
-		if debug && rtmrName != "" {
-			fmt.Printf("%s[%d]: %x\n", rtmrName, i, entry)
-		}
-		h := sha512.New384()
-		_, _ = h.Write(mr[:])
-		_, _ = h.Write(entry)
-		copy(mr[:], h.Sum([]byte{}))
-	}
-	return mr[:]
+	return converted
 }
 
 // encodeGUID encodes an UEFI GUID into binary form.
@@ -151,30 +59,16 @@ func encodeGUID(guid string) []byte {
 	return data
 }
 
-// extractKernelPE extracts the .linux section from a UKI
-func extractKernel(ukiData []byte) []byte {
-	f, err := pe.NewFile(bytes.NewReader(ukiData))
-	if err != nil {
-		panic("failed to parse UKI as PE file")
-	}
-	defer f.Close()
-	sec := f.Section(".linux")
-	data, err := sec.Data()
-	if err != nil {
-		panic("failed to extract .linux section from UKI")
-	}
-	return data[:sec.VirtualSize]
-}
-
-// measureTdxEfiVariable measures an EFI variable event.
-func measureTdxEfiVariable(vendorGUID string, varName string) []byte {
+// efiVariableData returns the UEFI_VARIABLE_DATA structure measured for an EFI variable event,
+// holding the variable's vendor GUID, name and data.
+func efiVariableData(vendorGUID string, varName string, varData []byte) []byte {
 	var data []byte
 	data = append(data, encodeGUID(vendorGUID)...)
 
 	var encLen [8]byte
 	binary.LittleEndian.PutUint64(encLen[:], uint64(len(varName)))
 	data = append(data, encLen[:]...)
-	binary.LittleEndian.PutUint64(encLen[:], 0)
+	binary.LittleEndian.PutUint64(encLen[:], uint64(len(varData)))
 	data = append(data, encLen[:]...)
 
 	// Convert varName to UTF-16LE.
@@ -182,86 +76,387 @@ func measureTdxEfiVariable(vendorGUID string, varName string) []byte {
 	xr := transform.NewReader(bytes.NewReader([]byte(varName)), utf16le)
 	converted, _ := io.ReadAll(xr)
 	data = append(data, converted...)
+	return append(data, varData...)
+}
 
-	return measureSha384(data)
+// MachineShape describes the virtual hardware of a VM. Zero fields are not overridden and the
+// hardcoded measurements of the machine configuration are used instead. The TD HOB and ACPI
+// tables are always taken from the machine configuration.
+type MachineShape struct {
+	// Boot holds the boot options of the VM, used to compute the BootOrder and Boot#### events.
+	Boot *BootConfiguration
+	// AllowUnverified keeps computed measurements that match no value captured in the catalog.
+	// The variants using them are flagged in RTMR0Variant.Unverified.
+	AllowUnverified bool
 }
 
-// MeasureRTMR0 computes RTMR0 values for a given firmware across all configuration/boot variant/ACPI variant combinations.
-func MeasureRTMR0(fwData []byte, configurations []string, debug bool) ([][]byte, error) {
+// ErrUnverifiedMeasurement is returned when a measurement computed from a MachineShape matches no
+// captured value and MachineShape.AllowUnverified is not set. The model of the boot options only
+// covers part of what GCE generates, so such values are likely wrong.
+var ErrUnverifiedMeasurement = errors.New("computed measurement matches no captured value")
+
+// unverified checks a computed measurement that matches no captured value against the shape's
+// policy, returning the error to fail with.
+func (s MachineShape) unverified(name string, detail string) error {
+	if s.AllowUnverified {
+		return nil
+	}
+	return fmt.Errorf("%s %s: %w", name, detail, ErrUnverifiedMeasurement)
+}
+
+// computedEvent returns an event measuring the given data.
+func computedEvent(eventType uint32, description string, data []byte) Event {
+	return Event{Type: eventType, Description: description, Digest: measureSha384(data), Preimage: data, Source: DigestComputed, measured: data}
+}
+
+// measuredEvent returns an event measuring the given data, without keeping it as the preimage.
+func measuredEvent(eventType uint32, description string, data []byte) Event {
+	return Event{Type: eventType, Description: description, Digest: measureSha384(data), Source: DigestComputed, measured: data}
+}
+
+// authenticodeEvent returns an event measuring the authenticode hash of a PE image, in every
+// supported bank.
+func authenticodeEvent(description string, image *authenticode.PECOFFBinary) Event {
+	e := Event{Type: EvEfiBootServicesApplication, Description: description, Source: DigestComputed, digests: make(map[crypto.Hash][]byte)}
+	for _, alg := range PCRBankAlgorithms {
+		e.digests[alg] = image.Hash(alg)
+	}
+	e.Digest = e.digests[crypto.SHA384]
+	return e
+}
+
+// digestEvent returns an event with a precomputed digest.
+func digestEvent(eventType uint32, description string, digest []byte, source string) Event {
+	return Event{Type: eventType, Description: description, Digest: digest, Source: source}
+}
+
+// expectedLog returns the log of the expected events of a register, notifying the observers of
+// every event as it is extended.
+func expectedLog(register int, events []Event, observers []Observer) *EventLog {
+	for i := range events {
+		events[i].Register = register
+	}
+	log := &EventLog{Events: events}
+	log.Replay(observers...)
+	return log
+}
+
+// RTMR0Variant is one candidate RTMR0 event log together with the catalog entries it was built from.
+type RTMR0Variant struct {
+	Configuration string
+	AcpiEpoch     string
+	// BootVariant is the index of the catalog boot variant, or computedBootVariant when the
+	// boot options computed from the machine shape match none.
+	BootVariant int
+	// Unverified names the computed events of the log that match no captured value.
+	Unverified []string
+	Log        *EventLog
+}
+
+// bootOrderData is the BootOrder variable of a GCE VM: 0001,0002,0000.
+var bootOrderData = []byte{0x01, 0x00, 0x02, 0x00, 0x00, 0x00}
+
+// capturedAcpiEpoch returns the epoch of the captured ACPI hashes of a machine configuration
+// matching the events of computed ACPI tables.
+func capturedAcpiEpoch(catalog *Catalog, configName string, events []Event) (string, bool) {
+	for _, acpi := range catalog.MachineConfigurations[configName].AcpiHashes {
+		if slices.EqualFunc(acpi.events(), events, func(a, b Event) bool { return bytes.Equal(a.Digest, b.Digest) }) {
+			return acpi.Epoch, true
+		}
+	}
+	return "", false
+}
+
+// computedBootVariant is the boot variant of boot options computed from a BootConfiguration that
+// match no catalog boot variant.
+const computedBootVariant = -1
+
+// catalogBootEvents returns the BootOrder and Boot#### events of a catalog boot variant.
+func catalogBootEvents(catalog *Catalog, boot BootVariant) []Event {
+	return []Event{
+		computedEvent(EvEfiVariableBoot, "BootOrder", bootOrderData),
+		digestEvent(EvEfiVariableBoot, "Boot0001", boot.Boot0001, DigestCatalog),
+		digestEvent(EvEfiVariableBoot, "Boot0002", boot.Boot0002, DigestCatalog),
+		digestEvent(EvEfiVariableBoot, "Boot0000", catalog.Boot0000, DigestCatalog),
+	}
+}
+
+// capturedBootVariant returns the index of the catalog boot variant whose events equal computed
+// BootOrder and Boot#### events.
+func capturedBootVariant(catalog *Catalog, events []Event) (int, bool) {
+	for i, boot := range catalog.BootVariants {
+		if slices.EqualFunc(catalogBootEvents(catalog, boot), events, func(a, b Event) bool {
+			return a.Description == b.Description && bytes.Equal(a.Digest, b.Digest)
+		}) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ExpectedRTMR0Logs builds the expected RTMR0 event logs for a given firmware across all
+// configuration/boot variant/ACPI variant combinations of the embedded catalog.
+func ExpectedRTMR0Logs(fwData []byte, configurations []string, shape MachineShape) ([]RTMR0Variant, error) {
+	return defaultRegistry.ExpectedRTMR0Logs(fwData, configurations, shape)
+}
+
+// ExpectedRTMR0Logs builds the expected RTMR0 event logs for a given firmware across all
+// configuration/boot variant/ACPI variant combinations of the registry's catalog.
+func (r *Registry) ExpectedRTMR0Logs(fwData []byte, configurations []string, shape MachineShape) ([]RTMR0Variant, error) {
+	return r.expectedRTMR0Logs(fwData, configurations, shape, nil)
+}
+
+// expectedRTMR0Logs builds the expected RTMR0 event logs like ExpectedRTMR0Logs, notifying the
+// observers of every event of every variant.
+func (r *Registry) expectedRTMR0Logs(fwData []byte, configurations []string, shape MachineShape, observers []Observer) ([]RTMR0Variant, error) {
+	catalog := r.Catalog()
 	if configurations == nil {
-		for name := range machineConfigurations {
-			configurations = append(configurations, name)
+		configurations = slices.Sorted(maps.Keys(catalog.MachineConfigurations))
+	}
+	for _, configName := range configurations {
+		if _, ok := catalog.MachineConfigurations[configName]; !ok {
+			return nil, fmt.Errorf("unknown machine configuration: %s", configName)
 		}
 	}
 
-	cfvImageHash, err := GetExpectedCfvSha384(fwData)
+	cfv, err := GetConfigurationFirmwareVolume(fwData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compute CFV hash: %w", err)
 	}
 
-	var rtmr0s [][]byte
-	for _, configName := range configurations {
-		configEvents, ok := machineConfigurations[configName]
+	bootVariants := make(map[int][]Event)
+	var bootUnverified []string
+	if shape.Boot != nil {
+		events, err := shape.Boot.Events()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode boot options: %w", err)
+		}
+		// Boot options reproducing a captured variant are labeled with it.
+		bootIdx, ok := capturedBootVariant(catalog, events)
 		if !ok {
-			return nil, fmt.Errorf("unknown machine configuration: %s", configName)
+			if err := shape.unverified("boot options", fmt.Sprintf("of %d Boot#### variables", len(shape.Boot.Options))); err != nil {
+				return nil, err
+			}
+			bootUnverified = []string{"boot options"}
+			bootIdx = computedBootVariant
+		}
+		bootVariants[bootIdx] = events
+	} else {
+		for i, boot := range catalog.BootVariants {
+			bootVariants[i] = catalogBootEvents(catalog, boot)
 		}
+	}
 
+	var variants []RTMR0Variant
+	for _, configName := range configurations {
+		configEvents := catalog.MachineConfigurations[configName]
+		tdHobEvent := digestEvent(EvEfiHandoffTables2, "TD HOB", configEvents.TdHobHash, DigestCatalog)
+		// ACPI tables built from the embedded templates reproduce no captured epoch, so only the
+		// captured hashes are measured.
 		for _, acpi := range configEvents.AcpiHashes {
-			for _, boot := range bootVariants {
-				rtmr0Log := [][]byte{
-					configEvents.TdHobHash,
-					cfvImageHash,
-					secureBootHash,
-					pkHash,
-					kekHash,
-					dbHash,
-					dbxHash,
-					measureSha384([]byte{0x00, 0x00, 0x00, 0x00}), // Separator.
-					acpi.AcpiLoaderHash,
-					acpi.AcpiRsdpHash,
-					acpi.AcpiTablesHash,
-					measureSha384([]byte{0x01, 0x00, 0x02, 0x00, 0x00, 0x00}), // BootOrder: 0001,0002,0000
-					boot.Boot0001,
-					boot.Boot0002,
-					boot0000Hash,
-				}
-				rtmr0s = append(rtmr0s, measureLog(rtmr0Log, debug, "RTMR0"))
+			for _, bootIdx := range slices.Sorted(maps.Keys(bootVariants)) {
+				events := []Event{tdHobEvent, measuredEvent(EvEfiPlatformFirmwareBlob2, "CFV", cfv)}
+				events = append(events, catalog.SecureBoot.events()...)
+				events = append(events, computedEvent(EvSeparator, "separator", []byte{0x00, 0x00, 0x00, 0x00}))
+				events = append(events, acpi.events()...)
+				// Each log gets its own copy of the boot events, as expectedLog sets their register.
+				rtmr0Log := expectedLog(0, append(events, slices.Clone(bootVariants[bootIdx])...), observers)
+				variants = append(variants, RTMR0Variant{
+					Configuration: configName,
+					AcpiEpoch:     acpi.Epoch,
+					BootVariant:   bootIdx,
+					Unverified:    slices.Clone(bootUnverified),
+					Log:           rtmr0Log,
+				})
 			}
 		}
 	}
 
+	return variants, nil
+}
+
+// MeasureRTMR0 computes RTMR0 values for a given firmware across all configuration/boot variant/ACPI variant combinations.
+// The observers are notified of every event of every variant.
+func MeasureRTMR0(fwData []byte, configurations []string, shape MachineShape, observers ...Observer) ([][]byte, error) {
+	return defaultRegistry.MeasureRTMR0(fwData, configurations, shape, observers...)
+}
+
+// MeasureRTMR0 computes RTMR0 values for a given firmware using the registry's catalog.
+func (r *Registry) MeasureRTMR0(fwData []byte, configurations []string, shape MachineShape, observers ...Observer) ([][]byte, error) {
+	variants, err := r.expectedRTMR0Logs(fwData, configurations, shape, observers)
+	if err != nil {
+		return nil, err
+	}
+
+	var rtmr0s [][]byte
+	for _, v := range variants {
+		rtmr0s = append(rtmr0s, v.Log.RTMR(0))
+	}
 	return rtmr0s, nil
 }
 
-// MeasureRTMR1And2 computes RTMR1 and RTMR2 from the UKI, initrd, and kernel cmdline (firmware-independent).
-func MeasureRTMR1And2(kernelData []byte, initrdData []byte, kernelCmdline string, debug bool) (rtmr1 []byte, rtmr2 []byte, err error) {
+// RTMR0Value is an RTMR0 reference value together with the variant it was computed for.
+type RTMR0Value struct {
+	// Firmware is the SHA-384 of the firmware image, which names it in the published bucket.
+	Firmware      []byte
+	MRTD          []byte
+	Configuration string
+	AcpiEpoch     string
+	// BootVariant is the index of the catalog boot variant, or computedBootVariant when the boot
+	// options computed from the machine shape match none.
+	BootVariant int
+	// Unverified names the computed events that match no captured value.
+	Unverified []string
+	Value      []byte
+}
+
+// CompareRTMR0Values orders RTMR0 values by firmware, machine configuration, ACPI epoch and boot
+// variant.
+func CompareRTMR0Values(a, b RTMR0Value) int {
+	return cmp.Or(
+		bytes.Compare(a.Firmware, b.Firmware),
+		cmp.Compare(a.Configuration, b.Configuration),
+		cmp.Compare(a.AcpiEpoch, b.AcpiEpoch),
+		cmp.Compare(a.BootVariant, b.BootVariant),
+	)
+}
+
+// MeasureRTMR0Variants computes the RTMR0 values of a firmware image like MeasureRTMR0, labeled
+// with the variant each was computed for and sorted with CompareRTMR0Values. mrtd is the MRTD of
+// the firmware, see MRTD; it only labels the values.
+func (r *Registry) MeasureRTMR0Variants(fwData []byte, mrtd []byte, configurations []string, shape MachineShape, observers ...Observer) ([]RTMR0Value, error) {
+	variants, err := r.expectedRTMR0Logs(fwData, configurations, shape, observers)
+	if err != nil {
+		return nil, err
+	}
+
+	firmware := sha512.Sum384(fwData)
+	var values []RTMR0Value
+	for _, v := range variants {
+		values = append(values, RTMR0Value{
+			Firmware:      firmware[:],
+			MRTD:          mrtd,
+			Configuration: v.Configuration,
+			AcpiEpoch:     v.AcpiEpoch,
+			BootVariant:   v.BootVariant,
+			Unverified:    v.Unverified,
+			Value:         v.Log.RTMR(0),
+		})
+	}
+	slices.SortStableFunc(values, CompareRTMR0Values)
+	return values, nil
+}
+
+// ExpectedRTMR1And2Logs builds the expected RTMR1 and RTMR2 event logs from the UKI, initrd, and kernel cmdline.
+func ExpectedRTMR1And2Logs(kernelData []byte, initrdData []byte, kernelCmdline string) (rtmr1Log *EventLog, rtmr2Log *EventLog, err error) {
+	return expectedRTMR1And2Logs(kernelData, initrdData, kernelCmdline, nil)
+}
+
+// expectedRTMR1And2Logs builds the logs like ExpectedRTMR1And2Logs, notifying the observers of
+// every event.
+func expectedRTMR1And2Logs(kernelData []byte, initrdData []byte, kernelCmdline string, observers []Observer) (rtmr1Log *EventLog, rtmr2Log *EventLog, err error) {
 	ukiAuthHash, err := authenticode.Parse(bytes.NewReader(kernelData))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("failed to parse UKI authenticode: %w", err)
 	}
 
-	kernelPEData := extractKernel(kernelData)
+	kernelPEData, err := extractKernel(kernelData)
+	if err != nil {
+		return nil, nil, err
+	}
 	kernelAuthHash, err := authenticode.Parse(bytes.NewReader(kernelPEData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse kernel authenticode: %w", err)
+	}
+
+	// systemd-stub measures the cmdline as EV_IPL, into PCR12 on a TPM.
+	rtmr1Log, rtmr2Log = expectedBootLogs(len(kernelData), []Event{
+		authenticodeEvent("UKI", ukiAuthHash),
+		authenticodeEvent("kernel", kernelAuthHash),
+	}, initrdData, EvIPL, kernelCmdline, observers)
+	return rtmr1Log, rtmr2Log, nil
+}
+
+// ExpectedDirectBootRTMR1And2Logs builds the expected RTMR1 and RTMR2 event logs of an EFI stub
+// kernel booted directly, without a UKI, with the given initrd and kernel cmdline. The kernel is
+// the only EFI application loaded, from a disk whose ESP is sized for the kernel and the initrd it
+// holds next to it.
+func ExpectedDirectBootRTMR1And2Logs(kernelData []byte, initrdData []byte, kernelCmdline string) (rtmr1Log *EventLog, rtmr2Log *EventLog, err error) {
+	return expectedDirectBootRTMR1And2Logs(kernelData, initrdData, kernelCmdline, nil)
+}
+
+// expectedDirectBootRTMR1And2Logs builds the logs like ExpectedDirectBootRTMR1And2Logs,
+// notifying the observers of every event.
+func expectedDirectBootRTMR1And2Logs(kernelData []byte, initrdData []byte, kernelCmdline string, observers []Observer) (rtmr1Log *EventLog, rtmr2Log *EventLog, err error) {
+	kernelAuthHash, err := authenticode.Parse(bytes.NewReader(kernelData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse kernel authenticode: %w", err)
+	}
+	espFiles := len(kernelData) + len(initrdData)
+	// The kernel's EFI stub measures the cmdline as a tagged event, into PCR9 on a TPM.
+	rtmr1Log, rtmr2Log = expectedBootLogs(espFiles, []Event{authenticodeEvent("kernel", kernelAuthHash)}, initrdData, EvEventTag, kernelCmdline, observers)
+	return rtmr1Log, rtmr2Log, nil
+}
+
+// expectedBootLogs builds the RTMR1 and RTMR2 event logs of a boot loading the given EFI
+// applications from a disk whose ESP holds efiSize bytes of files, with the kernel cmdline
+// measured as an event of cmdlineType. The observers are notified of every event.
+func expectedBootLogs(efiSize int, applications []Event, initrdData []byte, cmdlineType uint32, kernelCmdline string, observers []Observer) (rtmr1Log *EventLog, rtmr2Log *EventLog) {
+	events := []Event{
+		computedEvent(EvEfiAction, "Calling EFI Application from Boot Option", []byte("Calling EFI Application from Boot Option")),
+		computedEvent(EvSeparator, "separator", []byte{0x00, 0x00, 0x00, 0x00}),
+		measuredEvent(EvEfiGptEvent, "UEFI_GPT_DATA", uefiGPTData(efiSize)),
+	}
+	events = append(events, applications...)
+	events = append(events,
+		computedEvent(EvEfiAction, "Exit Boot Services Invocation", []byte("Exit Boot Services Invocation")),
+		computedEvent(EvEfiAction, "Exit Boot Services Returned with Success", []byte("Exit Boot Services Returned with Success")),
+	)
+	rtmr1Log = expectedLog(1, events, observers)
+
+	rtmr2Log = expectedLog(2, []Event{
+		measuredEvent(cmdlineType, "kernel cmdline", kernelCmdlineData(kernelCmdline)),
+		measuredEvent(EvEventTag, "initrd", initrdData),
+	}, observers)
+	return rtmr1Log, rtmr2Log
+}
+
+// MeasureRTMR1And2 computes RTMR1 and RTMR2 from the UKI, initrd, and kernel cmdline (firmware-independent).
+// The observers are notified of every event.
+func MeasureRTMR1And2(kernelData []byte, initrdData []byte, kernelCmdline string, observers ...Observer) (rtmr1 []byte, rtmr2 []byte, err error) {
+	rtmr1Log, rtmr2Log, err := expectedRTMR1And2Logs(kernelData, initrdData, kernelCmdline, observers)
 	if err != nil {
 		return nil, nil, err
 	}
+	return rtmr1Log.RTMR(1), rtmr2Log.RTMR(2), nil
+}
 
-	rtmr1Log := [][]byte{
-		measureSha384([]byte("Calling EFI Application from Boot Option")),
-		measureSha384([]byte{0x00, 0x00, 0x00, 0x00}), // Separator.
-		calculateUEFIDiskGUIDHash(len(kernelData)),
-		ukiAuthHash.Hash(crypto.SHA384),
-		kernelAuthHash.Hash(crypto.SHA384),
-		measureSha384([]byte("Exit Boot Services Invocation")),
-		measureSha384([]byte("Exit Boot Services Returned with Success")),
+// MeasureDirectBootRTMR1And2 computes RTMR1 and RTMR2 of an EFI stub kernel booted directly with
+// the given initrd and kernel cmdline. The observers are notified of every event.
+func MeasureDirectBootRTMR1And2(kernelData []byte, initrdData []byte, kernelCmdline string, observers ...Observer) (rtmr1 []byte, rtmr2 []byte, err error) {
+	rtmr1Log, rtmr2Log, err := expectedDirectBootRTMR1And2Logs(kernelData, initrdData, kernelCmdline, observers)
+	if err != nil {
+		return nil, nil, err
 	}
-	rtmr1 = measureLog(rtmr1Log, debug, "RTMR1")
+	return rtmr1Log.RTMR(1), rtmr2Log.RTMR(2), nil
+}
 
-	rtmr2Log := [][]byte{
-		measureTdxKernelCmdline(kernelCmdline),
-		measureSha384(initrdData),
+// MRAggregated computes SHA256(MRTD || RTMR0 || RTMR1 || RTMR2), the aggregated measurement of
+// the OS and firmware the dstack KMS identifies a TD by.
+func MRAggregated(mrtd []byte, rtmr0 []byte, rtmr1 []byte, rtmr2 []byte) []byte {
+	h := sha256.New()
+	for _, mr := range [][]byte{mrtd, rtmr0, rtmr1, rtmr2} {
+		_, _ = h.Write(mr)
 	}
-	rtmr2 = measureLog(rtmr2Log, debug, "RTMR2")
+	return h.Sum(nil)
+}
 
-	return rtmr1, rtmr2, nil
+// MRImage computes SHA256(MRTD || RTMR1 || RTMR2), the measurement of the OS image independent
+// of the machine configuration, registered with the dstack KMS as an allowed OS image hash.
+func MRImage(mrtd []byte, rtmr1 []byte, rtmr2 []byte) []byte {
+	h := sha256.New()
+	for _, mr := range [][]byte{mrtd, rtmr1, rtmr2} {
+		_, _ = h.Write(mr)
+	}
+	return h.Sum(nil)
 }
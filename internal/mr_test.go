@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// testShapeFirmware returns a synthetic firmware with a CFV and a TD HOB section.
+func testShapeFirmware(t *testing.T) ([]byte, []TdxMetadataSection) {
+	t.Helper()
+	sections := []TdxMetadataSection{
+		{ImageOffset: 0x100, RawDataSize: 0x200, MemoryAddress: 0xffc00000, MemorySize: 0x200, Type: TdxSectionTypeCFV},
+		{MemoryAddress: 0x809000, MemorySize: 0x2000, Type: TdxSectionTypeTdHob},
+	}
+	return testFirmware(t, 0x10000, sections), sections
+}
+
+func TestExpectedRTMR0LogsTdHob(t *testing.T) {
+	// The TD HOB is not computed from a memory size: QEMU's layout has not been reproduced, so
+	// every variant uses the hash captured for its machine configuration.
+	fw, _ := testShapeFirmware(t)
+	catalog := DefaultCatalog()
+	variants, err := NewRegistry(catalog).ExpectedRTMR0Logs(fw, nil, MachineShape{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) == 0 {
+		t.Fatal("no variants")
+	}
+	for _, v := range variants {
+		e := v.Log.Events[0]
+		want := catalog.MachineConfigurations[v.Configuration].TdHobHash
+		if e.Description != "TD HOB" || e.Source != DigestCatalog || !bytes.Equal(e.Digest, want) {
+			t.Errorf("%s: first event = %s %x from %q, want the catalog TD HOB %x", v.Configuration, e.Description, e.Digest, e.Source, want)
+		}
+	}
+	if _, err := NewRegistry(catalog).ExpectedRTMR0Logs(fw, []string{"custom"}, MachineShape{AllowUnverified: true}); err == nil {
+		t.Error("ExpectedRTMR0Logs() measured a machine configuration missing from the catalog")
+	}
+}
+
+func TestExpectedRTMR0LogsAcpi(t *testing.T) {
+	// Every variant measures the ACPI hashes captured for its configuration and epoch.
+	fw, _ := testShapeFirmware(t)
+	catalog := DefaultCatalog()
+	variants, err := NewRegistry(catalog).ExpectedRTMR0Logs(fw, nil, MachineShape{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	epochs := make(map[string][]string)
+	for _, v := range variants {
+		config := catalog.MachineConfigurations[v.Configuration]
+		i := slices.IndexFunc(config.AcpiHashes, func(a AcpiHashes) bool { return a.Epoch == v.AcpiEpoch })
+		if i < 0 {
+			t.Fatalf("%s: unknown ACPI epoch %q", v.Configuration, v.AcpiEpoch)
+		}
+		want := map[string][]byte{
+			"ACPI table loader": config.AcpiHashes[i].AcpiLoaderHash,
+			"ACPI RSDP":         config.AcpiHashes[i].AcpiRsdpHash,
+			"ACPI tables":       config.AcpiHashes[i].AcpiTablesHash,
+		}
+		for _, e := range v.Log.Events {
+			if digest, ok := want[e.Description]; ok {
+				if !bytes.Equal(e.Digest, digest) || e.Source != DigestCatalog {
+					t.Errorf("%s/%s: %s = %x from %q, want the catalog hash %x", v.Configuration, v.AcpiEpoch, e.Description, e.Digest, e.Source, digest)
+				}
+				delete(want, e.Description)
+			}
+		}
+		if len(want) != 0 {
+			t.Errorf("%s/%s: missing ACPI events %v", v.Configuration, v.AcpiEpoch, slices.Sorted(maps.Keys(want)))
+		}
+		if !slices.Contains(epochs[v.Configuration], v.AcpiEpoch) {
+			epochs[v.Configuration] = append(epochs[v.Configuration], v.AcpiEpoch)
+		}
+	}
+	for name, config := range catalog.MachineConfigurations {
+		if len(epochs[name]) != len(config.AcpiHashes) {
+			t.Errorf("%s: measured ACPI epochs %v, want one per catalog epoch", name, epochs[name])
+		}
+	}
+}
+
+func TestMRAggregated(t *testing.T) {
+	mrtd := bytes.Repeat([]byte{1}, 48)
+	rtmr0 := bytes.Repeat([]byte{2}, 48)
+	rtmr1 := bytes.Repeat([]byte{3}, 48)
+	rtmr2 := bytes.Repeat([]byte{4}, 48)
+
+	aggregated := sha256.Sum256(slices.Concat(mrtd, rtmr0, rtmr1, rtmr2))
+	if got := MRAggregated(mrtd, rtmr0, rtmr1, rtmr2); !bytes.Equal(got, aggregated[:]) {
+		t.Errorf("MRAggregated() = %x, want %x", got, aggregated)
+	}
+	image := sha256.Sum256(slices.Concat(mrtd, rtmr1, rtmr2))
+	if got := MRImage(mrtd, rtmr1, rtmr2); !bytes.Equal(got, image[:]) {
+		t.Errorf("MRImage() = %x, want %x", got, image)
+	}
+
+	// Unlike the image hash, the aggregated measurement differs between machine configurations.
+	if bytes.Equal(MRAggregated(mrtd, rtmr1, rtmr1, rtmr2), aggregated[:]) {
+		t.Error("MRAggregated() does not depend on RTMR0")
+	}
+}
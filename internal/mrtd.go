@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	tdxPageSize            = 0x1000
+	tdxMrExtendGranularity = 0x100
+
+	// TdxSectionAttributeMrExtend marks sections whose contents are measured into MRTD.
+	TdxSectionAttributeMrExtend = 0x00000001
+	// TdxSectionAttributePageAug marks sections that are added after TD build, so not measured.
+	TdxSectionAttributePageAug = 0x00000002
+)
+
+// CheckPublishedMRTD compares the MRTD computed by MeasureMRTD with the published MRTD of a
+// firmware image. MeasureMRTD has not been validated against every published firmware, so callers
+// report a mismatch and keep using the published value.
+func CheckPublishedMRTD(fw []byte, published FirmwareMRTD) error {
+	mrtd, err := MeasureMRTD(fw)
+	if err != nil {
+		return fmt.Errorf("failed to calculate MRTD of firmware %s: %w", published.FirmwareFile[:16], err)
+	}
+	if computed := hex.EncodeToString(mrtd); computed != published.MRTD {
+		return fmt.Errorf("computed MRTD %s of firmware %s differs from published MRTD %s", computed, published.FirmwareFile[:16], published.MRTD)
+	}
+	return nil
+}
+
+// MeasureMRTD computes the MRTD of a TD booted with the given TDVF firmware by simulating the
+// TDH.MEM.PAGE.ADD and TDH.MR.EXTEND calls the VMM issues for the TDVF metadata sections.
+// Every page of a section is added and, when the section has the MR_EXTEND attribute, its
+// contents are extended in 256-byte chunks right after the page is added.
+// See: Intel TDX Module ABI specification and KVM's tdx_gmem_post_populate.
+func MeasureMRTD(fw []byte) ([]byte, error) {
+	sections, err := GetTdxMetadataSections(fw)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha512.New384()
+	for i, s := range sections {
+		if s.Attributes&TdxSectionAttributePageAug != 0 {
+			continue
+		}
+		switch s.Type {
+		case TdxSectionTypeBFV, TdxSectionTypeCFV, TdxSectionTypeTdHob, TdxSectionTypeTempMem:
+		default:
+			// Permanent memory and payload sections are not added during TD build.
+			continue
+		}
+
+		if s.MemoryAddress%tdxPageSize != 0 || s.MemorySize%tdxPageSize != 0 {
+			return nil, fmt.Errorf("TDX Firmware Metadata: section %d is not page aligned: %#x+%#x", i, s.MemoryAddress, s.MemorySize)
+		}
+		if uint64(s.RawDataSize) > s.MemorySize {
+			return nil, fmt.Errorf("TDX Firmware Metadata: section %d raw data larger than memory: %#x > %#x", i, s.RawDataSize, s.MemorySize)
+		}
+		if uint64(s.ImageOffset)+uint64(s.RawDataSize) > uint64(len(fw)) {
+			return nil, fmt.Errorf("TDX Firmware Metadata: section %d data outside of firmware: %#x+%#x", i, s.ImageOffset, s.RawDataSize)
+		}
+		data := fw[s.ImageOffset : s.ImageOffset+s.RawDataSize]
+
+		for off := uint64(0); off < s.MemorySize; off += tdxPageSize {
+			gpa := s.MemoryAddress + off
+
+			// TDH.MEM.PAGE.ADD
+			var buf [128]byte
+			copy(buf[:], "MEM.PAGE.ADD")
+			binary.LittleEndian.PutUint64(buf[16:], gpa)
+			_, _ = h.Write(buf[:])
+
+			if s.Attributes&TdxSectionAttributeMrExtend == 0 {
+				continue
+			}
+
+			// TDH.MR.EXTEND, with the page zero-filled past the raw data.
+			var page [tdxPageSize]byte
+			if off < uint64(len(data)) {
+				copy(page[:], data[off:])
+			}
+			for chunk := uint64(0); chunk < tdxPageSize; chunk += tdxMrExtendGranularity {
+				buf = [128]byte{}
+				copy(buf[:], "MR.EXTEND")
+				binary.LittleEndian.PutUint64(buf[16:], gpa+chunk)
+				_, _ = h.Write(buf[:])
+				_, _ = h.Write(page[chunk : chunk+tdxMrExtendGranularity])
+			}
+		}
+	}
+	return h.Sum(nil), nil
+}
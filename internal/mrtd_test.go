@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// testMrtdSections cover every kind of section MeasureMRTD distinguishes: an extended BFV whose raw
+// data is shorter than its memory, a CFV that is only added, the TD HOB and temporary memory, and
+// sections that are never added during TD build.
+var testMrtdSections = []TdxMetadataSection{
+	{ImageOffset: 0x1000, RawDataSize: 0x1800, MemoryAddress: 0xfffe0000, MemorySize: 0x2000, Type: TdxSectionTypeBFV, Attributes: TdxSectionAttributeMrExtend},
+	{ImageOffset: 0x3000, RawDataSize: 0x1000, MemoryAddress: 0xfffd0000, MemorySize: 0x1000, Type: TdxSectionTypeCFV},
+	{MemoryAddress: 0x809000, MemorySize: 0x1000, Type: TdxSectionTypeTdHob},
+	{MemoryAddress: 0x800000, MemorySize: 0x2000, Type: TdxSectionTypeTempMem},
+	{MemoryAddress: 0x900000, MemorySize: 0x1000, Type: TdxSectionTypePermMem},
+	{MemoryAddress: 0x820000, MemorySize: 0x1000, Type: TdxSectionTypeTempMem, Attributes: TdxSectionAttributePageAug},
+}
+
+func testMrtdFirmware(t *testing.T, sections []TdxMetadataSection) []byte {
+	t.Helper()
+	fw := testFirmware(t, 0x10000, sections)
+	for i := 0x1000; i < 0x4000; i++ {
+		fw[i] = byte(i*7 + 3)
+	}
+	return fw
+}
+
+func TestMeasureMRTD(t *testing.T) {
+	// Computed by a separate script implementing the TDH.MEM.PAGE.ADD and TDH.MR.EXTEND
+	// measurements of the Intel TDX Module ABI specification over the same image.
+	const want = "fe1ce9e03a9859c9810b609f10d927eae4c2d47d472606bd1f8ebbe9bfc59140c3a54b7a28e6bd8e5fab05ee714b9843"
+
+	got, err := MeasureMRTD(testMrtdFirmware(t, testMrtdSections))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(got) != want {
+		t.Errorf("MeasureMRTD() = %x, want %s", got, want)
+	}
+}
+
+func TestMeasureMRTDInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		section TdxMetadataSection
+		want    string
+	}{
+		{name: "unaligned", section: TdxMetadataSection{MemoryAddress: 0x800800, MemorySize: 0x1000, Type: TdxSectionTypeTempMem}, want: "not page aligned"},
+		{name: "raw data too large", section: TdxMetadataSection{ImageOffset: 0x1000, RawDataSize: 0x2000, MemoryAddress: 0x800000, MemorySize: 0x1000, Type: TdxSectionTypeBFV}, want: "raw data larger than memory"},
+		{name: "outside of firmware", section: TdxMetadataSection{ImageOffset: 0xf800, RawDataSize: 0x1000, MemoryAddress: 0x800000, MemorySize: 0x1000, Type: TdxSectionTypeBFV}, want: "outside of firmware"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MeasureMRTD(testMrtdFirmware(t, []TdxMetadataSection{tt.section}))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("MeasureMRTD() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryMRTD(t *testing.T) {
+	fw := testMrtdFirmware(t, testMrtdSections)
+	computed, err := MeasureMRTD(fw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := FirmwareMRTD{FirmwareFile: firmwareHash(fw), MRTD: strings.Repeat("ab", 48)}
+
+	// Unlisted firmware falls back to the computed MRTD.
+	r := NewDefaultRegistry()
+	if got, err := r.MRTD(fw); err != nil || !bytes.Equal(got, computed) {
+		t.Errorf("MRTD() of unlisted firmware = %x, %v, want %x", got, err, computed)
+	}
+	// Listed firmware uses its published MRTD even when MeasureMRTD disagrees.
+	if err := r.AddFirmware(published); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.MRTD(fw); err != nil || hex.EncodeToString(got) != published.MRTD {
+		t.Errorf("MRTD() of listed firmware = %x, %v, want %s", got, err, published.MRTD)
+	}
+}
+
+func TestCheckPublishedMRTD(t *testing.T) {
+	fw := testMrtdFirmware(t, testMrtdSections)
+	computed, err := MeasureMRTD(fw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := firmwareHash(fw)
+	if err := CheckPublishedMRTD(fw, FirmwareMRTD{FirmwareFile: hash, MRTD: hex.EncodeToString(computed)}); err != nil {
+		t.Errorf("CheckPublishedMRTD() of the computed MRTD = %v", err)
+	}
+	err = CheckPublishedMRTD(fw, FirmwareMRTD{FirmwareFile: hash, MRTD: strings.Repeat("ab", 48)})
+	if err == nil || !strings.Contains(err.Error(), "differs from published MRTD") {
+		t.Errorf("CheckPublishedMRTD() error = %v, want a mismatch", err)
+	}
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"crypto"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PCRCount is the number of TPM PCRs predicted from the RTMR event logs.
+const PCRCount = 10
+
+// PCRBankAlgorithms lists the hash algorithms of the PCR banks that can be predicted. Only the
+// SHA-384 bank is supported: the catalog records SHA-384 digests only, and every RTMR0 log
+// measures the TD HOB and ACPI hashes from the catalog.
+var PCRBankAlgorithms = []crypto.Hash{crypto.SHA384}
+
+// PCR0Note describes what the predicted PCR0 lacks compared to a TPM's PCR0.
+const PCR0Note = "PCR0 only covers the CFV measured into RTMR0: the TDVF measures the other firmware volumes into MRTD, so the PCR0 events a TPM firmware logs for them are missing"
+
+// eventPCRs returns the PCRs an event extended into an RTMR is extended into on a TPM, reversing
+// the CC-to-PCR mapping of the firmware: PCR0, 1 and 7 map to RTMR0, PCR2-6 to RTMR1 and
+// PCR8-15 to RTMR2. RTMR3 has no PCR counterpart.
+func eventPCRs(e *Event) []int {
+	switch e.Register {
+	case 0:
+		switch e.Type {
+		case EvEfiPlatformFirmwareBlob, EvEfiPlatformFirmwareBlob2:
+			return []int{0}
+		case EvEfiVariableDriverConfig, EvEfiVariableAuthority, EvSeparator:
+			return []int{7}
+		}
+		return []int{1}
+	case 1:
+		switch {
+		case e.Type == EvSeparator:
+			// The firmware extends a single separator into RTMR1 for PCR0-6.
+			return []int{0, 1, 2, 3, 4, 5, 6}
+		case e.Type == EvEfiGptEvent:
+			return []int{5}
+		case e.Type == EvEfiAction && strings.HasPrefix(e.Description, "Exit Boot Services"):
+			return []int{5}
+		}
+		return []int{4}
+	case 2:
+		if e.Type == EvIPL {
+			// systemd-stub measures the kernel cmdline into PCR12, outside of the predicted
+			// PCRs; the kernel's EFI stub tags it and measures it into PCR9 like the initrd.
+			return nil
+		}
+		return []int{9}
+	}
+	return nil
+}
+
+// PredictPCRs replays the RTMR event logs into PCR0-9 of the bank of the given hash algorithm,
+// which must be one of PCRBankAlgorithms. PCR0 is partial, see PCR0Note.
+func PredictPCRs(alg crypto.Hash, logs ...*EventLog) ([PCRCount][]byte, error) {
+	var pcrs [PCRCount][]byte
+	if !slices.Contains(PCRBankAlgorithms, alg) {
+		return pcrs, fmt.Errorf("unsupported PCR bank %s: the catalog only records SHA-384 digests", alg)
+	}
+	for i := range pcrs {
+		pcrs[i] = make([]byte, alg.Size())
+	}
+	for _, log := range logs {
+		for i := range log.Events {
+			e := &log.Events[i]
+			indices := eventPCRs(e)
+			if len(indices) == 0 {
+				continue
+			}
+			digest, err := e.DigestFor(alg)
+			if err != nil {
+				return pcrs, fmt.Errorf("RTMR%d: %w", e.Register, err)
+			}
+			for _, pcr := range indices {
+				pcrs[pcr] = extendDigest(alg, pcrs[pcr], digest)
+			}
+		}
+	}
+	return pcrs, nil
+}
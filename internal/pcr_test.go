@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"bytes"
+	"crypto"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEventPCRs(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  []int
+	}{
+		{name: "CFV", event: Event{Register: 0, Type: EvEfiPlatformFirmwareBlob2}, want: []int{0}},
+		{name: "TD HOB", event: Event{Register: 0, Type: EvEfiHandoffTables2}, want: []int{1}},
+		{name: "Secure Boot", event: Event{Register: 0, Type: EvEfiVariableDriverConfig}, want: []int{7}},
+		{name: "RTMR0 separator", event: Event{Register: 0, Type: EvSeparator}, want: []int{7}},
+		{name: "RTMR1 separator", event: Event{Register: 1, Type: EvSeparator}, want: []int{0, 1, 2, 3, 4, 5, 6}},
+		{name: "GPT", event: Event{Register: 1, Type: EvEfiGptEvent}, want: []int{5}},
+		{name: "exit boot services", event: Event{Register: 1, Type: EvEfiAction, Description: "Exit Boot Services Invocation"}, want: []int{5}},
+		{name: "boot application", event: Event{Register: 1, Type: EvEfiBootServicesApplication}, want: []int{4}},
+		{name: "systemd-stub cmdline", event: Event{Register: 2, Type: EvIPL}, want: nil},
+		{name: "EFI stub cmdline", event: Event{Register: 2, Type: EvEventTag}, want: []int{9}},
+		{name: "RTMR3", event: Event{Register: 3, Type: EvEventTag}, want: nil},
+	}
+	for _, tt := range tests {
+		if got := eventPCRs(&tt.event); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: eventPCRs() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Every event maps into the predicted PCRs or none.
+	for register := range rtmrCount {
+		for eventType := range maps.Keys(eventTypeNames) {
+			for _, pcr := range eventPCRs(&Event{Register: register, Type: eventType}) {
+				if pcr < 0 || pcr >= PCRCount {
+					t.Errorf("eventPCRs(RTMR%d %s) = PCR%d, outside of PCR0-%d", register, EventTypeName(eventType), pcr, PCRCount-1)
+				}
+			}
+		}
+	}
+}
+
+func TestPredictPCRs(t *testing.T) {
+	separator := []byte{0, 0, 0, 0}
+	cmdline := []byte("console=ttyS0")
+	rtmr1 := expectedLog(1, []Event{computedEvent(EvSeparator, "separator", separator)}, nil)
+	rtmr2 := expectedLog(2, []Event{computedEvent(EvIPL, "kernel cmdline", cmdline)}, nil)
+	pcrs, err := PredictPCRs(crypto.SHA384, rtmr1, rtmr2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The separator is extended into PCR0-6 from zero; the systemd-stub cmdline only goes to
+	// PCR12, which is not predicted.
+	want := extendMR(make([]byte, 48), measureSha384(separator))
+	for pcr := range PCRCount {
+		expected := make([]byte, 48)
+		if pcr <= 6 {
+			expected = want
+		}
+		if !bytes.Equal(pcrs[pcr], expected) {
+			t.Errorf("PCR%d = %x, want %x", pcr, pcrs[pcr], expected)
+		}
+	}
+
+	// Catalog digests are only recorded in SHA-384, so that is the only supported bank.
+	catalogLog := expectedLog(0, []Event{digestEvent(EvEfiHandoffTables2, "TD HOB", make([]byte, 48), DigestCatalog)}, nil)
+	if _, err := PredictPCRs(crypto.SHA384, catalogLog); err != nil {
+		t.Errorf("PredictPCRs(SHA384) = %v", err)
+	}
+	for _, log := range []*EventLog{catalogLog, rtmr1} {
+		if _, err := PredictPCRs(crypto.SHA256, log); err == nil || !strings.Contains(err.Error(), "unsupported PCR bank SHA-256") {
+			t.Errorf("PredictPCRs(SHA256) error = %v, want unsupported PCR bank", err)
+		}
+	}
+}
+
+func TestEventDigestFor(t *testing.T) {
+	data := []byte("cmdline")
+	computed := computedEvent(EvIPL, "cmdline", data)
+	tests := []struct {
+		name  string
+		event Event
+		alg   crypto.Hash
+		want  []byte
+		err   string
+	}{
+		{name: "SHA-384", event: computed, alg: crypto.SHA384, want: measureSha384(data)},
+		{name: "SHA-256 of measured data", event: computed, alg: crypto.SHA256, want: measureDigest(crypto.SHA256, data)},
+		{name: "SHA-256 of catalog digest", event: digestEvent(EvEfiHandoffTables2, "TD HOB", make([]byte, 48), DigestCatalog), alg: crypto.SHA256, err: "only the SHA-384 digest is in the catalog"},
+		{name: "SHA-256 of observed digest", event: Event{Description: "observed", Digest: make([]byte, 48)}, alg: crypto.SHA256, err: "the measured data is unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.event.DigestFor(tt.alg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("DigestFor() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("DigestFor() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
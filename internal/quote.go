@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	tdxQuoteHeaderSize = 48
+	tdxTeeType         = 0x00000081
+
+	// TD report body types of a v5 quote.
+	tdxQuoteBodyTd10 = 2
+	tdxQuoteBodyTd15 = 3
+
+	tdReport10Size = 584
+	tdReport15Size = 648
+)
+
+// TdxQuote holds the TD report fields of a TDX quote. The quote signature is not verified.
+type TdxQuote struct {
+	Version        uint16
+	TeeTcbSvn      []byte
+	MrSeam         []byte
+	MrSignerSeam   []byte
+	SeamAttributes []byte
+	TdAttributes   []byte
+	XFAM           []byte
+	MRTD           []byte
+	MrConfigID     []byte
+	MrOwner        []byte
+	MrOwnerConfig  []byte
+	RTMR           [4][]byte
+	ReportData     []byte
+}
+
+// ParseTdxQuote parses a version 4 or 5 TDX quote.
+// See: Intel TDX DCAP Quoting Library API, appendix A.
+func ParseTdxQuote(data []byte) (*TdxQuote, error) {
+	if len(data) < tdxQuoteHeaderSize {
+		return nil, fmt.Errorf("TDX quote: too short: %d bytes", len(data))
+	}
+	version := binary.LittleEndian.Uint16(data[0:2])
+	if teeType := binary.LittleEndian.Uint32(data[4:8]); teeType != tdxTeeType {
+		return nil, fmt.Errorf("TDX quote: not a TDX quote (TEE type %#x)", teeType)
+	}
+
+	var body []byte
+	switch version {
+	case 4:
+		body = data[tdxQuoteHeaderSize:]
+		if len(body) < tdReport10Size {
+			return nil, fmt.Errorf("TDX quote: truncated TD report")
+		}
+	case 5:
+		if len(data) < tdxQuoteHeaderSize+6 {
+			return nil, fmt.Errorf("TDX quote: truncated body descriptor")
+		}
+		bodyType := binary.LittleEndian.Uint16(data[tdxQuoteHeaderSize:])
+		bodySize := binary.LittleEndian.Uint32(data[tdxQuoteHeaderSize+2:])
+		switch {
+		case bodyType == tdxQuoteBodyTd10 && bodySize == tdReport10Size:
+		case bodyType == tdxQuoteBodyTd15 && bodySize == tdReport15Size:
+		default:
+			return nil, fmt.Errorf("TDX quote: unsupported body type %d with size %d", bodyType, bodySize)
+		}
+		body = data[tdxQuoteHeaderSize+6:]
+		if uint32(len(body)) < bodySize {
+			return nil, fmt.Errorf("TDX quote: truncated TD report")
+		}
+	default:
+		return nil, fmt.Errorf("TDX quote: unsupported version %d", version)
+	}
+
+	// Both TD report layouts share the TDX 1.0 prefix.
+	off := 0
+	field := func(size int) []byte {
+		f := body[off : off+size]
+		off += size
+		return f
+	}
+	q := &TdxQuote{Version: version}
+	q.TeeTcbSvn = field(16)
+	q.MrSeam = field(48)
+	q.MrSignerSeam = field(48)
+	q.SeamAttributes = field(8)
+	q.TdAttributes = field(8)
+	q.XFAM = field(8)
+	q.MRTD = field(48)
+	q.MrConfigID = field(48)
+	q.MrOwner = field(48)
+	q.MrOwnerConfig = field(48)
+	for i := range q.RTMR {
+		q.RTMR[i] = field(48)
+	}
+	q.ReportData = field(64)
+	return q, nil
+}
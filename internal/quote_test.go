@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// testQuote builds a quote whose MRTD, RTMR0-3 and REPORTDATA are filled with distinct bytes at
+// their offsets in the TD report body, which starts at bodyOffset.
+func testQuote(version uint16, bodyOffset int, bodySize int) []byte {
+	q := make([]byte, bodyOffset+bodySize+4)
+	binary.LittleEndian.PutUint16(q[0:], version)
+	binary.LittleEndian.PutUint32(q[4:], tdxTeeType)
+	copy(q[bodyOffset+136:], bytes.Repeat([]byte{0xd0}, 48))
+	for i := range 4 {
+		copy(q[bodyOffset+328+48*i:], bytes.Repeat([]byte{0xe0 + byte(i)}, 48))
+	}
+	copy(q[bodyOffset+520:], bytes.Repeat([]byte{0xf0}, 64))
+	return q
+}
+
+func TestParseTdxQuote(t *testing.T) {
+	v5 := func(bodyType uint16, bodySize int) []byte {
+		q := testQuote(5, tdxQuoteHeaderSize+6, bodySize)
+		binary.LittleEndian.PutUint16(q[tdxQuoteHeaderSize:], bodyType)
+		binary.LittleEndian.PutUint32(q[tdxQuoteHeaderSize+2:], uint32(bodySize))
+		return q
+	}
+	tests := []struct {
+		name    string
+		quote   []byte
+		wantErr string
+	}{
+		// In a v4 quote MRTD starts at byte 184, RTMR0 at 376 and REPORTDATA at 568.
+		{name: "v4", quote: testQuote(4, tdxQuoteHeaderSize, tdReport10Size)},
+		{name: "v5 TDX 1.0", quote: v5(tdxQuoteBodyTd10, tdReport10Size)},
+		{name: "v5 TDX 1.5", quote: v5(tdxQuoteBodyTd15, tdReport15Size)},
+		{name: "v5 size mismatch", quote: v5(tdxQuoteBodyTd15, tdReport10Size), wantErr: "unsupported body type"},
+		{name: "v3", quote: testQuote(3, tdxQuoteHeaderSize, tdReport10Size), wantErr: "unsupported version"},
+		{name: "truncated", quote: testQuote(4, tdxQuoteHeaderSize, tdReport10Size)[:tdxQuoteHeaderSize+100], wantErr: "truncated"},
+		{name: "too short", quote: make([]byte, 10), wantErr: "too short"},
+		{name: "SGX", quote: func() []byte {
+			q := testQuote(4, tdxQuoteHeaderSize, tdReport10Size)
+			binary.LittleEndian.PutUint32(q[4:], 0)
+			return q
+		}(), wantErr: "not a TDX quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseTdxQuote(tt.quote)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseTdxQuote() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(q.MRTD, bytes.Repeat([]byte{0xd0}, 48)) {
+				t.Errorf("MRTD = %x", q.MRTD)
+			}
+			for i, rtmr := range q.RTMR {
+				if !bytes.Equal(rtmr, bytes.Repeat([]byte{0xe0 + byte(i)}, 48)) {
+					t.Errorf("RTMR%d = %x", i, rtmr)
+				}
+			}
+			if !bytes.Equal(q.ReportData, bytes.Repeat([]byte{0xf0}, 64)) {
+				t.Errorf("ReportData = %x", q.ReportData)
+			}
+		})
+	}
+}
+
+func TestParseTdxQuoteV4Offsets(t *testing.T) {
+	q := make([]byte, tdxQuoteHeaderSize+tdReport10Size)
+	binary.LittleEndian.PutUint16(q[0:], 4)
+	binary.LittleEndian.PutUint32(q[4:], tdxTeeType)
+	q[184], q[376], q[568] = 0x01, 0x02, 0x03
+	quote, err := ParseTdxQuote(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.MRTD[0] != 0x01 || quote.RTMR[0][0] != 0x02 || quote.ReportData[0] != 0x03 {
+		t.Errorf("MRTD, RTMR0 and REPORTDATA not read from quote offsets 184, 376 and 568")
+	}
+}
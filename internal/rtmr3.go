@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// EvDstackRuntimeEvent is the event type of the runtime events dstack extends into RTMR3.
+const EvDstackRuntimeEvent = 0x08000001
+
+const (
+	appIDSize       = 20
+	composeHashSize = sha256.Size
+)
+
+// RuntimeEvent is an event the dstack guest extends into RTMR3 at runtime.
+type RuntimeEvent struct {
+	Name    string
+	Payload []byte
+}
+
+// Event returns the measured event. Its digest covers the event type, name and payload, as
+// "type:name:payload" with the type encoded as a little-endian uint32.
+func (r RuntimeEvent) Event() Event {
+	data := binary.LittleEndian.AppendUint32(nil, EvDstackRuntimeEvent)
+	data = append(data, ':')
+	data = append(data, r.Name...)
+	data = append(data, ':')
+	data = append(data, r.Payload...)
+	return computedEvent(EvDstackRuntimeEvent, r.Name, data)
+}
+
+// KeyProvider identifies the provider of the app keys.
+type KeyProvider struct {
+	// Name is the kind of provider, e.g. "kms" or "local".
+	Name string `json:"name"`
+	// ID identifies the provider instance, e.g. the hex-encoded public key of the KMS root CA.
+	ID string `json:"id"`
+}
+
+// ParseKeyProvider parses a key provider given as name:id, e.g. kms:<hex id>.
+func ParseKeyProvider(s string) (KeyProvider, error) {
+	name, id, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return KeyProvider{}, fmt.Errorf("invalid key provider %q: expected name:id", s)
+	}
+	return KeyProvider{Name: name, ID: id}, nil
+}
+
+// AppDeployment identifies a dstack app deployment, as measured into RTMR3.
+type AppDeployment struct {
+	// ComposeHash is the SHA-256 of the app's app-compose.json.
+	ComposeHash []byte
+	AppID       []byte
+	// InstanceID is empty for apps deployed without an instance ID.
+	InstanceID  []byte
+	KeyProvider KeyProvider
+	// EventOrder lists the names of the runtime events in the order the guest extends them, which
+	// differs between dstack versions. Nil selects DefaultRuntimeEventOrder.
+	EventOrder []string
+}
+
+// DefaultRuntimeEventOrder is the order in which current dstack guests extend the runtime events
+// of a boot.
+var DefaultRuntimeEventOrder = []string{
+	"system-preparing",
+	"app-id",
+	"compose-hash",
+	"instance-id",
+	"boot-mr-done",
+	"key-provider",
+	"system-ready",
+}
+
+// RuntimeEvents returns the runtime events of a boot of the deployment, in the order the dstack
+// guest extends them, see EventOrder.
+func (d *AppDeployment) RuntimeEvents() ([]RuntimeEvent, error) {
+	if len(d.ComposeHash) != composeHashSize {
+		return nil, fmt.Errorf("compose hash: expected %d bytes, got %d", composeHashSize, len(d.ComposeHash))
+	}
+	if len(d.AppID) != appIDSize {
+		return nil, fmt.Errorf("app ID: expected %d bytes, got %d", appIDSize, len(d.AppID))
+	}
+	keyProvider, err := json.Marshal(d.KeyProvider)
+	if err != nil {
+		return nil, err
+	}
+	payloads := map[string][]byte{
+		"system-preparing": nil,
+		"app-id":           d.AppID,
+		"compose-hash":     d.ComposeHash,
+		"instance-id":      d.InstanceID,
+		"boot-mr-done":     nil,
+		"key-provider":     keyProvider,
+		"system-ready":     nil,
+	}
+	order := d.EventOrder
+	if order == nil {
+		order = DefaultRuntimeEventOrder
+	}
+	events := make([]RuntimeEvent, 0, len(order))
+	for _, name := range order {
+		payload, ok := payloads[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown runtime event %q", name)
+		}
+		events = append(events, RuntimeEvent{Name: name, Payload: payload})
+	}
+	return events, nil
+}
+
+// ExpectedRTMR3Log builds the expected RTMR3 event log of a deployment.
+func ExpectedRTMR3Log(d *AppDeployment) (*EventLog, error) {
+	return expectedRTMR3Log(d, nil)
+}
+
+// expectedRTMR3Log builds the log like ExpectedRTMR3Log, notifying the observers of every event.
+func expectedRTMR3Log(d *AppDeployment, observers []Observer) (*EventLog, error) {
+	runtimeEvents, err := d.RuntimeEvents()
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	for _, r := range runtimeEvents {
+		events = append(events, r.Event())
+	}
+	return expectedLog(3, events, observers), nil
+}
+
+// MeasureRTMR3 computes RTMR3 of a deployment. The observers are notified of every event.
+func MeasureRTMR3(d *AppDeployment, observers ...Observer) ([]byte, error) {
+	log, err := expectedRTMR3Log(d, observers)
+	if err != nil {
+		return nil, err
+	}
+	return log.RTMR(3), nil
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeEventDigest(t *testing.T) {
+	// The digest covers the little-endian event type, the name and the payload.
+	e := RuntimeEvent{Name: "app-id", Payload: []byte{0xde, 0xad}}.Event()
+	want := measureSha384([]byte("\x01\x00\x00\x08:app-id:\xde\xad"))
+	if !bytes.Equal(e.Digest, want) {
+		t.Errorf("digest = %x, want %x", e.Digest, want)
+	}
+	if e.Type != EvDstackRuntimeEvent || e.Description != "app-id" {
+		t.Errorf("event = %+v", e)
+	}
+}
+
+func TestRuntimeEvents(t *testing.T) {
+	d := AppDeployment{
+		ComposeHash: bytes.Repeat([]byte{0x11}, composeHashSize),
+		AppID:       bytes.Repeat([]byte{0x22}, appIDSize),
+		KeyProvider: KeyProvider{Name: "kms", ID: "ab"},
+	}
+	tests := []struct {
+		name    string
+		order   []string
+		want    []string
+		wantErr string
+	}{
+		{name: "default", want: DefaultRuntimeEventOrder},
+		{name: "without key provider", order: []string{"system-preparing", "app-id", "compose-hash", "instance-id", "boot-mr-done", "system-ready"}, want: []string{"system-preparing", "app-id", "compose-hash", "instance-id", "boot-mr-done", "system-ready"}},
+		{name: "unknown", order: []string{"system-preparing", "rootfs-hash"}, wantErr: "unknown runtime event"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := d
+			d.EventOrder = tt.order
+			events, err := d.RuntimeEvents()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RuntimeEvents() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range events {
+				names = append(names, e.Name)
+				if e.Name == "key-provider" && string(e.Payload) != `{"name":"kms","id":"ab"}` {
+					t.Errorf("key-provider payload = %s", e.Payload)
+				}
+				if e.Name == "compose-hash" && !bytes.Equal(e.Payload, d.ComposeHash) {
+					t.Errorf("compose-hash payload = %x", e.Payload)
+				}
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	// RTMR3 extends every runtime event in order.
+	events, err := d.RuntimeEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := make([]byte, 48)
+	for _, e := range events {
+		mr = extendMR(mr, e.Event().Digest)
+	}
+	var observed []string
+	rtmr3, err := MeasureRTMR3(&d, ObserverFunc(func(index int, e *Event, value []byte) {
+		observed = append(observed, e.Description)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rtmr3, mr) {
+		t.Errorf("MeasureRTMR3() = %x, want %x", rtmr3, mr)
+	}
+	// The observer sees the single replay of the log, each event once.
+	if !slices.Equal(observed, DefaultRuntimeEventOrder) {
+		t.Errorf("MeasureRTMR3() observed %v, want %v", observed, DefaultRuntimeEventOrder)
+	}
+
+	d.AppID = d.AppID[:19]
+	if _, err := d.RuntimeEvents(); err == nil || !strings.Contains(err.Error(), "app ID: expected 20 bytes") {
+		t.Errorf("RuntimeEvents() error = %v, want an app ID size error", err)
+	}
+}
+
+func TestTcbInfoRuntimeEventNames(t *testing.T) {
+	payload, _ := hex.DecodeString("11")
+	info := TcbInfo{EventLog: []TcbInfoEvent{
+		{IMR: 0, EventType: EvEfiAction},
+		{IMR: 3, EventType: EvDstackRuntimeEvent, Event: "system-preparing"},
+		{IMR: 3, EventType: EvDstackRuntimeEvent, Event: "app-id", EventPayload: payload},
+	}}
+	if got, want := info.RuntimeEventNames(), []string{"system-preparing", "app-id"}; !slices.Equal(got, want) {
+		t.Errorf("RuntimeEventNames() = %v, want %v", got, want)
+	}
+}
+
+func TestParseKeyProvider(t *testing.T) {
+	if p, err := ParseKeyProvider("kms:0123"); err != nil || p != (KeyProvider{Name: "kms", ID: "0123"}) {
+		t.Errorf("ParseKeyProvider() = %+v, %v", p, err)
+	}
+	if _, err := ParseKeyProvider("kms"); err == nil {
+		t.Error("ParseKeyProvider() accepted a provider without an ID")
+	}
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultFirmwareBaseURL is where GCE publishes its TDX firmware images.
+const DefaultFirmwareBaseURL = "https://storage.googleapis.com/gce_tcb_integrity/ovmf_x64_csm"
+
+// FirmwareSource provides firmware images by their SHA-384 hash. Sources do not need to verify
+// the contents; use FetchFirmware for that.
+type FirmwareSource interface {
+	Fetch(ctx context.Context, hash string) ([]byte, error)
+}
+
+// FetchFirmware fetches the firmware with the given hash from src and verifies its SHA-384.
+func FetchFirmware(ctx context.Context, src FirmwareSource, hash string) ([]byte, error) {
+	if err := validateFirmwareHash(hash); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := src.Fetch(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyFirmwareHash(hash, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// HTTPFirmwareSource downloads firmware from BaseURL/<hash>.fd. It serves both the GCS bucket and
+// mirrors of it.
+type HTTPFirmwareSource struct {
+	BaseURL string
+	// Client is used for requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// NewHTTPFirmwareSource returns a source for the given base URL, or the GCE bucket if it is empty.
+func NewHTTPFirmwareSource(baseURL string) *HTTPFirmwareSource {
+	if baseURL == "" {
+		baseURL = DefaultFirmwareBaseURL
+	}
+	return &HTTPFirmwareSource{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (s *HTTPFirmwareSource) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s%s", s.BaseURL, hash, firmwareCacheExt)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download firmware file %s: %w", hash[:16], err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download firmware file %s: %s", hash[:16], resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firmware data: %w", err)
+	}
+	return data, nil
+}
+
+// FSFirmwareSource reads firmware from <hash>.fd files in a file system, such as a local directory
+// or an embedded bundle.
+type FSFirmwareSource struct {
+	FS fs.FS
+}
+
+// NewDirFirmwareSource returns a source reading firmware from a local directory.
+func NewDirFirmwareSource(dir string) *FSFirmwareSource {
+	return &FSFirmwareSource{FS: os.DirFS(dir)}
+}
+
+func (s *FSFirmwareSource) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	data, err := fs.ReadFile(s.FS, hash+firmwareCacheExt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firmware file %s: %w", hash[:16], err)
+	}
+	return data, nil
+}
+
+// CachedFirmwareSource serves firmware from a FirmwareCache and fills it from Source on misses.
+type CachedFirmwareSource struct {
+	Cache  *FirmwareCache
+	Source FirmwareSource
+	// Warn, if set, is called for cache errors that do not prevent fetching from Source, such as
+	// a cache directory that cannot be written.
+	Warn func(err error)
+}
+
+func (s *CachedFirmwareSource) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	data, err := s.Cache.Get(hash)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) && s.Warn != nil {
+		s.Warn(err)
+	}
+
+	data, err = s.Source.Fetch(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// A bad download never enters the cache, and fails the fetch.
+	if err := VerifyFirmwareHash(hash, data); err != nil {
+		return nil, err
+	}
+	// The firmware is usable even if it cannot be cached.
+	if err := s.Cache.Put(hash, data); err != nil && s.Warn != nil {
+		s.Warn(err)
+	}
+	return data, nil
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+// testFirmwareServer serves the given firmware images as <sha384>.fd and counts the requests.
+func testFirmwareServer(t *testing.T, files map[string][]byte) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		data, ok := files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestFetchFirmware(t *testing.T) {
+	good := []byte("published firmware")
+	goodHash := firmwareHash(good)
+	// A file whose contents do not match the hash it is served under.
+	badHash := firmwareHash([]byte("other firmware"))
+	missingHash := firmwareHash([]byte("missing firmware"))
+	srv, _ := testFirmwareServer(t, map[string][]byte{
+		goodHash + ".fd": good,
+		badHash + ".fd":  []byte("tampered firmware"),
+	})
+
+	tests := []struct {
+		name    string
+		src     FirmwareSource
+		hash    string
+		wantErr error
+		want    string
+	}{
+		{name: "http", src: NewHTTPFirmwareSource(srv.URL + "/"), hash: goodHash},
+		{name: "http tampered", src: NewHTTPFirmwareSource(srv.URL), hash: badHash, wantErr: ErrFirmwareHashMismatch},
+		{name: "http missing", src: NewHTTPFirmwareSource(srv.URL), hash: missingHash, want: "404"},
+		{name: "invalid hash", src: NewHTTPFirmwareSource(srv.URL), hash: "../etc/passwd", want: "invalid firmware hash"},
+		{name: "fs", src: &FSFirmwareSource{FS: fstest.MapFS{goodHash + ".fd": {Data: good}}}, hash: goodHash},
+		{name: "fs missing", src: &FSFirmwareSource{FS: fstest.MapFS{}}, hash: goodHash, wantErr: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := FetchFirmware(context.Background(), tt.src, tt.hash)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FetchFirmware() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.want != "":
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("FetchFirmware() error = %v, want %q", err, tt.want)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !bytes.Equal(data, good):
+				t.Errorf("FetchFirmware() = %q, want %q", data, good)
+			}
+		})
+	}
+}
+
+func TestFetchFirmwareCanceled(t *testing.T) {
+	srv, _ := testFirmwareServer(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := FetchFirmware(ctx, NewHTTPFirmwareSource(srv.URL), firmwareHash(nil))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("FetchFirmware() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCachedFirmwareSource(t *testing.T) {
+	fw := []byte("published firmware")
+	hash := firmwareHash(fw)
+	srv, requests := testFirmwareServer(t, map[string][]byte{hash + ".fd": fw})
+
+	cache, err := NewFirmwareCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &CachedFirmwareSource{Cache: cache, Source: NewHTTPFirmwareSource(srv.URL)}
+	for range 2 {
+		data, err := FetchFirmware(context.Background(), src, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, fw) {
+			t.Errorf("FetchFirmware() = %q, want %q", data, fw)
+		}
+	}
+	// The second fetch is served from the cache.
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server got %d requests, want 1", got)
+	}
+}
+
+func TestCachedFirmwareSourceUnwritableCache(t *testing.T) {
+	fw := []byte("published firmware")
+	hash := firmwareHash(fw)
+	srv, _ := testFirmwareServer(t, map[string][]byte{hash + ".fd": fw})
+
+	// A cache directory below a regular file can be neither read nor written.
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []error
+	src := &CachedFirmwareSource{
+		Cache:  &FirmwareCache{Dir: filepath.Join(file, "cache")},
+		Source: NewHTTPFirmwareSource(srv.URL),
+		Warn:   func(err error) { warnings = append(warnings, err) },
+	}
+	data, err := FetchFirmware(context.Background(), src, hash)
+	if err != nil {
+		t.Fatalf("FetchFirmware() error = %v, want the downloaded firmware", err)
+	}
+	if !bytes.Equal(data, fw) {
+		t.Errorf("FetchFirmware() = %q, want %q", data, fw)
+	}
+	if len(warnings) == 0 {
+		t.Error("no warning for the failed cache write")
+	}
+}
+
+func TestCachedFirmwareSourceTampered(t *testing.T) {
+	hash := firmwareHash([]byte("published firmware"))
+	srv, _ := testFirmwareServer(t, map[string][]byte{hash + ".fd": []byte("tampered firmware")})
+	cache, err := NewFirmwareCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &CachedFirmwareSource{Cache: cache, Source: NewHTTPFirmwareSource(srv.URL)}
+	if _, err := src.Fetch(context.Background(), hash); !errors.Is(err, ErrFirmwareHashMismatch) {
+		t.Fatalf("Fetch() error = %v, want ErrFirmwareHashMismatch", err)
+	}
+	if _, err := cache.Get(hash); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("cache.Get() error = %v, want the tampered firmware not cached", err)
+	}
+}
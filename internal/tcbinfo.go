@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// TcbInfoEvent is an event of the event log in a dstack tcb_info document.
+type TcbInfoEvent struct {
+	// IMR is the RTMR index the event was extended into.
+	IMR       uint32   `json:"imr"`
+	EventType uint32   `json:"event_type"`
+	Digest    HexBytes `json:"digest"`
+	// Event is the name of a runtime event.
+	Event        string   `json:"event"`
+	EventPayload HexBytes `json:"event_payload"`
+}
+
+// TcbInfo is the tcb_info document reported by the dstack guest agent.
+type TcbInfo struct {
+	MRTD       HexBytes       `json:"mrtd"`
+	RTMR0      HexBytes       `json:"rtmr0"`
+	RTMR1      HexBytes       `json:"rtmr1"`
+	RTMR2      HexBytes       `json:"rtmr2"`
+	RTMR3      HexBytes       `json:"rtmr3"`
+	EventLog   []TcbInfoEvent `json:"event_log"`
+	AppCompose string         `json:"app_compose"`
+}
+
+// ParseTcbInfo parses a tcb_info document. It also accepts a guest agent info response, which
+// carries the document as a JSON string in its tcb_info field.
+func ParseTcbInfo(data []byte) (*TcbInfo, error) {
+	var wrapper struct {
+		TcbInfo *string `json:"tcb_info"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return nil, fmt.Errorf("tcb info: %w", err)
+	}
+	if wrapper.TcbInfo != nil {
+		data = []byte(*wrapper.TcbInfo)
+	}
+	var info TcbInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("tcb info: %w", err)
+	}
+	return &info, nil
+}
+
+// RTMRs returns the reported RTMR values.
+func (t *TcbInfo) RTMRs() [rtmrCount][]byte {
+	return [rtmrCount][]byte{t.RTMR0, t.RTMR1, t.RTMR2, t.RTMR3}
+}
+
+// Log returns the log of the events extended into RTMR0-3. EV_NO_ACTION events are not extended.
+func (t *TcbInfo) Log() (*EventLog, error) {
+	log := NewEventLog()
+	for i, e := range t.EventLog {
+		if e.EventType == EvNoAction {
+			continue
+		}
+		description := e.Event
+		if description == "" {
+			description = EventTypeName(e.EventType)
+		}
+		err := log.Extend(Event{
+			Register:    int(e.IMR),
+			Type:        e.EventType,
+			Description: description,
+			Digest:      e.Digest,
+			Preimage:    e.EventPayload,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tcb info: event %d: %w", i, err)
+		}
+	}
+	return log, nil
+}
+
+// CheckRuntimeEvents checks that the digest of every runtime event matches its name and payload.
+func (t *TcbInfo) CheckRuntimeEvents() error {
+	for i, e := range t.EventLog {
+		if e.EventType != EvDstackRuntimeEvent {
+			continue
+		}
+		if e.IMR != 3 {
+			return fmt.Errorf("runtime event %d (%s) extended into RTMR%d instead of RTMR3", i, e.Event, e.IMR)
+		}
+		expected := RuntimeEvent{Name: e.Event, Payload: e.EventPayload}.Event().Digest
+		if !bytes.Equal(e.Digest, expected) {
+			return fmt.Errorf("runtime event %d (%s): digest %x does not match its payload (expected %x)", i, e.Event, e.Digest, expected)
+		}
+	}
+	return nil
+}
+
+// BootRuntimeEventPayload returns the payload of the named runtime event at its position in the
+// boot event order. Apps may extend events of any name after boot, so a later event with the same
+// name never replaces the one measured at boot.
+func (t *TcbInfo) BootRuntimeEventPayload(eventOrder []string, name string) ([]byte, error) {
+	pos := slices.Index(eventOrder, name)
+	if pos < 0 {
+		return nil, fmt.Errorf("%s is not a boot runtime event", name)
+	}
+	i := 0
+	for _, e := range t.EventLog {
+		if e.EventType != EvDstackRuntimeEvent {
+			continue
+		}
+		if i == pos {
+			if e.Event != name {
+				return nil, fmt.Errorf("runtime event %d is %s, expected %s", pos, e.Event, name)
+			}
+			return e.EventPayload, nil
+		}
+		i++
+	}
+	return nil, fmt.Errorf("no %s event in the event log", name)
+}
+
+// RuntimeEventNames returns the names of the runtime events in the order they were extended.
+func (t *TcbInfo) RuntimeEventNames() []string {
+	var names []string
+	for _, e := range t.EventLog {
+		if e.EventType == EvDstackRuntimeEvent {
+			names = append(names, e.Event)
+		}
+	}
+	return names
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testTcbInfo returns the tcb_info of a boot with an RTMR1 event and the given runtime events,
+// with RTMR values replayed from the events.
+func testTcbInfo(runtimeEvents ...RuntimeEvent) *TcbInfo {
+	info := &TcbInfo{EventLog: []TcbInfoEvent{
+		{IMR: 0, EventType: EvNoAction, Digest: make([]byte, 48)},
+		{IMR: 1, EventType: EvEfiAction, Digest: measureSha384([]byte("action"))},
+	}}
+	for _, r := range runtimeEvents {
+		info.EventLog = append(info.EventLog, TcbInfoEvent{
+			IMR:          3,
+			EventType:    EvDstackRuntimeEvent,
+			Digest:       r.Event().Digest,
+			Event:        r.Name,
+			EventPayload: r.Payload,
+		})
+	}
+	rtmrs := [rtmrCount][]byte{}
+	for i := range rtmrs {
+		rtmrs[i] = make([]byte, 48)
+	}
+	for _, e := range info.EventLog[1:] {
+		rtmrs[e.IMR] = extendMR(rtmrs[e.IMR], e.Digest)
+	}
+	info.RTMR0, info.RTMR1, info.RTMR2, info.RTMR3 = rtmrs[0], rtmrs[1], rtmrs[2], rtmrs[3]
+	return info
+}
+
+func TestParseTcbInfo(t *testing.T) {
+	info := testTcbInfo(RuntimeEvent{Name: "app-id", Payload: []byte{0x22}})
+	info.AppCompose = `{"runner":"bash"}`
+	doc, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := json.Marshal(map[string]any{"app_id": "22", "tcb_info": string(doc)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"document": doc, "info response": wrapped} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseTcbInfo(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.AppCompose != info.AppCompose || len(got.EventLog) != 3 || !bytes.Equal(got.RTMR3, info.RTMR3) {
+				t.Errorf("ParseTcbInfo() = %+v, want %+v", got, info)
+			}
+		})
+	}
+
+	if _, err := ParseTcbInfo([]byte(`{"tcb_info": "not json"}`)); err == nil || !strings.Contains(err.Error(), "tcb info") {
+		t.Errorf("ParseTcbInfo() error = %v, want a tcb info error", err)
+	}
+}
+
+func TestTcbInfoLog(t *testing.T) {
+	info := testTcbInfo(RuntimeEvent{Name: "system-preparing"}, RuntimeEvent{Name: "app-id", Payload: []byte{0x22}})
+	log, err := info.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The EV_NO_ACTION event is not extended.
+	if len(log.Events) != 3 || log.Events[2].Description != "app-id" || log.Events[0].Description != "EV_EFI_ACTION" {
+		t.Errorf("Log() events = %+v", log.Events)
+	}
+	if got, want := log.RTMRs(), info.RTMRs(); !equalRTMRs(got, want) {
+		t.Errorf("Log() RTMRs = %x, want %x", got, want)
+	}
+
+	info.EventLog = append(info.EventLog, TcbInfoEvent{IMR: 4, EventType: EvEfiAction})
+	if _, err := info.Log(); err == nil || !strings.Contains(err.Error(), "event 4: event log: invalid register 4") {
+		t.Errorf("Log() error = %v, want an invalid register error", err)
+	}
+}
+
+func TestCheckRuntimeEvents(t *testing.T) {
+	composeHash := bytes.Repeat([]byte{0x11}, composeHashSize)
+	tests := []struct {
+		name   string
+		modify func(*TcbInfo)
+		want   string
+	}{
+		{name: "valid", modify: func(*TcbInfo) {}},
+		{name: "tampered payload", modify: func(info *TcbInfo) { info.EventLog[3].EventPayload = bytes.Repeat([]byte{0x12}, composeHashSize) }, want: "runtime event 3 (compose-hash): digest"},
+		{name: "wrong register", modify: func(info *TcbInfo) { info.EventLog[2].IMR = 2 }, want: "extended into RTMR2 instead of RTMR3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := testTcbInfo(RuntimeEvent{Name: "app-id", Payload: []byte{0x22}}, RuntimeEvent{Name: "compose-hash", Payload: composeHash})
+			tt.modify(info)
+			err := info.CheckRuntimeEvents()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("CheckRuntimeEvents() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBootRuntimeEventPayload(t *testing.T) {
+	order := []string{"app-id", "system-ready"}
+	info := testTcbInfo(
+		RuntimeEvent{Name: "app-id", Payload: []byte{0x22}},
+		RuntimeEvent{Name: "system-ready"},
+		RuntimeEvent{Name: "app-id", Payload: []byte{0x33}},
+	)
+	// The app-id extended after boot does not replace the boot one.
+	if payload, err := info.BootRuntimeEventPayload(order, "app-id"); err != nil || hex.EncodeToString(payload) != "22" {
+		t.Errorf("BootRuntimeEventPayload(app-id) = %x, %v", payload, err)
+	}
+	if payload, err := info.BootRuntimeEventPayload(order, "system-ready"); err != nil || len(payload) != 0 {
+		t.Errorf("BootRuntimeEventPayload(system-ready) = %x, %v", payload, err)
+	}
+	if _, err := info.BootRuntimeEventPayload(order, "instance-id"); err == nil {
+		t.Error("BootRuntimeEventPayload() found an event outside of the boot order")
+	}
+	if _, err := info.BootRuntimeEventPayload([]string{"system-ready", "app-id"}, "app-id"); err == nil {
+		t.Error("BootRuntimeEventPayload() found an event at another position")
+	}
+	if _, err := testTcbInfo().BootRuntimeEventPayload(order, "app-id"); err == nil {
+		t.Error("BootRuntimeEventPayload() found a missing event")
+	}
+}
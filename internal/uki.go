@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"bytes"
+	"debug/pe"
+	"fmt"
+	"strings"
+)
+
+// ExtractUKISections extracts the kernel cmdline and initrd measured into RTMR2 from a UKI.
+func ExtractUKISections(ukiData []byte) (string, []byte, error) {
+	// Create a reader from the UKI data
+	reader := bytes.NewReader(ukiData)
+
+	// Parse as PE file
+	peFile, err := pe.NewFile(reader)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse UKI as PE file: %w", err)
+	}
+
+	// Extract cmdline section
+	cmdlineSection := peFile.Section(".cmdline")
+	if cmdlineSection == nil {
+		return "", nil, fmt.Errorf("no .cmdline section found in UKI")
+	}
+
+	cmdlineData, err := cmdlineSection.Data()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read .cmdline section: %w", err)
+	}
+
+	// Convert cmdline to string, removing any trailing null bytes
+	kernelCmdline := strings.TrimRight(string(cmdlineData), "\x00")
+
+	var initrdData []byte
+	initrdSection := peFile.Section(".initrd")
+	if initrdSection != nil {
+		initrdData, err = initrdSection.Data()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read .initrd section: %w", err)
+		}
+
+		// Trim initrdData to the actual initrd size
+		if int(initrdSection.VirtualSize) > len(initrdData) {
+			return "", nil, fmt.Errorf(".initrd section of UKI is truncated")
+		}
+		initrdData = initrdData[:initrdSection.VirtualSize]
+	}
+
+	return kernelCmdline, initrdData, nil
+}
+
+// extractKernel extracts the .linux section from a UKI.
+func extractKernel(ukiData []byte) ([]byte, error) {
+	f, err := pe.NewFile(bytes.NewReader(ukiData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse UKI as PE file: %w", err)
+	}
+	defer f.Close()
+	sec := f.Section(".linux")
+	if sec == nil {
+		return nil, fmt.Errorf("no .linux section found in UKI")
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract .linux section from UKI: %w", err)
+	}
+	if int(sec.VirtualSize) > len(data) {
+		return nil, fmt.Errorf(".linux section of UKI is truncated")
+	}
+	return data[:sec.VirtualSize], nil
+}
@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	efiSystemNvDataFvGuid           = "fff12b8d-7696-4c8b-a985-2747075b4f50"
+	efiVariableGuid                 = "ddcf3616-3275-4164-98b6-fe85707ffe7d"
+	efiAuthenticatedVariableGuid    = "aaf32c78-947b-439a-a180-2e144ec37792"
+	edkiiWorkingBlockSignatureGuid  = "9e58292b-7c68-497d-a0ce-6500fd9f1b95"
+	efiSecureBootEnableDisableGuid  = "f0a30bc7-af08-4556-99c4-001009c93a44"
+	fvSignature                     = "_FVH"
+	fvHeaderLengthOffset            = 48
+	variableStoreHeaderSize         = 28
+	variableStoreFormatted          = 0x5a
+	variableStoreHealthy            = 0xfe
+	variableStartID                 = 0x55aa
+	variableHeaderSize              = 32
+	authenticatedVariableHeaderSize = 60
+	ftwWorkingBlockHeaderSize       = 32
+
+	// Variable states; bits are cleared as a variable moves through its life cycle.
+	varAdded                  = 0x3f
+	varInDeletedTransition    = 0xfe
+	varAddedBeingDeleted      = varAdded & varInDeletedTransition
+	varHeaderValidOnly        = 0x7f
+	variableStateUnprogrammed = 0xff
+)
+
+// EfiVariable is a variable of a UEFI NV variable store.
+type EfiVariable struct {
+	VendorGuid string
+	Name       string
+	Attributes uint32
+	Data       []byte
+}
+
+// VariableStore holds the live variables of the NV variable store in a CFV.
+type VariableStore struct {
+	// Authenticated reports whether the store uses authenticated variable headers.
+	Authenticated bool
+	Variables     []EfiVariable
+	// FtwWorkingBlock reports whether a fault tolerant write working block follows the store,
+	// FtwPending whether it records writes that were not completed.
+	FtwWorkingBlock bool
+	FtwPending      bool
+}
+
+// Variable returns a variable by vendor GUID and name.
+func (s *VariableStore) Variable(vendorGuid string, name string) (*EfiVariable, bool) {
+	for i := range s.Variables {
+		if s.Variables[i].VendorGuid == vendorGuid && s.Variables[i].Name == name {
+			return &s.Variables[i], true
+		}
+	}
+	return nil, false
+}
+
+// SecureBootVariables returns the Secure Boot databases stored in the variable store. The
+// SecureBoot variable is derived from SecureBootEnable, as the firmware does at boot.
+func (s *VariableStore) SecureBootVariables() *SecureBootVariables {
+	var vars SecureBootVariables
+	if v, ok := s.Variable(efiSecureBootEnableDisableGuid, "SecureBootEnable"); ok && len(v.Data) > 0 {
+		vars.Enabled = v.Data[0] == 1
+	}
+	for _, db := range []struct {
+		guid string
+		name string
+		data *[]byte
+	}{
+		{EfiGlobalVariableGuid, "PK", &vars.PK},
+		{EfiGlobalVariableGuid, "KEK", &vars.KEK},
+		{EfiImageSecurityDatabaseGuid, "db", &vars.DB},
+		{EfiImageSecurityDatabaseGuid, "dbx", &vars.DBX},
+	} {
+		if v, ok := s.Variable(db.guid, db.name); ok {
+			*db.data = v.Data
+		}
+	}
+	return &vars
+}
+
+// decodeGUID decodes a binary UEFI GUID.
+func decodeGUID(b []byte) string {
+	return EfiGuid{
+		Data1: binary.LittleEndian.Uint32(b[0:4]),
+		Data2: binary.LittleEndian.Uint16(b[4:6]),
+		Data3: binary.LittleEndian.Uint16(b[6:8]),
+		Data4: [8]byte(b[8:16]),
+	}.String()
+}
+
+// ParseVariableStore parses the NV variable store of a CFV, as returned by
+// GetConfigurationFirmwareVolume. Only live variables are returned.
+func ParseVariableStore(cfv []byte) (*VariableStore, error) {
+	if len(cfv) < fvHeaderLengthOffset+2 || string(cfv[40:44]) != fvSignature {
+		return nil, fmt.Errorf("variable store: CFV is not a firmware volume")
+	}
+	if guid := decodeGUID(cfv[16:32]); guid != efiSystemNvDataFvGuid {
+		return nil, fmt.Errorf("variable store: unexpected file system %s", guid)
+	}
+	off := int(binary.LittleEndian.Uint16(cfv[fvHeaderLengthOffset:]))
+	if off+variableStoreHeaderSize > len(cfv) {
+		return nil, fmt.Errorf("variable store: truncated store header")
+	}
+
+	store := &VariableStore{}
+	header := cfv[off:]
+	switch decodeGUID(header[0:16]) {
+	case efiAuthenticatedVariableGuid:
+		store.Authenticated = true
+	case efiVariableGuid:
+	default:
+		return nil, fmt.Errorf("variable store: unknown store signature %s", decodeGUID(header[0:16]))
+	}
+	size := int(binary.LittleEndian.Uint32(header[16:]))
+	if size < variableStoreHeaderSize || size > len(header) {
+		return nil, fmt.Errorf("variable store: invalid store size %d", size)
+	}
+	if header[20] != variableStoreFormatted || header[21] != variableStoreHealthy {
+		return nil, fmt.Errorf("variable store: store is not formatted or not healthy")
+	}
+
+	vars, err := parseVariables(header[variableStoreHeaderSize:size], store.Authenticated)
+	if err != nil {
+		return nil, err
+	}
+	store.Variables = vars
+
+	// The FTW working block follows the variable store, possibly after other NV regions.
+	if i := bytes.Index(header[size:], encodeGUID(edkiiWorkingBlockSignatureGuid)); i >= 0 && len(header)-size-i >= ftwWorkingBlockHeaderSize {
+		ftw := header[size+i:]
+		store.FtwWorkingBlock = true
+		queueSize := binary.LittleEndian.Uint64(ftw[24:32])
+		queue := ftw[ftwWorkingBlockHeaderSize:]
+		if queueSize < uint64(len(queue)) {
+			queue = queue[:queueSize]
+		}
+		// An erased queue holds only 0xff bytes.
+		store.FtwPending = bytes.Count(queue, []byte{0xff}) != len(queue)
+	}
+	return store, nil
+}
+
+// parseVariables parses the variable headers following the store header.
+func parseVariables(data []byte, authenticated bool) ([]EfiVariable, error) {
+	headerSize := variableHeaderSize
+	if authenticated {
+		headerSize = authenticatedVariableHeaderSize
+	}
+
+	var live, transition []EfiVariable
+	for off := 0; off+headerSize <= len(data); {
+		h := data[off:]
+		if binary.LittleEndian.Uint16(h) != variableStartID {
+			break
+		}
+		state := h[2]
+		attributes := binary.LittleEndian.Uint32(h[4:])
+		// NameSize, DataSize and VendorGuid end the header in both layouts.
+		sizes := h[headerSize-24:]
+		nameSize := int(binary.LittleEndian.Uint32(sizes[0:]))
+		dataSize := int(binary.LittleEndian.Uint32(sizes[4:]))
+		vendor := decodeGUID(sizes[8:24])
+		if nameSize > len(data)-off-headerSize || dataSize > len(data)-off-headerSize-nameSize {
+			return nil, fmt.Errorf("variable store: truncated variable at offset %d", off)
+		}
+
+		if state != varHeaderValidOnly && state != variableStateUnprogrammed {
+			name, ok := decodeUTF16(h[headerSize : headerSize+nameSize])
+			if !ok {
+				return nil, fmt.Errorf("variable store: invalid variable name at offset %d", off)
+			}
+			v := EfiVariable{
+				VendorGuid: vendor,
+				Name:       name,
+				Attributes: attributes,
+				Data:       h[headerSize+nameSize : headerSize+nameSize+dataSize],
+			}
+			switch state {
+			case varAdded:
+				live = append(live, v)
+			case varAddedBeingDeleted:
+				transition = append(transition, v)
+			}
+		}
+
+		off += headerSize + nameSize + dataSize
+		off = (off + 3) &^ 3
+	}
+
+	// A variable in deleted transition is still valid if the update never completed.
+	for _, v := range transition {
+		found := false
+		for _, l := range live {
+			found = found || (l.VendorGuid == v.VendorGuid && l.Name == v.Name)
+		}
+		if !found {
+			live = append(live, v)
+		}
+	}
+	return live, nil
+}
+
+// SecureBootHashesFromFirmware measures the Secure Boot variables stored in the firmware's CFV.
+func SecureBootHashesFromFirmware(fw []byte) (SecureBootHashes, error) {
+	cfv, err := GetConfigurationFirmwareVolume(fw)
+	if err != nil {
+		return SecureBootHashes{}, err
+	}
+	store, err := ParseVariableStore(cfv)
+	if err != nil {
+		return SecureBootHashes{}, err
+	}
+	if store.FtwPending {
+		return SecureBootHashes{}, fmt.Errorf("variable store: fault tolerant write pending, variables may be stale")
+	}
+	return store.SecureBootVariables().Hashes(), nil
+}
+
+// WithFirmwareSecureBoot returns a copy of the registry whose Secure Boot hashes are measured
+// from the variables stored in the firmware.
+func (r *Registry) WithFirmwareSecureBoot(fw []byte) (*Registry, error) {
+	hashes, err := SecureBootHashesFromFirmware(fw)
+	if err != nil {
+		return nil, err
+	}
+	derived := NewRegistry(r.Catalog())
+	if err := derived.SetSecureBoot(hashes); err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// storeVariable is a variable of a test variable store.
+type storeVariable struct {
+	state byte
+	guid  string
+	name  string
+	data  []byte
+}
+
+// testVariableStore encodes a CFV holding an authenticated variable store with the variables,
+// followed by an FTW working block with the given write queue.
+func testVariableStore(vars []storeVariable, ftwQueue []byte) []byte {
+	const fvHeaderLength = 0x48
+	cfv := make([]byte, fvHeaderLength)
+	copy(cfv[16:], encodeGUID(efiSystemNvDataFvGuid))
+	copy(cfv[40:], fvSignature)
+	binary.LittleEndian.PutUint16(cfv[fvHeaderLengthOffset:], fvHeaderLength)
+
+	var body []byte
+	for _, v := range vars {
+		name := encodeUTF16String(v.name)
+		h := make([]byte, authenticatedVariableHeaderSize)
+		binary.LittleEndian.PutUint16(h, variableStartID)
+		h[2] = v.state
+		binary.LittleEndian.PutUint32(h[4:], 0x27)
+		binary.LittleEndian.PutUint32(h[36:], uint32(len(name)))
+		binary.LittleEndian.PutUint32(h[40:], uint32(len(v.data)))
+		copy(h[44:], encodeGUID(v.guid))
+		body = append(body, h...)
+		body = append(body, name...)
+		body = append(body, v.data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0xff)
+		}
+	}
+	// The unused space of the store is erased flash.
+	body = append(body, bytes.Repeat([]byte{0xff}, 64)...)
+
+	store := encodeGUID(efiAuthenticatedVariableGuid)
+	store = binary.LittleEndian.AppendUint32(store, uint32(variableStoreHeaderSize+len(body)))
+	store = append(store, variableStoreFormatted, variableStoreHealthy, 0, 0, 0, 0, 0, 0)
+	cfv = append(cfv, store...)
+	cfv = append(cfv, body...)
+
+	ftw := make([]byte, ftwWorkingBlockHeaderSize)
+	copy(ftw, encodeGUID(edkiiWorkingBlockSignatureGuid))
+	binary.LittleEndian.PutUint64(ftw[24:], uint64(len(ftwQueue)))
+	return append(append(cfv, ftw...), ftwQueue...)
+}
+
+func TestParseVariableStore(t *testing.T) {
+	const varDeleted = 0xfd
+	pk := []byte("PK signature list")
+	cfv := testVariableStore([]storeVariable{
+		{state: varAdded, guid: efiSecureBootEnableDisableGuid, name: "SecureBootEnable", data: []byte{1}},
+		{state: varAdded, guid: EfiGlobalVariableGuid, name: "PK", data: pk},
+		// A db replaced by a later update.
+		{state: varAdded & varDeleted, guid: EfiImageSecurityDatabaseGuid, name: "db", data: []byte("old db")},
+		{state: varAdded, guid: EfiImageSecurityDatabaseGuid, name: "db", data: []byte("db")},
+		// A KEK update that completed, and a dbx update that was interrupted before the new
+		// variable was added.
+		{state: varAddedBeingDeleted, guid: EfiGlobalVariableGuid, name: "KEK", data: []byte("old KEK")},
+		{state: varAdded, guid: EfiGlobalVariableGuid, name: "KEK", data: []byte("KEK")},
+		{state: varAddedBeingDeleted, guid: EfiImageSecurityDatabaseGuid, name: "dbx", data: []byte("dbx")},
+		{state: varHeaderValidOnly, guid: EfiGlobalVariableGuid, name: "Boot0001", data: []byte("partial")},
+	}, bytes.Repeat([]byte{0xff}, 16))
+
+	store, err := ParseVariableStore(cfv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Authenticated || !store.FtwWorkingBlock || store.FtwPending {
+		t.Errorf("store = %+v, want an authenticated store with an idle FTW working block", store)
+	}
+	if _, ok := store.Variable(EfiGlobalVariableGuid, "Boot0001"); ok {
+		t.Error("variable with only a valid header is returned")
+	}
+	vars := store.SecureBootVariables()
+	want := SecureBootVariables{Enabled: true, PK: pk, KEK: []byte("KEK"), DB: []byte("db"), DBX: []byte("dbx")}
+	if vars.Enabled != want.Enabled || !bytes.Equal(vars.PK, want.PK) || !bytes.Equal(vars.KEK, want.KEK) ||
+		!bytes.Equal(vars.DB, want.DB) || !bytes.Equal(vars.DBX, want.DBX) {
+		t.Errorf("SecureBootVariables() = %+v, want %+v", *vars, want)
+	}
+
+	pending, err := ParseVariableStore(testVariableStore(nil, []byte{0xfe, 0xff}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending.FtwPending {
+		t.Error("FtwPending = false for a non-empty write queue")
+	}
+}
+
+func TestParseVariableStoreMalformed(t *testing.T) {
+	valid := func() []byte {
+		return testVariableStore([]storeVariable{
+			{state: varAdded, guid: EfiGlobalVariableGuid, name: "PK", data: []byte("PK")},
+		}, nil)
+	}
+	const storeOffset = 0x48
+	tests := []struct {
+		name   string
+		modify func(cfv []byte) []byte
+		want   string
+	}{
+		{name: "not a firmware volume", modify: func(cfv []byte) []byte { return cfv[:32] }, want: "not a firmware volume"},
+		{name: "other file system", modify: func(cfv []byte) []byte {
+			cfv[16] ^= 0xff
+			return cfv
+		}, want: "unexpected file system"},
+		{name: "truncated store header", modify: func(cfv []byte) []byte { return cfv[:storeOffset+8] }, want: "truncated store header"},
+		{name: "unknown store", modify: func(cfv []byte) []byte {
+			cfv[storeOffset] ^= 0xff
+			return cfv
+		}, want: "unknown store signature"},
+		{name: "store size", modify: func(cfv []byte) []byte {
+			binary.LittleEndian.PutUint32(cfv[storeOffset+16:], 0xffffff)
+			return cfv
+		}, want: "invalid store size"},
+		{name: "unhealthy", modify: func(cfv []byte) []byte {
+			cfv[storeOffset+21] = 0
+			return cfv
+		}, want: "not healthy"},
+		{name: "truncated variable", modify: func(cfv []byte) []byte {
+			binary.LittleEndian.PutUint32(cfv[storeOffset+variableStoreHeaderSize+40:], 0xffff)
+			return cfv
+		}, want: "truncated variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseVariableStore(tt.modify(valid()))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseVariableStore() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// rtmr0Output is an RTMR0 reference value together with the variant it was computed for.
+type rtmr0Output struct {
+	Value string `json:"value"`
+	// Firmware is the SHA-384 of the firmware image.
+	Firmware      string `json:"firmware"`
+	MRTD          string `json:"mrtd"`
+	Configuration string `json:"configuration"`
+	AcpiEpoch     string `json:"acpi_epoch"`
+	BootVariant   int    `json:"boot_variant"`
+	// Unverified names the computed events of the variant that match no captured value.
+	Unverified []string `json:"unverified,omitempty"`
+	// MRAggregated is SHA256(MRTD || RTMR0 || RTMR1 || RTMR2) of the variant.
+	MRAggregated string `json:"mr_aggregated"`
+}
+
+type measurementOutput struct {
+	RTMR1        string        `json:"rtmr1"`
+	RTMR2        string        `json:"rtmr2"`
+	RTMR3        string        `json:"rtmr3"`
+	RTMR0        []rtmr0Output `json:"rtmr0"`
+	MRTD         []string      `json:"mrtd"`
+	MRConfigID   string        `json:"mrconfigid"`
+	XFAM         string        `json:"xfam"`
+	TDAttributes string        `json:"tdattributes"`
+	// MRAggregated holds SHA256(MRTD || RTMR0 || RTMR1 || RTMR2) of each RTMR0 variant, in the
+	// order of RTMR0.
+	MRAggregated []string `json:"mr_aggregated"`
+	// MRImage holds SHA256(MRTD || RTMR1 || RTMR2) of each firmware, in the order of MRTD.
+	MRImage []string `json:"mr_image"`
+}
+
+// rtmr0Values returns the RTMR0 reference values.
+func (o *measurementOutput) rtmr0Values() []string {
+	values := make([]string, 0, len(o.RTMR0))
+	for _, v := range o.RTMR0 {
+		values = append(values, v.Value)
+	}
+	return values
+}
+
+// pairedRTMR0Variant returns the RTMR0 variant with the given value built from the firmware with
+// the given MRTD, or nil if there is none. RTMR0 and MRTD only match together: an RTMR0 value of
+// one firmware with the MRTD of another is not a valid pair.
+func (o *measurementOutput) pairedRTMR0Variant(mrtd string, value string) *rtmr0Output {
+	for i := range o.RTMR0 {
+		if o.RTMR0[i].MRTD == mrtd && o.RTMR0[i].Value == value {
+			return &o.RTMR0[i]
+		}
+	}
+	return nil
+}
+
+// firmwareImage is a firmware to measure together with its MRTD.
+type firmwareImage struct {
+	data []byte
+	mrtd string
+}
+
+// measureFlags holds the inputs shared by all commands that compute reference values.
+type measureFlags struct {
+	fwPath       string
+	ukiPath      string
+	kernelPath   string
+	initrdPath   string
+	cmdline      string
+	metadataPath string
+	metadataBios bool
+	catalogPath  string
+	debug        bool
+	config       string
+	unverified   bool
+	boot         bootFlags
+	app          appFlags
+	fwOpts       firmwareSourceOptions
+	sb           secureBootFlags
+	sbFromFw     bool
+
+	registry *internal.Registry
+	meta     *internal.ImageMetadata
+}
+
+func (m *measureFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&m.fwPath, "fw", "", "Path to firmware file (MRTD is the published one if the catalog lists it, otherwise computed from it); defaults to the published GCE firmware")
+	fs.StringVar(&m.ukiPath, "uki", "", "Path to UKI (Unified Kernel Image) file")
+	fs.StringVar(&m.kernelPath, "kernel", "", "Path to an EFI stub kernel booted directly, without a UKI; requires -initrd and -cmdline")
+	fs.StringVar(&m.initrdPath, "initrd", "", "Path to the initrd of the -kernel boot")
+	fs.StringVar(&m.cmdline, "cmdline", "", "Kernel cmdline of the -kernel boot")
+	fs.StringVar(&m.metadataPath, "metadata", "", "Path to the metadata.json of a dstack image; selects its UKI or kernel and checks its recorded measurements")
+	fs.BoolVar(&m.metadataBios, "metadata-bios", false, "Measure the firmware named by the bios field of -metadata instead of the published GCE firmware")
+	fs.StringVar(&m.catalogPath, "catalog", "", "Path to a measurement catalog (JSON) replacing the embedded one")
+	fs.BoolVar(&m.debug, "debug", false, "Enable debug output")
+	fs.StringVar(&m.config, "config", "", "Machine configurations (comma-separated, e.g., c3-standard-4,c3-standard-22); defaults to all")
+	fs.BoolVar(&m.unverified, "allow-unverified", false, "Keep computed boot option measurements that match no captured value (flagged as unverified)")
+	m.boot.register(fs)
+	m.app.register(fs)
+	fs.StringVar(&m.fwOpts.mirror, "fw-mirror", "", "Base URL of a mirror of the GCE firmware bucket (serving <sha384>.fd files)")
+	fs.StringVar(&m.fwOpts.dir, "fw-dir", "", "Directory containing the published firmware as <sha384>.fd files (offline mode)")
+	fs.BoolVar(&m.fwOpts.embedded, "fw-embedded", false, "Use the firmware embedded in the binary (requires the firmware_bundle build tag)")
+	fs.StringVar(&m.fwOpts.cacheDir, "cache-dir", "", "Firmware cache directory (defaults to the user cache directory)")
+	fs.BoolVar(&m.fwOpts.noCache, "no-cache", false, "Always download firmware instead of using the local cache")
+	m.sb.register(fs)
+	fs.BoolVar(&m.sbFromFw, "secure-boot-from-fw", false, "Measure the Secure Boot variables stored in the firmware's variable store instead of using the catalog hashes")
+}
+
+// configurations returns the machine configurations selected with -config.
+func (m *measureFlags) configurations() []string {
+	if m.config == "" {
+		return nil
+	}
+	return strings.Split(m.config, ",")
+}
+
+// catalog returns the registry of the catalog selected with -catalog, with the Secure Boot
+// variables given on the command line, loading it on first use.
+func (m *measureFlags) catalog() (*internal.Registry, error) {
+	if m.registry == nil {
+		registry, err := loadRegistry(m.catalogPath)
+		if err != nil {
+			return nil, err
+		}
+		if m.sb.set() && m.sbFromFw {
+			return nil, fmt.Errorf("-secure-boot-from-fw cannot be combined with other Secure Boot flags")
+		}
+		if m.sb.set() {
+			hashes, err := m.sb.hashes(registry.Catalog().SecureBoot)
+			if err != nil {
+				return nil, fmt.Errorf("failed to measure Secure Boot variables: %w", err)
+			}
+			if err := registry.SetSecureBoot(hashes); err != nil {
+				return nil, err
+			}
+		}
+		m.registry = registry
+	}
+	return m.registry, nil
+}
+
+// shape returns the machine shape selected with the boot flags.
+func (m *measureFlags) shape() (internal.MachineShape, error) {
+	var shape internal.MachineShape
+	shape.AllowUnverified = m.unverified
+	boot, err := m.boot.configuration()
+	if err != nil {
+		return shape, err
+	}
+	shape.Boot = boot
+	return shape, nil
+}
+
+// unverifiedHint points at -allow-unverified when a computed measurement matches no captured value.
+func unverifiedHint(err error) error {
+	if errors.Is(err, internal.ErrUnverifiedMeasurement) {
+		return fmt.Errorf("%w (pass -allow-unverified to use it anyway)", err)
+	}
+	return err
+}
+
+// warnUnverified warns about the computed events that match no captured value, once each.
+func warnUnverified(names []string) {
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		fmt.Fprintf(os.Stderr, "Warning: computed %s matches no captured value; the reference values using it are unverified\n", name)
+	}
+}
+
+// firmwares loads the firmware given with -fw, or in the image metadata with -metadata-bios, or
+// each published firmware variant.
+func (m *measureFlags) firmwares(ctx context.Context) ([]firmwareImage, error) {
+	fwPath := m.fwPath
+	if meta, err := m.metadata(); err != nil {
+		return nil, err
+	} else if fwPath == "" && meta != nil && meta.Bios != "" {
+		// A bios shipped with the image is not what GCE boots, so it is only measured on request.
+		if m.metadataBios {
+			fwPath = meta.Bios
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring the image metadata bios %s, GCE boots its published firmware (pass -metadata-bios to measure it)\n", meta.Bios)
+		}
+	}
+	registry, err := m.catalog()
+	if err != nil {
+		return nil, err
+	}
+	if fwPath != "" {
+		fwData, err := os.ReadFile(fwPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read firmware file: %w", err)
+		}
+		mrtd, err := registry.MRTD(fwData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate MRTD: %w", err)
+		}
+		return []firmwareImage{{data: fwData, mrtd: fmt.Sprintf("%x", mrtd)}}, nil
+	}
+
+	src, err := firmwareSource(m.fwOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up firmware source: %w", err)
+	}
+	var firmwares []firmwareImage
+	for _, fw := range registry.Firmware() {
+		fwData, err := internal.FetchFirmware(ctx, src, fw.FirmwareFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch firmware: %w", err)
+		}
+
+		// The published MRTD is the reference value; the computed one is only a cross-check until
+		// MeasureMRTD is validated against every published firmware.
+		if err := internal.CheckPublishedMRTD(fwData, fw); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using the published MRTD\n", err)
+		}
+		firmwares = append(firmwares, firmwareImage{data: fwData, mrtd: fw.MRTD})
+	}
+	return firmwares, nil
+}
+
+// bootImage holds the UKI given with -uki, or the kernel given with -kernel, and the initrd and
+// cmdline measured into RTMR2.
+type bootImage struct {
+	uki []byte
+	// kernel is set instead of uki for a direct kernel boot.
+	kernel  []byte
+	cmdline string
+	initrd  []byte
+}
+
+// image loads the UKI or kernel given on the command line or in the image metadata.
+func (m *measureFlags) image() (*bootImage, error) {
+	meta, err := m.metadata()
+	if err != nil {
+		return nil, err
+	}
+	ukiPath, kernelPath, initrdPath, cmdline := m.ukiPath, m.kernelPath, m.initrdPath, m.cmdline
+	if ukiPath == "" && kernelPath == "" && meta != nil {
+		ukiPath, kernelPath = meta.UKI, meta.Kernel
+		if initrdPath == "" {
+			initrdPath = meta.Initrd
+		}
+		if cmdline == "" {
+			cmdline = meta.Cmdline
+		}
+	}
+	switch {
+	case ukiPath != "" && kernelPath != "":
+		return nil, fmt.Errorf("-uki cannot be combined with -kernel")
+	case ukiPath != "":
+		return m.loadUKI(ukiPath, cmdline)
+	case kernelPath != "":
+		return loadKernel(kernelPath, initrdPath, cmdline)
+	}
+	return nil, fmt.Errorf("one of -uki, -kernel or -metadata is required")
+}
+
+// loadUKI loads a UKI and the cmdline and initrd it embeds.
+func (m *measureFlags) loadUKI(path string, metadataCmdline string) (*bootImage, error) {
+	if m.initrdPath != "" || m.cmdline != "" {
+		return nil, fmt.Errorf("-initrd and -cmdline require -kernel, a UKI embeds its own")
+	}
+	ukiData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read UKI file: %w", err)
+	}
+
+	// Extract cmdline and initrd from UKI
+	kernelCmdline, initrdData, err := internal.ExtractUKISections(ukiData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract sections from UKI: %w", err)
+	}
+	if metadataCmdline != "" && metadataCmdline != kernelCmdline {
+		fmt.Fprintf(os.Stderr, "Warning: image metadata cmdline differs from the cmdline embedded in the UKI, which is measured instead\n")
+	}
+	return &bootImage{uki: ukiData, cmdline: kernelCmdline, initrd: initrdData}, nil
+}
+
+// loadKernel loads a kernel booted directly with the given initrd and cmdline.
+func loadKernel(kernelPath string, initrdPath string, cmdline string) (*bootImage, error) {
+	if initrdPath == "" {
+		return nil, fmt.Errorf("-initrd is required with -kernel")
+	}
+	kernelData, err := os.ReadFile(kernelPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel file: %w", err)
+	}
+	initrdData, err := os.ReadFile(initrdPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read initrd file: %w", err)
+	}
+	return &bootImage{kernel: kernelData, cmdline: cmdline, initrd: initrdData}, nil
+}
+
+// expectedLogs builds the expected RTMR1 and RTMR2 logs of the boot.
+func (b *bootImage) expectedLogs() (rtmr1Log *internal.EventLog, rtmr2Log *internal.EventLog, err error) {
+	if b.kernel != nil {
+		return internal.ExpectedDirectBootRTMR1And2Logs(b.kernel, b.initrd, b.cmdline)
+	}
+	return internal.ExpectedRTMR1And2Logs(b.uki, b.initrd, b.cmdline)
+}
+
+// measure computes RTMR1 and RTMR2 of the boot.
+func (b *bootImage) measure(observers []internal.Observer) (rtmr1 []byte, rtmr2 []byte, err error) {
+	if b.kernel != nil {
+		return internal.MeasureDirectBootRTMR1And2(b.kernel, b.initrd, b.cmdline, observers...)
+	}
+	return internal.MeasureRTMR1And2(b.uki, b.initrd, b.cmdline, observers...)
+}
+
+// expectedLogs holds the expected event logs for the selected image, firmware and machine configurations.
+type expectedLogs struct {
+	rtmr0 []internal.RTMR0Variant
+	// rtmr0MRTDs holds the MRTD of the firmware each RTMR0 variant was built from.
+	rtmr0MRTDs []string
+	rtmr1      *internal.EventLog
+	rtmr2      *internal.EventLog
+	// rtmr3 is nil unless an app deployment was selected.
+	rtmr3 *internal.EventLog
+}
+
+// expectedLogs builds the expected event logs of RTMR0-2, with one RTMR0 log per firmware,
+// machine configuration, ACPI epoch and boot variant.
+func (m *measureFlags) expectedLogs(ctx context.Context) (*expectedLogs, error) {
+	shape, err := m.shape()
+	if err != nil {
+		return nil, err
+	}
+	img, err := m.image()
+	if err != nil {
+		return nil, err
+	}
+	firmwares, err := m.firmwares(ctx)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := m.catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	var logs expectedLogs
+	var unverified []string
+	for _, fw := range firmwares {
+		registry := registry
+		if m.sbFromFw {
+			if registry, err = registry.WithFirmwareSecureBoot(fw.data); err != nil {
+				return nil, fmt.Errorf("failed to measure Secure Boot variables of firmware: %w", err)
+			}
+		}
+		variants, err := registry.ExpectedRTMR0Logs(fw.data, m.configurations(), shape)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build RTMR0 log: %w", unverifiedHint(err))
+		}
+		logs.rtmr0 = append(logs.rtmr0, variants...)
+		for _, v := range variants {
+			logs.rtmr0MRTDs = append(logs.rtmr0MRTDs, fw.mrtd)
+			unverified = append(unverified, v.Unverified...)
+		}
+	}
+	warnUnverified(unverified)
+	logs.rtmr1, logs.rtmr2, err = img.expectedLogs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build RTMR1/RTMR2 logs: %w", err)
+	}
+	if app, err := m.app.deployment(); err != nil {
+		return nil, err
+	} else if app != nil {
+		if logs.rtmr3, err = internal.ExpectedRTMR3Log(app); err != nil {
+			return nil, fmt.Errorf("failed to build RTMR3 log: %w", err)
+		}
+	}
+	return &logs, nil
+}
+
+// measure computes the reference values for the selected image, firmware and machine configurations.
+func (m *measureFlags) measure(ctx context.Context) (*measurementOutput, error) {
+	shape, err := m.shape()
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := m.image()
+	if err != nil {
+		return nil, err
+	}
+
+	firmwares, err := m.firmwares(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := m.app.deployment()
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := m.catalog()
+	if err != nil {
+		return nil, err
+	}
+	var observers []internal.Observer
+	if m.debug {
+		observers = append(observers, internal.DebugObserver(os.Stderr))
+	}
+
+	// Measure each firmware variant
+	var rtmr0Values []internal.RTMR0Value
+	var mrtds []string
+	for _, fw := range firmwares {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mrtd, err := hex.DecodeString(fw.mrtd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MRTD %s: %w", fw.mrtd, err)
+		}
+		registry := registry
+		if m.sbFromFw {
+			if registry, err = registry.WithFirmwareSecureBoot(fw.data); err != nil {
+				return nil, fmt.Errorf("failed to measure Secure Boot variables of firmware: %w", err)
+			}
+		}
+		values, err := registry.MeasureRTMR0Variants(fw.data, mrtd, m.configurations(), shape, observers...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate RTMR0: %w", unverifiedHint(err))
+		}
+		rtmr0Values = append(rtmr0Values, values...)
+		mrtds = append(mrtds, fw.mrtd)
+	}
+	slices.SortStableFunc(rtmr0Values, internal.CompareRTMR0Values)
+
+	// Calculate firmware-independent measurements (RTMR1, RTMR2)
+	rtmr1, rtmr2, err := img.measure(observers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate measurements: %w", err)
+	}
+
+	rtmr3, err := hex.DecodeString(internal.Empty)
+	if err != nil {
+		return nil, err
+	}
+	if app != nil {
+		if rtmr3, err = internal.MeasureRTMR3(app, observers...); err != nil {
+			return nil, fmt.Errorf("failed to calculate RTMR3: %w", err)
+		}
+	}
+
+	output := &measurementOutput{
+		RTMR1:        fmt.Sprintf("%x", rtmr1),
+		RTMR2:        fmt.Sprintf("%x", rtmr2),
+		RTMR0:        []rtmr0Output{},
+		MRTD:         mrtds,
+		XFAM:         internal.XFAM,
+		TDAttributes: internal.TDAttributes,
+		MRConfigID:   internal.Empty,
+		RTMR3:        fmt.Sprintf("%x", rtmr3),
+		MRAggregated: []string{},
+		MRImage:      []string{},
+	}
+	var unverified []string
+	for _, v := range rtmr0Values {
+		mrAggregated := fmt.Sprintf("%x", internal.MRAggregated(v.MRTD, v.Value, rtmr1, rtmr2))
+		output.RTMR0 = append(output.RTMR0, rtmr0Output{
+			Value:         fmt.Sprintf("%x", v.Value),
+			Firmware:      fmt.Sprintf("%x", v.Firmware),
+			MRTD:          fmt.Sprintf("%x", v.MRTD),
+			Configuration: v.Configuration,
+			AcpiEpoch:     v.AcpiEpoch,
+			BootVariant:   v.BootVariant,
+			Unverified:    v.Unverified,
+			MRAggregated:  mrAggregated,
+		})
+		unverified = append(unverified, v.Unverified...)
+		output.MRAggregated = append(output.MRAggregated, mrAggregated)
+	}
+	warnUnverified(unverified)
+	for _, mrtd := range mrtds {
+		mrtdBytes, err := hex.DecodeString(mrtd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MRTD %s: %w", mrtd, err)
+		}
+		output.MRImage = append(output.MRImage, fmt.Sprintf("%x", internal.MRImage(mrtdBytes, rtmr1, rtmr2)))
+	}
+	return output, nil
+}
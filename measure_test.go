@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestMeasurementOutputRTMR0(t *testing.T) {
+	o := &measurementOutput{RTMR0: []rtmr0Output{
+		{Value: "aa", MRTD: "01", Configuration: "c3-standard-4", AcpiEpoch: "2025-06"},
+		{Value: "bb", MRTD: "01", Configuration: "c3-standard-4", AcpiEpoch: "2026-03", BootVariant: 1},
+	}}
+	if got := o.rtmr0Values(); len(got) != 2 || got[0] != "aa" || got[1] != "bb" {
+		t.Errorf("rtmr0Values() = %v, want [aa bb]", got)
+	}
+	if v := o.pairedRTMR0Variant("01", "bb"); v == nil || v.AcpiEpoch != "2026-03" || v.BootVariant != 1 {
+		t.Errorf("pairedRTMR0Variant(01, bb) = %+v, want the second variant", v)
+	}
+	if v := o.pairedRTMR0Variant("02", "bb"); v != nil {
+		t.Errorf("pairedRTMR0Variant(02, bb) = %+v, want nil for another firmware", v)
+	}
+	if v := o.pairedRTMR0Variant("01", "cc"); v != nil {
+		t.Errorf("pairedRTMR0Variant(01, cc) = %+v, want nil", v)
+	}
+	if got := (&measurementOutput{}).rtmr0Values(); got == nil || len(got) != 0 {
+		t.Errorf("rtmr0Values() of no variants = %#v, want an empty slice", got)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// metadata returns the image metadata given with -metadata, loading it on first use, or nil if
+// none was given.
+func (m *measureFlags) metadata() (*internal.ImageMetadata, error) {
+	if m.meta == nil && m.metadataPath != "" {
+		meta, err := internal.LoadImageMetadata(m.metadataPath)
+		if err != nil {
+			return nil, err
+		}
+		m.meta = meta
+	}
+	return m.meta, nil
+}
+
+// checkRecorded compares the measurements recorded in the loaded image metadata with the
+// computed ones.
+func (m *measureFlags) checkRecorded(output *measurementOutput) []error {
+	if m.meta == nil || m.meta.Measurements == nil {
+		return nil
+	}
+	recorded := m.meta.Measurements
+
+	var mismatches []error
+	check := func(name string, value []byte, computed ...string) {
+		if value == nil {
+			return
+		}
+		if hex := fmt.Sprintf("%x", value); !slices.Contains(computed, hex) {
+			mismatches = append(mismatches, fmt.Errorf("image metadata records %s %s, which does not match the computed value", name, hex))
+		}
+	}
+	check("MRTD", recorded.MRTD, output.MRTD...)
+	check("RTMR0", recorded.RTMR0, output.rtmr0Values()...)
+	check("RTMR1", recorded.RTMR1, output.RTMR1)
+	check("RTMR2", recorded.RTMR2, output.RTMR2)
+	check("mr_aggregated", recorded.MRAggregated, output.MRAggregated...)
+	check("mr_image", recorded.MRImage, output.MRImage...)
+	return mismatches
+}
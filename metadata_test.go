@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+func TestCheckRecorded(t *testing.T) {
+	output := &measurementOutput{
+		MRTD:         []string{"0a"},
+		RTMR0:        []rtmr0Output{{Value: "1a"}, {Value: "1b"}},
+		RTMR1:        "2a",
+		RTMR2:        "3a",
+		MRAggregated: []string{"4a", "4b"},
+		MRImage:      []string{"5a"},
+	}
+	tests := []struct {
+		name     string
+		recorded *internal.RecordedMeasurements
+		want     []string
+	}{
+		{name: "nothing recorded"},
+		{
+			name:     "match",
+			recorded: &internal.RecordedMeasurements{MRTD: []byte{0x0a}, RTMR0: []byte{0x1b}, RTMR1: []byte{0x2a}, MRAggregated: []byte{0x4b}},
+		},
+		{
+			name:     "mismatch",
+			recorded: &internal.RecordedMeasurements{RTMR0: []byte{0x1c}, RTMR2: []byte{0x3b}, MRImage: []byte{0x5a}},
+			want:     []string{"RTMR0 1c", "RTMR2 3b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &measureFlags{meta: &internal.ImageMetadata{UKI: "a.efi", Measurements: tt.recorded}}
+			errs := m.checkRecorded(output)
+			if len(errs) != len(tt.want) {
+				t.Fatalf("checkRecorded() = %v, want %d mismatches", errs, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("mismatch %d = %v, want %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// pcrBankOutput holds the predicted PCR0-9 of one bank, or why they cannot be predicted.
+type pcrBankOutput struct {
+	PCRs  []string `json:"pcrs,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+type pcrPredictionOutput struct {
+	MRTD          string                   `json:"mrtd"`
+	Configuration string                   `json:"configuration"`
+	AcpiEpoch     string                   `json:"acpi_epoch"`
+	BootVariant   int                      `json:"boot_variant"`
+	Banks         map[string]pcrBankOutput `json:"banks"`
+}
+
+// bankName returns the TPM name of the bank of a hash algorithm, e.g. sha256.
+func bankName(alg crypto.Hash) string {
+	return strings.ToLower(strings.ReplaceAll(alg.String(), "-", ""))
+}
+
+// runPCRs predicts the vTPM PCR0-9 values of every RTMR0 variant by mapping the expected RTMR
+// events back to the PCRs the firmware would extend on a TPM.
+func runPCRs(args []string) int {
+	var (
+		m          measureFlags
+		jsonOutput bool
+		bankNames  string
+	)
+	fs := flag.NewFlagSet("pcrs", flag.ExitOnError)
+	m.register(fs)
+	fs.BoolVar(&jsonOutput, "json", false, "Output the result as JSON")
+	fs.StringVar(&bankNames, "banks", "sha384", "PCR banks to predict (comma-separated); only sha384 is supported, as the catalog only records SHA-384 digests")
+	fs.Parse(args)
+
+	var banks []crypto.Hash
+	for _, name := range strings.Split(bankNames, ",") {
+		i := slices.IndexFunc(internal.PCRBankAlgorithms, func(alg crypto.Hash) bool { return bankName(alg) == name })
+		if i < 0 {
+			fmt.Printf("Error: unsupported PCR bank %q: only sha384 is supported, as the catalog only records SHA-384 digests\n", name)
+			return 1
+		}
+		banks = append(banks, internal.PCRBankAlgorithms[i])
+	}
+
+	logs, err := m.expectedLogs(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	var output []pcrPredictionOutput
+	for i, v := range logs.rtmr0 {
+		prediction := pcrPredictionOutput{
+			MRTD:          logs.rtmr0MRTDs[i],
+			Configuration: v.Configuration,
+			AcpiEpoch:     v.AcpiEpoch,
+			BootVariant:   v.BootVariant,
+			Banks:         make(map[string]pcrBankOutput),
+		}
+		for _, alg := range banks {
+			var bank pcrBankOutput
+			pcrs, err := internal.PredictPCRs(alg, v.Log, logs.rtmr1, logs.rtmr2)
+			if err != nil {
+				bank.Error = err.Error()
+			} else {
+				for _, pcr := range pcrs {
+					bank.PCRs = append(bank.PCRs, fmt.Sprintf("%x", pcr))
+				}
+			}
+			prediction.Banks[bankName(alg)] = bank
+		}
+		output = append(output, prediction)
+	}
+
+	fmt.Fprintf(os.Stderr, "Note: %s\n", internal.PCR0Note)
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+		return 0
+	}
+
+	for i, p := range output {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("=== MRTD %.16s, %s, ACPI epoch %s, boot variant %d ===\n", p.MRTD, p.Configuration, p.AcpiEpoch, p.BootVariant)
+		for _, alg := range banks {
+			bank := p.Banks[bankName(alg)]
+			if bank.Error != "" {
+				fmt.Printf("%s: unavailable: %s\n", bankName(alg), bank.Error)
+				continue
+			}
+			for pcr, value := range bank.PCRs {
+				fmt.Printf("%s PCR%d: %s\n", bankName(alg), pcr, value)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,242 @@
+package measure
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// RuntimeEvent is an event the dstack guest extends into RTMR3 at runtime.
+type RuntimeEvent struct {
+	Name    string
+	Payload []byte
+}
+
+// Event returns the measured event. Its digest covers the event type, name and payload.
+func (r RuntimeEvent) Event() Event {
+	e := internal.RuntimeEvent(r).Event()
+	return newEvent(&e)
+}
+
+// KeyProvider identifies the provider of the app keys.
+type KeyProvider struct {
+	// Name is the kind of provider, e.g. "kms" or "local".
+	Name string `json:"name"`
+	// ID identifies the provider instance, e.g. the hex-encoded public key of the KMS root CA.
+	ID string `json:"id"`
+}
+
+// AppDeployment identifies a dstack app deployment, as measured into RTMR3.
+type AppDeployment struct {
+	// ComposeHash is the SHA-256 of the app's app-compose.json.
+	ComposeHash []byte
+	AppID       []byte
+	// InstanceID is empty for apps deployed without an instance ID.
+	InstanceID  []byte
+	KeyProvider KeyProvider
+	// EventOrder lists the names of the runtime events in the order the guest extends them, which
+	// differs between dstack versions. Nil selects DefaultRuntimeEventOrder.
+	EventOrder []string
+}
+
+func (d *AppDeployment) internal() *internal.AppDeployment {
+	if d == nil {
+		return nil
+	}
+	return &internal.AppDeployment{
+		ComposeHash: d.ComposeHash,
+		AppID:       d.AppID,
+		InstanceID:  d.InstanceID,
+		KeyProvider: internal.KeyProvider(d.KeyProvider),
+		EventOrder:  d.EventOrder,
+	}
+}
+
+// RuntimeEvents returns the runtime events of a boot of the deployment, in the order the dstack
+// guest extends them, see EventOrder.
+func (d *AppDeployment) RuntimeEvents() ([]RuntimeEvent, error) {
+	events, err := d.internal().RuntimeEvents()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RuntimeEvent, 0, len(events))
+	for _, e := range events {
+		out = append(out, RuntimeEvent(e))
+	}
+	return out, nil
+}
+
+// DefaultRuntimeEventOrder is the order in which current dstack guests extend the runtime events
+// of a boot, used when AppDeployment.EventOrder is nil.
+var DefaultRuntimeEventOrder = slices.Clone(internal.DefaultRuntimeEventOrder)
+
+// Runners of an app-compose.json.
+const (
+	RunnerDockerCompose = internal.RunnerDockerCompose
+	RunnerBash          = internal.RunnerBash
+)
+
+// AppCompose holds the fields of a dstack app-compose.json that affect the measurements. The
+// compose hash covers the whole document as parsed, including fields not listed here; changing
+// the fields does not change it.
+type AppCompose struct {
+	ManifestVersion         int
+	Name                    string
+	Runner                  string
+	DockerComposeFile       string
+	BashScript              string
+	PreLaunchScript         string
+	KmsEnabled              bool
+	GatewayEnabled          bool
+	LocalKeyProviderEnabled bool
+	KeyProviderID           string
+	PublicLogs              bool
+	PublicSysinfo           bool
+	AllowedEnvs             []string
+	NoInstanceID            bool
+	SecureTime              bool
+
+	parsed *internal.AppCompose
+}
+
+// ParseAppCompose parses an app-compose.json. Its ComposeHash method hashes the normalized
+// document; dstack measures the SHA-256 of the file as deployed, which only equals it for
+// normalized files.
+func ParseAppCompose(data []byte) (*AppCompose, error) {
+	c, err := internal.ParseAppCompose(data)
+	if err != nil {
+		return nil, err
+	}
+	return &AppCompose{
+		ManifestVersion:         c.ManifestVersion,
+		Name:                    c.Name,
+		Runner:                  c.Runner,
+		DockerComposeFile:       c.DockerComposeFile,
+		BashScript:              c.BashScript,
+		PreLaunchScript:         c.PreLaunchScript,
+		KmsEnabled:              c.KmsEnabled,
+		GatewayEnabled:          c.GatewayEnabled,
+		LocalKeyProviderEnabled: c.LocalKeyProviderEnabled,
+		KeyProviderID:           c.KeyProviderID,
+		PublicLogs:              c.PublicLogs,
+		PublicSysinfo:           c.PublicSysinfo,
+		AllowedEnvs:             c.AllowedEnvs,
+		NoInstanceID:            c.NoInstanceID,
+		SecureTime:              c.SecureTime,
+		parsed:                  c,
+	}, nil
+}
+
+// errAppComposeNotParsed is returned by the AppCompose methods for documents not returned by
+// ParseAppCompose.
+var errAppComposeNotParsed = errors.New("app compose: document not parsed with ParseAppCompose")
+
+// Normalize returns the canonical form of the document dstack computes the compose hash from.
+func (c *AppCompose) Normalize() ([]byte, error) {
+	if c.parsed == nil {
+		return nil, errAppComposeNotParsed
+	}
+	return c.parsed.Normalize()
+}
+
+// ComposeHash returns the SHA-256 of the normalized document.
+func (c *AppCompose) ComposeHash() ([]byte, error) {
+	if c.parsed == nil {
+		return nil, errAppComposeNotParsed
+	}
+	return c.parsed.ComposeHash()
+}
+
+// AppID returns the app ID dstack derives from the compose hash.
+func (c *AppCompose) AppID() ([]byte, error) {
+	if c.parsed == nil {
+		return nil, errAppComposeNotParsed
+	}
+	return c.parsed.AppID()
+}
+
+// TcbInfoEvent is an event of the event log in a dstack tcb_info document.
+type TcbInfoEvent struct {
+	// IMR is the RTMR index the event was extended into.
+	IMR       uint32   `json:"imr"`
+	EventType uint32   `json:"event_type"`
+	Digest    HexBytes `json:"digest"`
+	// Event is the name of a runtime event.
+	Event        string   `json:"event"`
+	EventPayload HexBytes `json:"event_payload"`
+}
+
+// TcbInfo is the tcb_info document reported by the dstack guest agent.
+type TcbInfo struct {
+	MRTD       HexBytes       `json:"mrtd"`
+	RTMR0      HexBytes       `json:"rtmr0"`
+	RTMR1      HexBytes       `json:"rtmr1"`
+	RTMR2      HexBytes       `json:"rtmr2"`
+	RTMR3      HexBytes       `json:"rtmr3"`
+	EventLog   []TcbInfoEvent `json:"event_log"`
+	AppCompose string         `json:"app_compose"`
+}
+
+// ParseTcbInfo parses a tcb_info document or a guest agent info response carrying one.
+func ParseTcbInfo(data []byte) (*TcbInfo, error) {
+	t, err := internal.ParseTcbInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	out := &TcbInfo{
+		MRTD:       HexBytes(t.MRTD),
+		RTMR0:      HexBytes(t.RTMR0),
+		RTMR1:      HexBytes(t.RTMR1),
+		RTMR2:      HexBytes(t.RTMR2),
+		RTMR3:      HexBytes(t.RTMR3),
+		AppCompose: t.AppCompose,
+	}
+	for _, e := range t.EventLog {
+		out.EventLog = append(out.EventLog, TcbInfoEvent{
+			IMR:          e.IMR,
+			EventType:    e.EventType,
+			Digest:       HexBytes(e.Digest),
+			Event:        e.Event,
+			EventPayload: HexBytes(e.EventPayload),
+		})
+	}
+	return out, nil
+}
+
+func (t *TcbInfo) internal() *internal.TcbInfo {
+	out := &internal.TcbInfo{
+		MRTD:       internal.HexBytes(t.MRTD),
+		RTMR0:      internal.HexBytes(t.RTMR0),
+		RTMR1:      internal.HexBytes(t.RTMR1),
+		RTMR2:      internal.HexBytes(t.RTMR2),
+		RTMR3:      internal.HexBytes(t.RTMR3),
+		AppCompose: t.AppCompose,
+	}
+	for _, e := range t.EventLog {
+		out.EventLog = append(out.EventLog, internal.TcbInfoEvent{
+			IMR:          e.IMR,
+			EventType:    e.EventType,
+			Digest:       internal.HexBytes(e.Digest),
+			Event:        e.Event,
+			EventPayload: internal.HexBytes(e.EventPayload),
+		})
+	}
+	return out
+}
+
+// CheckRuntimeEvents checks that the digest of every runtime event matches its name and payload.
+func (t *TcbInfo) CheckRuntimeEvents() error {
+	return t.internal().CheckRuntimeEvents()
+}
+
+// BootRuntimeEventPayload returns the payload of the named runtime event at its position in the
+// boot event order. A later event with the same name, extended by the app, does not replace it.
+func (t *TcbInfo) BootRuntimeEventPayload(eventOrder []string, name string) ([]byte, error) {
+	return t.internal().BootRuntimeEventPayload(eventOrder, name)
+}
+
+// RuntimeEventNames returns the names of the runtime events in the order they were extended.
+func (t *TcbInfo) RuntimeEventNames() []string {
+	return t.internal().RuntimeEventNames()
+}
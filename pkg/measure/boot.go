@@ -0,0 +1,111 @@
+package measure
+
+import (
+	"fmt"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// EFI_LOAD_OPTION attributes.
+const (
+	LoadOptionActive      = internal.LoadOptionActive
+	LoadOptionHidden      = internal.LoadOptionHidden
+	LoadOptionCategoryApp = internal.LoadOptionCategoryApp
+)
+
+// LoadOption describes an EFI_LOAD_OPTION stored in a Boot#### variable.
+type LoadOption struct {
+	// Number is the #### of the Boot#### variable.
+	Number      uint16 `json:"number"`
+	Description string `json:"description"`
+	Attributes  uint32 `json:"attributes"`
+	// DevicePath is the text representation of the file path list, see ParseDevicePath.
+	DevicePath   string   `json:"device_path"`
+	OptionalData HexBytes `json:"optional_data,omitempty"`
+}
+
+// Name returns the name of the option's Boot#### variable.
+func (o *LoadOption) Name() string {
+	return fmt.Sprintf("Boot%04X", o.Number)
+}
+
+// BootConfiguration is the set of boot options of a VM, in BootOrder order.
+type BootConfiguration struct {
+	Options []LoadOption `json:"options"`
+}
+
+// ParseBootConfiguration parses and validates a JSON boot configuration.
+func ParseBootConfiguration(data []byte) (*BootConfiguration, error) {
+	c, err := internal.ParseBootConfiguration(data)
+	if err != nil {
+		return nil, err
+	}
+	return newBootConfiguration(c), nil
+}
+
+func newBootConfiguration(c *internal.BootConfiguration) *BootConfiguration {
+	out := &BootConfiguration{}
+	for _, o := range c.Options {
+		out.Options = append(out.Options, LoadOption{
+			Number:       o.Number,
+			Description:  o.Description,
+			Attributes:   o.Attributes,
+			DevicePath:   o.DevicePath,
+			OptionalData: HexBytes(o.OptionalData),
+		})
+	}
+	return out
+}
+
+func (c *BootConfiguration) internal() *internal.BootConfiguration {
+	if c == nil {
+		return nil
+	}
+	out := &internal.BootConfiguration{}
+	for _, o := range c.Options {
+		out.Options = append(out.Options, internal.LoadOption{
+			Number:       o.Number,
+			Description:  o.Description,
+			Attributes:   o.Attributes,
+			DevicePath:   o.DevicePath,
+			OptionalData: internal.HexBytes(o.OptionalData),
+		})
+	}
+	return out
+}
+
+// Disk interfaces of a DiskTopology.
+const (
+	DiskInterfaceNVMe   = internal.DiskInterfaceNVMe
+	DiskInterfaceSCSI   = internal.DiskInterfaceSCSI
+	DiskInterfaceVirtio = internal.DiskInterfaceVirtio
+)
+
+// DiskTopology describes the disks attached to a VM. The boot disk comes first, followed by
+// DataDisks disks on the same interface.
+type DiskTopology struct {
+	// Interface is the disk interface: nvme, scsi or virtio (virtio-blk).
+	Interface string
+	DataDisks int
+}
+
+// BootConfiguration returns the boot options the firmware creates for the topology. The NVMe boot
+// disk without data disks reproduces the captured boot options; the other topologies are not
+// captured.
+func (t DiskTopology) BootConfiguration() (*BootConfiguration, error) {
+	c, err := internal.DiskTopology(t).BootConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	return newBootConfiguration(c), nil
+}
+
+// DevicePath is an encoded EFI device path.
+type DevicePath []byte
+
+// ParseDevicePath parses the text representation of a device path, as printed by the UEFI
+// shell or efibootmgr, e.g. PciRoot(0x0)/Pci(0x4,0x0)/NVMe(0x1,00-00-00-00-00-00-00-00).
+func ParseDevicePath(text string) (DevicePath, error) {
+	p, err := internal.ParseDevicePath(text)
+	return DevicePath(p), err
+}
@@ -0,0 +1,284 @@
+package measure
+
+import (
+	"encoding/json"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// CatalogVersion is the version of the catalog format ParseCatalog reads.
+const CatalogVersion = internal.CatalogVersion
+
+// HexBytes is a byte string encoded as hex in JSON.
+type HexBytes []byte
+
+// MarshalJSON encodes the bytes as a lowercase hex string.
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return internal.HexBytes(h).MarshalJSON()
+}
+
+// UnmarshalJSON decodes a hex string.
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	return (*internal.HexBytes)(h).UnmarshalJSON(data)
+}
+
+// FirmwareMRTD pairs a published firmware hash with its MRTD.
+type FirmwareMRTD struct {
+	// FirmwareFile is the SHA-384 of the firmware image, which names it in the published bucket.
+	FirmwareFile string `json:"file"`
+	MRTD         string `json:"mrtd"`
+}
+
+// SecureBootHashes holds the SHA-384 hashes of the Secure Boot EFI variable events.
+type SecureBootHashes struct {
+	SecureBoot HexBytes `json:"SecureBoot"`
+	PK         HexBytes `json:"PK"`
+	KEK        HexBytes `json:"KEK"`
+	DB         HexBytes `json:"db"`
+	DBX        HexBytes `json:"dbx"`
+}
+
+// BootVariant contains NVMe driver boot option measurements.
+type BootVariant struct {
+	Boot0001 HexBytes `json:"boot0001"`
+	Boot0002 HexBytes `json:"boot0002"`
+}
+
+// AcpiHashes holds the measured hashes for one set of ACPI tables. A machine configuration may
+// have several, one per firmware epoch.
+type AcpiHashes struct {
+	// Epoch names the firmware release the hashes were captured with.
+	Epoch string `json:"epoch"`
+	// Source records where the hashes were captured.
+	Source         string   `json:"source,omitempty"`
+	AcpiLoaderHash HexBytes `json:"loader"`
+	AcpiRsdpHash   HexBytes `json:"rsdp"`
+	AcpiTablesHash HexBytes `json:"tables"`
+}
+
+// MachineConfiguration holds the captured TD HOB and ACPI table hashes of a machine type.
+type MachineConfiguration struct {
+	TdHobHash  HexBytes     `json:"td_hob"`
+	AcpiHashes []AcpiHashes `json:"acpi"`
+}
+
+// Catalog is the set of captured measurements RTMR0 is computed from.
+type Catalog struct {
+	Version               int                             `json:"version"`
+	Firmware              []FirmwareMRTD                  `json:"firmware"`
+	SecureBoot            SecureBootHashes                `json:"secure_boot"`
+	Boot0000              HexBytes                        `json:"boot0000"`
+	BootVariants          []BootVariant                   `json:"boot_variants"`
+	MachineConfigurations map[string]MachineConfiguration `json:"machine_configurations"`
+}
+
+// ParseCatalog parses and validates a JSON catalog.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	c, err := internal.ParseCatalog(data)
+	if err != nil {
+		return nil, err
+	}
+	return newCatalog(c), nil
+}
+
+// LoadCatalog reads a JSON catalog from a file.
+func LoadCatalog(path string) (*Catalog, error) {
+	c, err := internal.LoadCatalog(path)
+	if err != nil {
+		return nil, err
+	}
+	return newCatalog(c), nil
+}
+
+// Marshal encodes the catalog as indented JSON.
+func (c *Catalog) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func newCatalog(c *internal.Catalog) *Catalog {
+	out := &Catalog{
+		Version:    c.Version,
+		SecureBoot: newSecureBootHashes(c.SecureBoot),
+		Boot0000:   HexBytes(c.Boot0000),
+	}
+	for _, fw := range c.Firmware {
+		out.Firmware = append(out.Firmware, FirmwareMRTD(fw))
+	}
+	for _, boot := range c.BootVariants {
+		out.BootVariants = append(out.BootVariants, newBootVariant(boot))
+	}
+	if c.MachineConfigurations != nil {
+		out.MachineConfigurations = make(map[string]MachineConfiguration, len(c.MachineConfigurations))
+		for name, config := range c.MachineConfigurations {
+			out.MachineConfigurations[name] = newMachineConfiguration(config)
+		}
+	}
+	return out
+}
+
+func (c *Catalog) internal() *internal.Catalog {
+	out := &internal.Catalog{
+		Version:    c.Version,
+		SecureBoot: c.SecureBoot.internal(),
+		Boot0000:   internal.HexBytes(c.Boot0000),
+	}
+	for _, fw := range c.Firmware {
+		out.Firmware = append(out.Firmware, internal.FirmwareMRTD(fw))
+	}
+	for _, boot := range c.BootVariants {
+		out.BootVariants = append(out.BootVariants, boot.internal())
+	}
+	if c.MachineConfigurations != nil {
+		out.MachineConfigurations = make(map[string]internal.MachineConfiguration, len(c.MachineConfigurations))
+		for name, config := range c.MachineConfigurations {
+			out.MachineConfigurations[name] = config.internal()
+		}
+	}
+	return out
+}
+
+func newSecureBootHashes(h internal.SecureBootHashes) SecureBootHashes {
+	return SecureBootHashes{
+		SecureBoot: HexBytes(h.SecureBoot),
+		PK:         HexBytes(h.PK),
+		KEK:        HexBytes(h.KEK),
+		DB:         HexBytes(h.DB),
+		DBX:        HexBytes(h.DBX),
+	}
+}
+
+func (h SecureBootHashes) internal() internal.SecureBootHashes {
+	return internal.SecureBootHashes{
+		SecureBoot: internal.HexBytes(h.SecureBoot),
+		PK:         internal.HexBytes(h.PK),
+		KEK:        internal.HexBytes(h.KEK),
+		DB:         internal.HexBytes(h.DB),
+		DBX:        internal.HexBytes(h.DBX),
+	}
+}
+
+func newBootVariant(b internal.BootVariant) BootVariant {
+	return BootVariant{Boot0001: HexBytes(b.Boot0001), Boot0002: HexBytes(b.Boot0002)}
+}
+
+func (b BootVariant) internal() internal.BootVariant {
+	return internal.BootVariant{Boot0001: internal.HexBytes(b.Boot0001), Boot0002: internal.HexBytes(b.Boot0002)}
+}
+
+func newAcpiHashes(a internal.AcpiHashes) AcpiHashes {
+	return AcpiHashes{
+		Epoch:          a.Epoch,
+		Source:         a.Source,
+		AcpiLoaderHash: HexBytes(a.AcpiLoaderHash),
+		AcpiRsdpHash:   HexBytes(a.AcpiRsdpHash),
+		AcpiTablesHash: HexBytes(a.AcpiTablesHash),
+	}
+}
+
+func (a AcpiHashes) internal() internal.AcpiHashes {
+	return internal.AcpiHashes{
+		Epoch:          a.Epoch,
+		Source:         a.Source,
+		AcpiLoaderHash: internal.HexBytes(a.AcpiLoaderHash),
+		AcpiRsdpHash:   internal.HexBytes(a.AcpiRsdpHash),
+		AcpiTablesHash: internal.HexBytes(a.AcpiTablesHash),
+	}
+}
+
+func newMachineConfiguration(m internal.MachineConfiguration) MachineConfiguration {
+	out := MachineConfiguration{TdHobHash: HexBytes(m.TdHobHash)}
+	for _, acpi := range m.AcpiHashes {
+		out.AcpiHashes = append(out.AcpiHashes, newAcpiHashes(acpi))
+	}
+	return out
+}
+
+func (m MachineConfiguration) internal() internal.MachineConfiguration {
+	out := internal.MachineConfiguration{TdHobHash: internal.HexBytes(m.TdHobHash)}
+	for _, acpi := range m.AcpiHashes {
+		out.AcpiHashes = append(out.AcpiHashes, acpi.internal())
+	}
+	return out
+}
+
+// Registry holds the catalog used to compute measurements and lets callers add or override
+// entries at runtime. It is safe for concurrent use.
+type Registry struct {
+	r *internal.Registry
+}
+
+// NewRegistry returns a registry initialized with a copy of the catalog.
+func NewRegistry(c *Catalog) *Registry {
+	return &Registry{r: internal.NewRegistry(c.internal())}
+}
+
+// NewDefaultRegistry returns a registry initialized with the embedded catalog.
+func NewDefaultRegistry() *Registry {
+	return &Registry{r: internal.NewDefaultRegistry()}
+}
+
+// Catalog returns a copy of the registry's current catalog.
+func (r *Registry) Catalog() *Catalog {
+	return newCatalog(r.r.Catalog())
+}
+
+// Firmware returns the published firmware and their MRTDs.
+func (r *Registry) Firmware() []FirmwareMRTD {
+	var out []FirmwareMRTD
+	for _, fw := range r.r.Firmware() {
+		out = append(out, FirmwareMRTD(fw))
+	}
+	return out
+}
+
+// IsKnownFirmware reports whether the firmware hash is in the catalog.
+func (r *Registry) IsKnownFirmware(hash string) bool {
+	return r.r.IsKnownFirmware(hash)
+}
+
+// MRTD returns the MRTD of a firmware image: the published MRTD when the catalog lists the
+// firmware, otherwise the one computed by Measurer.MeasureMRTD.
+func (r *Registry) MRTD(fw []byte) ([]byte, error) {
+	return r.r.MRTD(fw)
+}
+
+// AddFirmware adds a published firmware.
+func (r *Registry) AddFirmware(fw FirmwareMRTD) error {
+	return r.r.AddFirmware(internal.FirmwareMRTD(fw))
+}
+
+// MachineConfigurationNames returns the names of the machine configurations, sorted.
+func (r *Registry) MachineConfigurationNames() []string {
+	return r.r.MachineConfigurationNames()
+}
+
+// MachineConfiguration returns a machine configuration by name.
+func (r *Registry) MachineConfiguration(name string) (MachineConfiguration, bool) {
+	config, ok := r.r.MachineConfiguration(name)
+	return newMachineConfiguration(config), ok
+}
+
+// SetMachineConfiguration adds a machine configuration or replaces an existing one.
+func (r *Registry) SetMachineConfiguration(name string, config MachineConfiguration) error {
+	return r.r.SetMachineConfiguration(name, config.internal())
+}
+
+// AddAcpiHashes adds an ACPI hash set, typically for a new firmware epoch, to a machine
+// configuration.
+func (r *Registry) AddAcpiHashes(name string, acpi AcpiHashes) error {
+	return r.r.AddAcpiHashes(name, acpi.internal())
+}
+
+// AddBootVariant adds a boot option variant.
+func (r *Registry) AddBootVariant(boot BootVariant) error {
+	return r.r.AddBootVariant(boot.internal())
+}
+
+// SetSecureBoot replaces the Secure Boot variable hashes.
+func (r *Registry) SetSecureBoot(hashes SecureBootHashes) error {
+	return r.r.SetSecureBoot(hashes.internal())
+}
@@ -0,0 +1,60 @@
+package measure
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+func TestCatalogRoundTrip(t *testing.T) {
+	catalog := NewDefaultRegistry().Catalog()
+	if !reflect.DeepEqual(NewRegistry(catalog).Catalog(), catalog) {
+		t.Error("NewRegistry(c).Catalog() differs from c")
+	}
+
+	// The public catalog encodes like the internal one, so catalog files work with both.
+	data, err := catalog.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := internal.DefaultCatalog().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("Catalog.Marshal() = %s, want %s", data, want)
+	}
+	parsed, err := ParseCatalog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, catalog) {
+		t.Error("ParseCatalog(c.Marshal()) differs from c")
+	}
+}
+
+func TestRegistryUpdates(t *testing.T) {
+	r := NewDefaultRegistry()
+	name := r.MachineConfigurationNames()[0]
+	config, ok := r.MachineConfiguration(name)
+	if !ok {
+		t.Fatalf("MachineConfiguration(%s) not found", name)
+	}
+	acpi := config.AcpiHashes[0]
+	acpi.Epoch = "test"
+	if err := r.AddAcpiHashes(name, acpi); err != nil {
+		t.Fatal(err)
+	}
+	if updated, _ := r.MachineConfiguration(name); len(updated.AcpiHashes) != len(config.AcpiHashes)+1 {
+		t.Errorf("AddAcpiHashes() did not add the epoch: %+v", updated.AcpiHashes)
+	}
+	acpi.AcpiRsdpHash = HexBytes{1}
+	if err := r.AddAcpiHashes(name, acpi); err == nil {
+		t.Error("AddAcpiHashes() accepted a truncated digest")
+	}
+	if err := r.SetSecureBoot(SecureBootHashes{}); err == nil {
+		t.Error("SetSecureBoot() accepted empty hashes")
+	}
+}
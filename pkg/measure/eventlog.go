@@ -0,0 +1,63 @@
+package measure
+
+import "github.com/kvinwang/dstack-mr/internal"
+
+// Digest sources of an Event.
+const (
+	// DigestComputed marks digests computed from the inputs (firmware, image, machine shape).
+	DigestComputed = internal.DigestComputed
+	// DigestCatalog marks digests taken from the catalog of captured values.
+	DigestCatalog = internal.DigestCatalog
+)
+
+// Event is an event measured into a runtime measurement register.
+type Event struct {
+	// Register is the RTMR index (0-3).
+	Register int
+	// Type is the TCG event type.
+	Type        uint32
+	Description string
+	// Digest is the SHA-384 digest extended into the register.
+	Digest []byte
+	// Preimage is the event data, when known and small enough to keep. For most event types the
+	// digest is computed over it.
+	Preimage []byte
+	// Source is DigestComputed or DigestCatalog.
+	Source string
+}
+
+func newEvent(e *internal.Event) Event {
+	return Event{
+		Register:    e.Register,
+		Type:        e.Type,
+		Description: e.Description,
+		Digest:      e.Digest,
+		Preimage:    e.Preimage,
+		Source:      e.Source,
+	}
+}
+
+// Observer is notified of every event a Measurer extends into a register.
+type Observer interface {
+	// Extended is called with the event's index in its log and the register value after
+	// extending it.
+	Extended(index int, e *Event, value []byte)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(index int, e *Event, value []byte)
+
+// Extended calls f.
+func (f ObserverFunc) Extended(index int, e *Event, value []byte) {
+	f(index, e, value)
+}
+
+// observer notifies an Observer of the events of the internal event logs.
+type observer struct {
+	o Observer
+}
+
+func (o observer) Extended(index int, e *internal.Event, value []byte) {
+	event := newEvent(e)
+	o.o.Extended(index, &event, value)
+}
@@ -0,0 +1,191 @@
+package measure
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// TDVF metadata section types.
+const (
+	TdxSectionTypeBFV          = internal.TdxSectionTypeBFV
+	TdxSectionTypeCFV          = internal.TdxSectionTypeCFV
+	TdxSectionTypeTdHob        = internal.TdxSectionTypeTdHob
+	TdxSectionTypeTempMem      = internal.TdxSectionTypeTempMem
+	TdxSectionTypePermMem      = internal.TdxSectionTypePermMem
+	TdxSectionTypePayload      = internal.TdxSectionTypePayload
+	TdxSectionTypePayloadParam = internal.TdxSectionTypePayloadParam
+)
+
+// TdxMetadataSection is a section of the TDVF metadata of a firmware image.
+type TdxMetadataSection struct {
+	ImageOffset   uint32
+	RawDataSize   uint32
+	MemoryAddress uint64
+	MemorySize    uint64
+	Type          uint32
+	Attributes    uint32
+}
+
+// GetTdxMetadataSections parses the TDVF metadata sections of a firmware image.
+func GetTdxMetadataSections(fw []byte) ([]TdxMetadataSection, error) {
+	sections, err := internal.GetTdxMetadataSections(fw)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]TdxMetadataSection, 0, len(sections))
+	for _, s := range sections {
+		out = append(out, TdxMetadataSection(s))
+	}
+	return out, nil
+}
+
+// ParseGuidMap parses the GUIDed table at the end of a firmware image, keyed by GUID.
+func ParseGuidMap(fw []byte) (map[string][]byte, error) {
+	return internal.ParseGuidMap(fw)
+}
+
+// EfiVariable is a variable of a UEFI NV variable store.
+type EfiVariable struct {
+	VendorGuid string
+	Name       string
+	Attributes uint32
+	Data       []byte
+}
+
+// VariableStore holds the live variables of the NV variable store in a CFV.
+type VariableStore struct {
+	// Authenticated reports whether the store uses authenticated variable headers.
+	Authenticated bool
+	Variables     []EfiVariable
+	// FtwWorkingBlock reports whether a fault tolerant write working block follows the store,
+	// FtwPending whether it records writes that were not completed.
+	FtwWorkingBlock bool
+	FtwPending      bool
+}
+
+// ParseFirmwareVariableStore parses the NV variable store in the CFV of a firmware image.
+func ParseFirmwareVariableStore(fw []byte) (*VariableStore, error) {
+	cfv, err := internal.GetConfigurationFirmwareVolume(fw)
+	if err != nil {
+		return nil, err
+	}
+	s, err := internal.ParseVariableStore(cfv)
+	if err != nil {
+		return nil, err
+	}
+	out := &VariableStore{
+		Authenticated:   s.Authenticated,
+		FtwWorkingBlock: s.FtwWorkingBlock,
+		FtwPending:      s.FtwPending,
+	}
+	for _, v := range s.Variables {
+		out.Variables = append(out.Variables, EfiVariable(v))
+	}
+	return out, nil
+}
+
+// Variable returns a variable by vendor GUID and name.
+func (s *VariableStore) Variable(vendorGuid string, name string) (*EfiVariable, bool) {
+	for i := range s.Variables {
+		if s.Variables[i].VendorGuid == vendorGuid && s.Variables[i].Name == name {
+			return &s.Variables[i], true
+		}
+	}
+	return nil, false
+}
+
+// DefaultFirmwareBaseURL is where GCE publishes its TDX firmware images.
+const DefaultFirmwareBaseURL = internal.DefaultFirmwareBaseURL
+
+// ErrFirmwareHashMismatch is returned when firmware contents do not hash to the expected SHA-384.
+var ErrFirmwareHashMismatch = internal.ErrFirmwareHashMismatch
+
+// FirmwareSource provides firmware images by their SHA-384 hash. Sources do not need to verify
+// the contents; use FetchFirmware for that.
+type FirmwareSource interface {
+	Fetch(ctx context.Context, hash string) ([]byte, error)
+}
+
+// FetchFirmware fetches the firmware with the given hash from src and verifies its SHA-384.
+func FetchFirmware(ctx context.Context, src FirmwareSource, hash string) ([]byte, error) {
+	return internal.FetchFirmware(ctx, src, hash)
+}
+
+// HTTPFirmwareSource downloads firmware from BaseURL/<hash>.fd. It serves both the GCS bucket and
+// mirrors of it.
+type HTTPFirmwareSource struct {
+	BaseURL string
+	// Client is used for requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// NewHTTPFirmwareSource returns a source for the given base URL, or the GCE bucket if it is empty.
+func NewHTTPFirmwareSource(baseURL string) *HTTPFirmwareSource {
+	return (*HTTPFirmwareSource)(internal.NewHTTPFirmwareSource(baseURL))
+}
+
+func (s *HTTPFirmwareSource) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	return (*internal.HTTPFirmwareSource)(s).Fetch(ctx, hash)
+}
+
+// FSFirmwareSource reads firmware from <hash>.fd files in a file system, such as a local directory
+// or an embedded bundle.
+type FSFirmwareSource struct {
+	FS fs.FS
+}
+
+// NewDirFirmwareSource returns a source reading firmware from a local directory.
+func NewDirFirmwareSource(dir string) *FSFirmwareSource {
+	return (*FSFirmwareSource)(internal.NewDirFirmwareSource(dir))
+}
+
+func (s *FSFirmwareSource) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	return (*internal.FSFirmwareSource)(s).Fetch(ctx, hash)
+}
+
+// FirmwareCache is an on-disk, content-addressed store of firmware images keyed by their SHA-384.
+// Contents are verified both when they are written and when they are read back.
+type FirmwareCache struct {
+	Dir string
+}
+
+// NewFirmwareCache opens the firmware cache in dir, creating it if needed.
+func NewFirmwareCache(dir string) (*FirmwareCache, error) {
+	c, err := internal.NewFirmwareCache(dir)
+	if err != nil {
+		return nil, err
+	}
+	return (*FirmwareCache)(c), nil
+}
+
+// Get returns the cached firmware with the given hash. A missing entry yields an error satisfying
+// errors.Is(err, os.ErrNotExist). A corrupted entry is removed and ErrFirmwareHashMismatch is returned.
+func (c *FirmwareCache) Get(hash string) ([]byte, error) {
+	return (*internal.FirmwareCache)(c).Get(hash)
+}
+
+// Put stores the firmware after checking that it hashes to hash.
+func (c *FirmwareCache) Put(hash string, data []byte) error {
+	return (*internal.FirmwareCache)(c).Put(hash, data)
+}
+
+// CachedFirmwareSource serves firmware from a FirmwareCache and fills it from Source on misses.
+type CachedFirmwareSource struct {
+	Cache  *FirmwareCache
+	Source FirmwareSource
+	// Warn, if set, is called for cache errors that do not prevent fetching from Source, such as
+	// a cache directory that cannot be written.
+	Warn func(err error)
+}
+
+func (s *CachedFirmwareSource) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	src := &internal.CachedFirmwareSource{
+		Cache:  (*internal.FirmwareCache)(s.Cache),
+		Source: s.Source,
+		Warn:   s.Warn,
+	}
+	return src.Fetch(ctx, hash)
+}
@@ -0,0 +1,424 @@
+// Package measure computes the TDX reference measurements (MRTD and RTMR0-3) of dstack images
+// booted on Google Compute Engine confidential VMs.
+//
+// The package API is versioned by APIVersion. Within an API version, exported identifiers are
+// neither removed nor changed incompatibly; such changes increment APIVersion. The types are the
+// package's own and do not change with the module's internal implementation.
+package measure
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// APIVersion is the version of the package API.
+const APIVersion = 1
+
+// Options configures a Measurer.
+type Options struct {
+	// Registry provides the catalog of captured measurements. Nil uses the embedded catalog.
+	Registry *Registry
+	// Configurations selects the machine configurations (e.g. "c3-standard-4") RTMR0 is computed
+	// for. Nil selects all known configurations. The TD HOB and ACPI tables are always taken from
+	// the configuration.
+	Configurations []string
+	// Boot holds the boot options of the VM. When set, the BootOrder and Boot#### events are
+	// computed from it instead of taken from the catalog's boot variants, and labeled with the
+	// boot variant they reproduce.
+	Boot *BootConfiguration
+	// AllowUnverified keeps boot option measurements computed from Boot that match no captured
+	// value; otherwise measuring fails with ErrUnverifiedMeasurement. The values using them are
+	// flagged in RTMR0Value.Unverified.
+	AllowUnverified bool
+	// App selects the app deployment RTMR3 is computed for. Nil leaves RTMR3 empty.
+	App *AppDeployment
+	// SecureBootFromFirmware measures the Secure Boot variables stored in each firmware's
+	// variable store instead of using the catalog hashes.
+	SecureBootFromFirmware bool
+	// Debug prints every event digest to stderr.
+	Debug bool
+	// Observers are notified of every measured event.
+	Observers []Observer
+	// Warn is called with problems that do not stop measuring, such as a published MRTD the
+	// computed one differs from. Nil ignores them.
+	Warn func(error)
+}
+
+// Measurer computes reference measurements. It is safe for concurrent use.
+type Measurer struct {
+	opts Options
+}
+
+// New returns a Measurer using the given options.
+func New(opts Options) *Measurer {
+	if opts.Registry == nil {
+		opts.Registry = NewDefaultRegistry()
+	}
+	return &Measurer{opts: opts}
+}
+
+func (m *Measurer) shape() internal.MachineShape {
+	return internal.MachineShape{Boot: m.opts.Boot.internal(), AllowUnverified: m.opts.AllowUnverified}
+}
+
+// ErrUnverifiedMeasurement is returned when a measurement computed from the machine shape matches
+// no captured value and Options.AllowUnverified is not set.
+var ErrUnverifiedMeasurement = internal.ErrUnverifiedMeasurement
+
+func (m *Measurer) warn(err error) {
+	if m.opts.Warn != nil {
+		m.opts.Warn(err)
+	}
+}
+
+func (m *Measurer) observers() []internal.Observer {
+	var observers []internal.Observer
+	if m.opts.Debug {
+		observers = append(observers, internal.DebugObserver(os.Stderr))
+	}
+	for _, o := range m.opts.Observers {
+		observers = append(observers, observer{o})
+	}
+	return observers
+}
+
+// MeasureMRTD computes the MRTD of a firmware image. It is not yet validated against every
+// published firmware; the reference values use the published MRTD of the firmware the catalog
+// lists.
+func (m *Measurer) MeasureMRTD(ctx context.Context, fw []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return internal.MeasureMRTD(fw)
+}
+
+// MeasureRTMR0 computes the RTMR0 values of a firmware image, one per machine configuration,
+// ACPI epoch and boot variant.
+func (m *Measurer) MeasureRTMR0(ctx context.Context, fw []byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	registry, err := m.registry(fw)
+	if err != nil {
+		return nil, err
+	}
+	return registry.MeasureRTMR0(fw, m.opts.Configurations, m.shape(), m.observers()...)
+}
+
+// RTMR0Value is an RTMR0 reference value together with the variant it was computed for.
+type RTMR0Value struct {
+	// Firmware is the SHA-384 of the firmware image, which names it in the published bucket.
+	Firmware      []byte
+	MRTD          []byte
+	Configuration string
+	AcpiEpoch     string
+	// BootVariant is the index of the catalog boot variant, or -1 when the boot options computed
+	// from Options.Boot match none.
+	BootVariant int
+	// Unverified names the computed events that match no captured value, see
+	// Options.AllowUnverified.
+	Unverified []string
+	Value      []byte
+}
+
+// CompareRTMR0Values orders RTMR0 values by firmware, machine configuration, ACPI epoch and boot
+// variant.
+func CompareRTMR0Values(a, b RTMR0Value) int {
+	return cmp.Or(
+		bytes.Compare(a.Firmware, b.Firmware),
+		cmp.Compare(a.Configuration, b.Configuration),
+		cmp.Compare(a.AcpiEpoch, b.AcpiEpoch),
+		cmp.Compare(a.BootVariant, b.BootVariant),
+	)
+}
+
+// MeasureRTMR0Variants computes the RTMR0 values of a firmware image like MeasureRTMR0, labeled
+// with the variant each was computed for and sorted with CompareRTMR0Values.
+func (m *Measurer) MeasureRTMR0Variants(ctx context.Context, fw []byte) ([]RTMR0Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mrtd, err := m.opts.Registry.MRTD(fw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate MRTD: %w", err)
+	}
+	return m.rtmr0Variants(ctx, fw, mrtd)
+}
+
+// rtmr0Variants computes the labeled RTMR0 values of a firmware image whose MRTD is mrtd.
+func (m *Measurer) rtmr0Variants(ctx context.Context, fw []byte, mrtd []byte) ([]RTMR0Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	registry, err := m.registry(fw)
+	if err != nil {
+		return nil, err
+	}
+	values, err := registry.MeasureRTMR0Variants(fw, mrtd, m.opts.Configurations, m.shape(), m.observers()...)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RTMR0Value, 0, len(values))
+	for _, v := range values {
+		out = append(out, RTMR0Value(v))
+	}
+	return out, nil
+}
+
+// registry returns the registry RTMR0 of a firmware image is computed with.
+func (m *Measurer) registry(fw []byte) (*internal.Registry, error) {
+	if !m.opts.SecureBootFromFirmware {
+		return m.opts.Registry.r, nil
+	}
+	registry, err := m.opts.Registry.r.WithFirmwareSecureBoot(fw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure Secure Boot variables of firmware: %w", err)
+	}
+	return registry, nil
+}
+
+// MeasureRTMR1And2 computes RTMR1 and RTMR2 from a UKI and the initrd and kernel cmdline it
+// contains (see ExtractUKISections).
+func (m *Measurer) MeasureRTMR1And2(ctx context.Context, uki []byte, initrd []byte, cmdline string) (rtmr1 []byte, rtmr2 []byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return internal.MeasureRTMR1And2(uki, initrd, cmdline, m.observers()...)
+}
+
+// MeasureDirectBootRTMR1And2 computes RTMR1 and RTMR2 of an EFI stub kernel booted directly,
+// without a UKI, with the given initrd and kernel cmdline.
+func (m *Measurer) MeasureDirectBootRTMR1And2(ctx context.Context, kernel []byte, initrd []byte, cmdline string) (rtmr1 []byte, rtmr2 []byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return internal.MeasureDirectBootRTMR1And2(kernel, initrd, cmdline, m.observers()...)
+}
+
+// MeasureRTMR3 computes RTMR3 from the runtime events of the app deployment, or returns the
+// empty register value when no deployment was selected.
+func (m *Measurer) MeasureRTMR3(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.opts.App == nil {
+		return hex.DecodeString(internal.Empty)
+	}
+	return internal.MeasureRTMR3(m.opts.App.internal(), m.observers()...)
+}
+
+// PCRCount is the number of vTPM PCRs predicted by PredictPCRs, PCR0-9.
+const PCRCount = internal.PCRCount
+
+// PCRBankAlgorithms lists the hash algorithms of the PCR banks PredictPCRs supports: only SHA-384,
+// as the catalog only records SHA-384 digests.
+var PCRBankAlgorithms = slices.Clone(internal.PCRBankAlgorithms)
+
+// PCR0Note describes what the predicted PCR0 lacks compared to a TPM's PCR0.
+const PCR0Note = internal.PCR0Note
+
+// PredictPCRs predicts the vTPM PCR0-9 values in the bank of the given hash algorithm for a
+// firmware image and a UKI, one set per machine configuration, ACPI epoch and boot variant. The
+// RTMR events are mapped back to the PCRs the firmware extends on a TPM; PCR0 only covers the CFV,
+// see PCR0Note. alg must be one of PCRBankAlgorithms; the SHA-256 bank is not supported.
+func (m *Measurer) PredictPCRs(ctx context.Context, fw []byte, uki []byte, initrd []byte, cmdline string, alg crypto.Hash) ([][PCRCount][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rtmr1Log, rtmr2Log, err := internal.ExpectedRTMR1And2Logs(uki, initrd, cmdline)
+	if err != nil {
+		return nil, err
+	}
+	return m.predictPCRs(ctx, fw, rtmr1Log, rtmr2Log, alg)
+}
+
+// PredictDirectBootPCRs predicts the vTPM PCR0-9 values like PredictPCRs, for an EFI stub kernel
+// booted directly with the given initrd and kernel cmdline.
+func (m *Measurer) PredictDirectBootPCRs(ctx context.Context, fw []byte, kernel []byte, initrd []byte, cmdline string, alg crypto.Hash) ([][PCRCount][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rtmr1Log, rtmr2Log, err := internal.ExpectedDirectBootRTMR1And2Logs(kernel, initrd, cmdline)
+	if err != nil {
+		return nil, err
+	}
+	return m.predictPCRs(ctx, fw, rtmr1Log, rtmr2Log, alg)
+}
+
+// predictPCRs predicts the PCRs of every RTMR0 variant of a firmware image booting into the given
+// RTMR1 and RTMR2 logs.
+func (m *Measurer) predictPCRs(ctx context.Context, fw []byte, rtmr1Log *internal.EventLog, rtmr2Log *internal.EventLog, alg crypto.Hash) ([][PCRCount][]byte, error) {
+	registry, err := m.registry(fw)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := registry.ExpectedRTMR0Logs(fw, m.opts.Configurations, m.shape())
+	if err != nil {
+		return nil, err
+	}
+	var out [][PCRCount][]byte
+	for _, v := range variants {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pcrs, err := internal.PredictPCRs(alg, v.Log, rtmr1Log, rtmr2Log)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pcrs)
+	}
+	return out, nil
+}
+
+// Measurements are the reference values of an image. A quote matches when its MRTD and RTMR0
+// equal the MRTD and Value of one of RTMR0Variants, and each of its other registers equals the
+// corresponding value; see MatchRTMR0.
+type Measurements struct {
+	// MRTD holds one value per firmware image.
+	MRTD [][]byte
+	// RTMR0 holds one value per firmware image, machine configuration, ACPI epoch and boot variant.
+	RTMR0 [][]byte
+	// RTMR0Variants labels the values of RTMR0, in the same order.
+	RTMR0Variants []RTMR0Value
+	RTMR1         []byte
+	RTMR2         []byte
+	RTMR3         []byte
+	MRConfigID    []byte
+	XFAM          []byte
+	TDAttributes  []byte
+	// MRAggregated holds MRAggregated of each RTMR0 value, in the order of RTMR0.
+	MRAggregated [][]byte
+	// MRImage holds MRImage of each firmware image, in the order of MRTD.
+	MRImage [][]byte
+}
+
+// MatchRTMR0 returns the RTMR0 variant a quote's MRTD and RTMR0 match together, or nil. An
+// RTMR0 value computed for one firmware does not match a quote carrying the MRTD of another.
+func (m *Measurements) MatchRTMR0(mrtd []byte, rtmr0 []byte) *RTMR0Value {
+	for i, v := range m.RTMR0Variants {
+		if bytes.Equal(v.MRTD, mrtd) && bytes.Equal(v.Value, rtmr0) {
+			return &m.RTMR0Variants[i]
+		}
+	}
+	return nil
+}
+
+// MRAggregated computes SHA256(MRTD || RTMR0 || RTMR1 || RTMR2), the aggregated measurement the
+// dstack KMS identifies a TD by.
+func MRAggregated(mrtd []byte, rtmr0 []byte, rtmr1 []byte, rtmr2 []byte) []byte {
+	return internal.MRAggregated(mrtd, rtmr0, rtmr1, rtmr2)
+}
+
+// MRImage computes SHA256(MRTD || RTMR1 || RTMR2), the OS image hash registered with the dstack
+// KMS.
+func MRImage(mrtd []byte, rtmr1 []byte, rtmr2 []byte) []byte {
+	return internal.MRImage(mrtd, rtmr1, rtmr2)
+}
+
+// Measure computes all reference values of a UKI booted with any of the given firmware images.
+func (m *Measurer) Measure(ctx context.Context, firmwares [][]byte, uki []byte) (*Measurements, error) {
+	cmdline, initrd, err := ExtractUKISections(uki)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract sections from UKI: %w", err)
+	}
+	return m.measure(ctx, firmwares, func() ([]byte, []byte, error) {
+		return m.MeasureRTMR1And2(ctx, uki, initrd, cmdline)
+	})
+}
+
+// MeasureDirectBoot computes all reference values of an EFI stub kernel booted directly with the
+// given initrd and kernel cmdline, with any of the given firmware images.
+func (m *Measurer) MeasureDirectBoot(ctx context.Context, firmwares [][]byte, kernel []byte, initrd []byte, cmdline string) (*Measurements, error) {
+	return m.measure(ctx, firmwares, func() ([]byte, []byte, error) {
+		return m.MeasureDirectBootRTMR1And2(ctx, kernel, initrd, cmdline)
+	})
+}
+
+// measure computes all reference values of the boot measured into RTMR1 and RTMR2 by
+// measureRTMR1And2, with any of the given firmware images.
+func (m *Measurer) measure(ctx context.Context, firmwares [][]byte, measureRTMR1And2 func() ([]byte, []byte, error)) (*Measurements, error) {
+	var (
+		out Measurements
+		err error
+	)
+	for _, fw := range firmwares {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mrtd, err := m.opts.Registry.MRTD(fw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate MRTD: %w", err)
+		}
+		rtmr0s, err := m.rtmr0Variants(ctx, fw, mrtd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate RTMR0: %w", err)
+		}
+		out.MRTD = append(out.MRTD, mrtd)
+		out.RTMR0Variants = append(out.RTMR0Variants, rtmr0s...)
+	}
+	slices.SortStableFunc(out.RTMR0Variants, CompareRTMR0Values)
+	for _, v := range out.RTMR0Variants {
+		out.RTMR0 = append(out.RTMR0, v.Value)
+	}
+
+	out.RTMR1, out.RTMR2, err = measureRTMR1And2()
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate measurements: %w", err)
+	}
+
+	if out.RTMR3, err = m.MeasureRTMR3(ctx); err != nil {
+		return nil, fmt.Errorf("failed to calculate RTMR3: %w", err)
+	}
+
+	for _, v := range out.RTMR0Variants {
+		out.MRAggregated = append(out.MRAggregated, MRAggregated(v.MRTD, v.Value, out.RTMR1, out.RTMR2))
+	}
+	for _, mrtd := range out.MRTD {
+		out.MRImage = append(out.MRImage, MRImage(mrtd, out.RTMR1, out.RTMR2))
+	}
+
+	for _, f := range []struct {
+		dst *[]byte
+		hex string
+	}{
+		{&out.MRConfigID, internal.Empty},
+		{&out.XFAM, internal.XFAM},
+		{&out.TDAttributes, internal.TDAttributes},
+	} {
+		if *f.dst, err = hex.DecodeString(f.hex); err != nil {
+			return nil, err
+		}
+	}
+	return &out, nil
+}
+
+// ExtractUKISections extracts the kernel cmdline and initrd from a UKI.
+func ExtractUKISections(uki []byte) (cmdline string, initrd []byte, err error) {
+	return internal.ExtractUKISections(uki)
+}
+
+// FetchPublishedFirmware fetches every published firmware of the registry's catalog from src.
+// A firmware whose computed MRTD differs from its published MRTD is reported to Options.Warn; the
+// published MRTD stays the reference value. The result can be passed to Measure.
+func (m *Measurer) FetchPublishedFirmware(ctx context.Context, src FirmwareSource) ([][]byte, error) {
+	var firmwares [][]byte
+	for _, fw := range m.opts.Registry.Firmware() {
+		data, err := FetchFirmware(ctx, src, fw.FirmwareFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch firmware: %w", err)
+		}
+		if err := internal.CheckPublishedMRTD(data, internal.FirmwareMRTD(fw)); err != nil {
+			m.warn(err)
+		}
+		firmwares = append(firmwares, data)
+	}
+	return firmwares, nil
+}
@@ -0,0 +1,93 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m := New(Options{})
+	src := &FSFirmwareSource{FS: fstest.MapFS{}}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "MeasureMRTD", call: func() error { _, err := m.MeasureMRTD(ctx, nil); return err }},
+		{name: "MeasureRTMR0", call: func() error { _, err := m.MeasureRTMR0(ctx, nil); return err }},
+		{name: "MeasureRTMR1And2", call: func() error { _, _, err := m.MeasureRTMR1And2(ctx, nil, nil, ""); return err }},
+		{name: "FetchPublishedFirmware", call: func() error { _, err := m.FetchPublishedFirmware(ctx, src); return err }},
+		{name: "MeasureDirectBoot", call: func() error { _, err := m.MeasureDirectBoot(ctx, [][]byte{nil}, nil, nil, ""); return err }},
+		{name: "MeasureRTMR0Variants", call: func() error { _, err := m.MeasureRTMR0Variants(ctx, nil); return err }},
+		{name: "PredictPCRs", call: func() error { _, err := m.PredictPCRs(ctx, nil, nil, nil, "", crypto.SHA384); return err }},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s() error = %v, want context.Canceled", tt.name, err)
+		}
+	}
+}
+
+func TestMeasureInvalidInput(t *testing.T) {
+	m := New(Options{})
+	if _, err := m.Measure(context.Background(), nil, []byte("not a PE file")); err == nil || !strings.Contains(err.Error(), "failed to extract sections from UKI") {
+		t.Errorf("Measure() error = %v, want a UKI error", err)
+	}
+	if _, err := GetTdxMetadataSections(make([]byte, 16)); err == nil {
+		t.Error("GetTdxMetadataSections() accepted a truncated firmware")
+	}
+}
+
+func TestCompareRTMR0Values(t *testing.T) {
+	value := func(firmware byte, configuration, epoch string, boot int) RTMR0Value {
+		return RTMR0Value{Firmware: []byte{firmware}, Configuration: configuration, AcpiEpoch: epoch, BootVariant: boot}
+	}
+	want := []RTMR0Value{
+		value(0x01, "c3-standard-22", "2025-06", 0),
+		value(0x01, "c3-standard-4", "2025-06", -1),
+		value(0x01, "c3-standard-4", "2025-06", 0),
+		value(0x01, "c3-standard-4", "2026-03", 0),
+		value(0x02, "c3-standard-22", "2025-06", 0),
+	}
+	values := slices.Clone(want)
+	slices.Reverse(values)
+	slices.SortStableFunc(values, CompareRTMR0Values)
+	if !slices.EqualFunc(values, want, func(a, b RTMR0Value) bool { return CompareRTMR0Values(a, b) == 0 }) {
+		t.Errorf("sorted values = %+v, want %+v", values, want)
+	}
+}
+
+func TestObservers(t *testing.T) {
+	var events []Event
+	var last []byte
+	m := New(Options{
+		App: &AppDeployment{ComposeHash: make([]byte, 32), AppID: make([]byte, 20)},
+		Observers: []Observer{ObserverFunc(func(index int, e *Event, value []byte) {
+			events = append(events, *e)
+			last = value
+		})},
+	})
+	rtmr3, err := m.MeasureRTMR3(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != len(DefaultRuntimeEventOrder) {
+		t.Fatalf("observed %d events, want %d", len(events), len(DefaultRuntimeEventOrder))
+	}
+	for i, e := range events {
+		if e.Register != 3 || e.Description != DefaultRuntimeEventOrder[i] || e.Source != DigestComputed {
+			t.Errorf("event %d = %+v, want the computed %s runtime event", i, e, DefaultRuntimeEventOrder[i])
+		}
+	}
+	if !bytes.Equal(last, rtmr3) {
+		t.Errorf("last observed value %x, want RTMR3 %x", last, rtmr3)
+	}
+}
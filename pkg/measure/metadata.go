@@ -0,0 +1,58 @@
+package measure
+
+import "github.com/kvinwang/dstack-mr/internal"
+
+// RecordedMeasurements holds the reference values recorded in an image's metadata.json. Absent
+// values are not checked.
+type RecordedMeasurements struct {
+	MRTD         HexBytes `json:"mrtd,omitempty"`
+	RTMR0        HexBytes `json:"rtmr0,omitempty"`
+	RTMR1        HexBytes `json:"rtmr1,omitempty"`
+	RTMR2        HexBytes `json:"rtmr2,omitempty"`
+	MRAggregated HexBytes `json:"mr_aggregated,omitempty"`
+	MRImage      HexBytes `json:"mr_image,omitempty"`
+}
+
+// ImageMetadata is the metadata.json of a dstack image release directory.
+type ImageMetadata struct {
+	// Bios is the path of the firmware image built with the image. GCE boots its own published
+	// firmware, so it is only measured on explicit request.
+	Bios string `json:"bios,omitempty"`
+	// UKI is the path of the unified kernel image.
+	UKI string `json:"uki,omitempty"`
+	// Kernel, Initrd and Cmdline describe the boot of a kernel without a UKI. When a UKI is given,
+	// the initrd and cmdline it embeds are measured instead.
+	Kernel  string `json:"kernel,omitempty"`
+	Initrd  string `json:"initrd,omitempty"`
+	Cmdline string `json:"cmdline,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Measurements are the reference values recorded for the image.
+	Measurements *RecordedMeasurements `json:"measurements,omitempty"`
+}
+
+// LoadImageMetadata reads a metadata.json and resolves its paths relative to the file.
+func LoadImageMetadata(path string) (*ImageMetadata, error) {
+	m, err := internal.LoadImageMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+	out := &ImageMetadata{
+		Bios:    m.Bios,
+		UKI:     m.UKI,
+		Kernel:  m.Kernel,
+		Initrd:  m.Initrd,
+		Cmdline: m.Cmdline,
+		Version: m.Version,
+	}
+	if r := m.Measurements; r != nil {
+		out.Measurements = &RecordedMeasurements{
+			MRTD:         HexBytes(r.MRTD),
+			RTMR0:        HexBytes(r.RTMR0),
+			RTMR1:        HexBytes(r.RTMR1),
+			RTMR2:        HexBytes(r.RTMR2),
+			MRAggregated: HexBytes(r.MRAggregated),
+			MRImage:      HexBytes(r.MRImage),
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,63 @@
+package measure
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFetchFirmwareFromMirror(t *testing.T) {
+	fw := []byte("published firmware")
+	sum := sha512.Sum384(fw)
+	hash := hex.EncodeToString(sum[:])
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ovmf/"+hash+".fd", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fw)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cache, err := NewFirmwareCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &CachedFirmwareSource{Cache: cache, Source: NewHTTPFirmwareSource(srv.URL + "/ovmf")}
+	data, err := FetchFirmware(context.Background(), src, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, fw) {
+		t.Errorf("FetchFirmware() = %q, want %q", data, fw)
+	}
+	if _, err := cache.Get(hash); err != nil {
+		t.Errorf("firmware not cached: %v", err)
+	}
+}
+
+func TestFetchPublishedFirmwareMRTDMismatch(t *testing.T) {
+	fw := []byte("published firmware")
+	sum := sha512.Sum384(fw)
+	hash := hex.EncodeToString(sum[:])
+	catalog := NewDefaultRegistry().Catalog()
+	catalog.Firmware = []FirmwareMRTD{{FirmwareFile: hash, MRTD: strings.Repeat("ab", 48)}}
+
+	var warnings []error
+	m := New(Options{Registry: NewRegistry(catalog), Warn: func(err error) { warnings = append(warnings, err) }})
+	src := &FSFirmwareSource{FS: fstest.MapFS{hash + ".fd": {Data: fw}}}
+	firmwares, err := m.FetchPublishedFirmware(context.Background(), src)
+	if err != nil {
+		t.Fatalf("FetchPublishedFirmware() error = %v, want a warning only", err)
+	}
+	if len(firmwares) != 1 || !bytes.Equal(firmwares[0], fw) {
+		t.Errorf("FetchPublishedFirmware() = %q, want the published firmware", firmwares)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the unreproduced MRTD", warnings)
+	}
+}
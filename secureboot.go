@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+// absentVariable is the key database value selecting an absent variable.
+const absentVariable = "none"
+
+// secureBootFlags selects Secure Boot variable contents replacing the catalog hashes.
+type secureBootFlags struct {
+	enabled    bool
+	enabledSet bool
+	pk         string
+	kek        string
+	db         string
+	dbx        string
+	owner      string
+}
+
+func (s *secureBootFlags) register(fs *flag.FlagSet) {
+	fs.BoolFunc("secure-boot", "Value of the SecureBoot variable (true or false); defaults to the catalog hash", func(v string) error {
+		enabled, err := strconv.ParseBool(v)
+		s.enabled, s.enabledSet = enabled, true
+		return err
+	})
+	fs.StringVar(&s.pk, "secure-boot-pk", "", "PK contents: comma-separated .auth, .esl, DER or PEM files, or \"none\"; defaults to the catalog hash")
+	fs.StringVar(&s.kek, "secure-boot-kek", "", "KEK contents, as for -secure-boot-pk")
+	fs.StringVar(&s.db, "secure-boot-db", "", "db contents, as for -secure-boot-pk")
+	fs.StringVar(&s.dbx, "secure-boot-dbx", "", "dbx contents, as for -secure-boot-pk")
+	fs.StringVar(&s.owner, "secure-boot-owner", "00000000-0000-0000-0000-000000000000", "Signature owner GUID used when wrapping certificates into signature lists")
+}
+
+// set reports whether any Secure Boot variable was given.
+func (s *secureBootFlags) set() bool {
+	return s.enabledSet || s.pk != "" || s.kek != "" || s.db != "" || s.dbx != ""
+}
+
+// readSignatureDatabase reads and concatenates the signature lists of comma-separated key files.
+func readSignatureDatabase(paths string, owner string) ([]byte, error) {
+	if paths == absentVariable {
+		return nil, nil
+	}
+	var out []byte
+	for _, path := range strings.Split(paths, ",") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		lists, err := internal.ParseSignatureDatabase(data, owner)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+		}
+		out = append(out, lists...)
+	}
+	return out, nil
+}
+
+// hashes computes the hashes of the given Secure Boot variables; the others are taken from base.
+func (s *secureBootFlags) hashes(base internal.SecureBootHashes) (internal.SecureBootHashes, error) {
+	var vars internal.SecureBootVariables
+	vars.Enabled = s.enabled
+	for _, db := range []struct {
+		paths string
+		data  *[]byte
+	}{
+		{s.pk, &vars.PK},
+		{s.kek, &vars.KEK},
+		{s.db, &vars.DB},
+		{s.dbx, &vars.DBX},
+	} {
+		if db.paths == "" {
+			continue
+		}
+		var err error
+		if *db.data, err = readSignatureDatabase(db.paths, s.owner); err != nil {
+			return base, err
+		}
+	}
+
+	var names []string
+	if s.enabledSet {
+		names = append(names, "SecureBoot")
+	}
+	for _, db := range []struct{ name, paths string }{{"PK", s.pk}, {"KEK", s.kek}, {"db", s.db}, {"dbx", s.dbx}} {
+		if db.paths != "" {
+			names = append(names, db.name)
+		}
+	}
+	return base.Override(vars.Hashes(), names...), nil
+}
+
+type secureBootVariableOutput struct {
+	Name           string `json:"name"`
+	Digest         string `json:"digest"`
+	MatchesCatalog bool   `json:"matches_catalog"`
+}
+
+// runSecureBoot computes the EV_EFI_VARIABLE_DRIVER_CONFIG digests of the Secure Boot variables
+// and compares them with the catalog.
+func runSecureBoot(args []string) int {
+	var (
+		sb          secureBootFlags
+		catalogPath string
+	)
+	fs := flag.NewFlagSet("secureboot", flag.ExitOnError)
+	sb.register(fs)
+	fs.StringVar(&catalogPath, "catalog", "", "Path to a measurement catalog (defaults to the embedded catalog)")
+	fs.Parse(args)
+
+	registry, err := loadRegistry(catalogPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	catalog := registry.Catalog().SecureBoot
+	hashes, err := sb.hashes(catalog)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	output := []secureBootVariableOutput{}
+	for _, v := range []struct {
+		name             string
+		digest, expected []byte
+	}{
+		{"SecureBoot", hashes.SecureBoot, catalog.SecureBoot},
+		{"PK", hashes.PK, catalog.PK},
+		{"KEK", hashes.KEK, catalog.KEK},
+		{"db", hashes.DB, catalog.DB},
+		{"dbx", hashes.DBX, catalog.DBX},
+	} {
+		output = append(output, secureBootVariableOutput{
+			Name:           v.name,
+			Digest:         fmt.Sprintf("%x", v.digest),
+			MatchesCatalog: bytes.Equal(v.digest, v.expected),
+		})
+	}
+	jsonData, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(jsonData))
+	return 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+func TestSecureBootFlagsOwner(t *testing.T) {
+	// A DER certificate, wrapped into a signature list owned by -secure-boot-owner.
+	cert := filepath.Join(t.TempDir(), "db.der")
+	if err := os.WriteFile(cert, []byte{0x30, 0x03, 0x02, 0x01, 0x00}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	base := internal.DefaultCatalog().SecureBoot
+
+	valid := secureBootFlags{db: cert, owner: "77fa9abd-0359-4d32-bd60-28f4e78f784b"}
+	hashes, err := valid.hashes(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(hashes.DB, base.DB) {
+		t.Error("db hash was not computed from the certificate")
+	}
+
+	invalid := secureBootFlags{db: cert, owner: "77fa9abd-0359-4d32-bd60"}
+	if _, err := invalid.hashes(base); err == nil || !strings.Contains(err.Error(), "signature owner: invalid GUID") {
+		t.Errorf("hashes() error = %v, want an invalid owner", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+type tcbInfoCheck struct {
+	Check  string `json:"check"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type verifyTcbInfoOutput struct {
+	Pass   bool           `json:"pass"`
+	Checks []tcbInfoCheck `json:"checks"`
+}
+
+// checkTcbInfo checks the consistency of a tcb_info document and compares its MRTD and RTMR0-2
+// with the expected reference values, and its runtime events with the expected event order.
+func checkTcbInfo(info *internal.TcbInfo, expected *measurementOutput, eventOrder []string) verifyTcbInfoOutput {
+	var output verifyTcbInfoOutput
+	check := func(name string, err error) {
+		c := tcbInfoCheck{Check: name, Pass: err == nil}
+		if err != nil {
+			c.Detail = err.Error()
+		}
+		output.Checks = append(output.Checks, c)
+	}
+
+	// The event log must replay to the reported registers.
+	if log, err := info.Log(); err != nil {
+		check("event log", err)
+	} else {
+		replayed, reported := log.RTMRs(), info.RTMRs()
+		for i := range replayed {
+			var err error
+			if !bytes.Equal(replayed[i], reported[i]) {
+				err = fmt.Errorf("event log replays to %x, reported %x", replayed[i], reported[i])
+			}
+			check(fmt.Sprintf("RTMR%d replay", i), err)
+		}
+	}
+	check("runtime events", info.CheckRuntimeEvents())
+
+	// The boot runtime events must come in the expected order; apps may extend events after them.
+	var orderErr error
+	if names := info.RuntimeEventNames(); len(names) < len(eventOrder) || !slices.Equal(names[:len(eventOrder)], eventOrder) {
+		orderErr = fmt.Errorf("event log has %s, expected %s (select the order with -runtime-events)", strings.Join(names, ","), strings.Join(eventOrder, ","))
+	}
+	check("event order", orderErr)
+
+	// The compose hash measured into RTMR3 must be the hash of the embedded app-compose.json.
+	measured, err := info.BootRuntimeEventPayload(eventOrder, "compose-hash")
+	if h := sha256.Sum256([]byte(info.AppCompose)); err == nil && !bytes.Equal(measured, h[:]) {
+		err = fmt.Errorf("app_compose hashes to %x, measured %x", h, measured)
+	}
+	check("compose-hash", err)
+
+	reference := func(name string, actual []byte, allowed ...string) {
+		var err error
+		if hex := fmt.Sprintf("%x", actual); !slices.Contains(allowed, hex) {
+			err = fmt.Errorf("%s does not match any expected value", hex)
+		}
+		check(name, err)
+	}
+	reference("MRTD", info.MRTD, expected.MRTD...)
+	reference("RTMR0", info.RTMR0, expected.rtmr0Values()...)
+	// RTMR0 must match a variant of the firmware the reported MRTD was measured from.
+	c := &output.Checks[len(output.Checks)-1]
+	if v := expected.pairedRTMR0Variant(fmt.Sprintf("%x", info.MRTD), fmt.Sprintf("%x", info.RTMR0)); v != nil {
+		c.Detail = fmt.Sprintf("matches %s, ACPI epoch %s, boot variant %d of firmware %.16s", v.Configuration, v.AcpiEpoch, v.BootVariant, v.Firmware)
+	} else if c.Pass {
+		c.Pass = false
+		c.Detail = fmt.Sprintf("matches a variant of another firmware than MRTD %.16s", fmt.Sprintf("%x", info.MRTD))
+	}
+	reference("RTMR1", info.RTMR1, expected.RTMR1)
+	reference("RTMR2", info.RTMR2, expected.RTMR2)
+
+	output.Pass = true
+	for _, c := range output.Checks {
+		output.Pass = output.Pass && c.Pass
+	}
+	return output
+}
+
+// runVerifyTcbInfo verifies a tcb_info document reported by the dstack guest agent: its event log
+// must replay to the reported RTMRs and its app-compose.json must match the measured compose hash,
+// and MRTD and RTMR0-2 must match the reference values of the image.
+func runVerifyTcbInfo(args []string) int {
+	var (
+		m           measureFlags
+		tcbInfoPath string
+		jsonOutput  bool
+	)
+	fs := flag.NewFlagSet("verify-tcbinfo", flag.ExitOnError)
+	m.register(fs)
+	fs.StringVar(&tcbInfoPath, "tcbinfo", "", "Path to the tcb_info JSON (or the guest agent info response)")
+	fs.BoolVar(&jsonOutput, "json", false, "Output the result as JSON")
+	fs.Parse(args)
+
+	data, err := os.ReadFile(tcbInfoPath)
+	if err != nil {
+		fmt.Printf("Error reading tcb_info: %v\n", err)
+		return 1
+	}
+	info, err := internal.ParseTcbInfo(data)
+	if err != nil {
+		fmt.Printf("Error parsing tcb_info: %v\n", err)
+		return 1
+	}
+
+	expected, err := m.measure(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	output := checkTcbInfo(info, expected, m.app.runtimeEventOrder())
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		for _, c := range output.Checks {
+			result := "PASS"
+			if !c.Pass {
+				result = "FAIL"
+			}
+			fmt.Printf("%-14s %s", c.Check, result)
+			if c.Detail != "" {
+				fmt.Printf("  %s", c.Detail)
+			}
+			fmt.Println()
+		}
+		if output.Pass {
+			fmt.Println("verdict: PASS")
+		} else {
+			fmt.Println("verdict: FAIL")
+		}
+	}
+
+	if !output.Pass {
+		return 1
+	}
+	return 0
+}
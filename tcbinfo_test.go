@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+func TestCheckTcbInfoRTMR0Pairing(t *testing.T) {
+	reg := func(b byte) []byte { return bytes.Repeat([]byte{b}, 48) }
+	hexReg := func(b byte) string { return hex.EncodeToString(reg(b)) }
+	expected := &measurementOutput{
+		MRTD: []string{hexReg(0xa0), hexReg(0xb0)},
+		RTMR0: []rtmr0Output{
+			{Value: hexReg(0xa1), MRTD: hexReg(0xa0), Configuration: "c3-standard-4"},
+			{Value: hexReg(0xb1), MRTD: hexReg(0xb0), Configuration: "c3-standard-4"},
+		},
+		RTMR1: hexReg(0x01),
+		RTMR2: hexReg(0x02),
+	}
+
+	tests := []struct {
+		name        string
+		mrtd, rtmr0 byte
+		want        bool
+	}{
+		{name: "firmware A", mrtd: 0xa0, rtmr0: 0xa1, want: true},
+		{name: "MRTD of A with RTMR0 of B", mrtd: 0xa0, rtmr0: 0xb1, want: false},
+		{name: "unknown RTMR0", mrtd: 0xb0, rtmr0: 0xc1, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &internal.TcbInfo{MRTD: reg(tt.mrtd), RTMR0: reg(tt.rtmr0), RTMR1: reg(0x01), RTMR2: reg(0x02)}
+			output := checkTcbInfo(info, expected, nil)
+			for _, c := range output.Checks {
+				if c.Check == "RTMR0" && c.Pass != tt.want {
+					t.Errorf("RTMR0 check = %+v, want pass %v", c, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTcbInfoEventOrder(t *testing.T) {
+	runtimeEvents := func(names ...string) []internal.TcbInfoEvent {
+		var events []internal.TcbInfoEvent
+		for _, name := range names {
+			events = append(events, internal.TcbInfoEvent{IMR: 3, EventType: internal.EvDstackRuntimeEvent, Event: name})
+		}
+		return events
+	}
+	order := []string{"system-preparing", "app-id", "system-ready"}
+	tests := []struct {
+		name   string
+		events []internal.TcbInfoEvent
+		want   bool
+	}{
+		{name: "expected", events: runtimeEvents("system-preparing", "app-id", "system-ready"), want: true},
+		{name: "app events after boot", events: runtimeEvents("system-preparing", "app-id", "system-ready", "custom"), want: true},
+		{name: "reordered", events: runtimeEvents("app-id", "system-preparing", "system-ready"), want: false},
+		{name: "truncated", events: runtimeEvents("system-preparing", "app-id"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := checkTcbInfo(&internal.TcbInfo{EventLog: tt.events}, &measurementOutput{}, order)
+			for _, c := range output.Checks {
+				if c.Check == "event order" && c.Pass != tt.want {
+					t.Errorf("event order check = %+v, want pass %v", c, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTcbInfoComposeHash(t *testing.T) {
+	const appCompose = `{"runner":"docker-compose"}`
+	composeHash := sha256.Sum256([]byte(appCompose))
+	event := func(name string, payload []byte) internal.TcbInfoEvent {
+		return internal.TcbInfoEvent{IMR: 3, EventType: internal.EvDstackRuntimeEvent, Event: name, EventPayload: payload}
+	}
+	order := []string{"system-preparing", "compose-hash", "system-ready"}
+	tests := []struct {
+		name   string
+		events []internal.TcbInfoEvent
+		want   string
+	}{
+		{
+			name:   "measured at boot",
+			events: []internal.TcbInfoEvent{event("system-preparing", nil), event("compose-hash", composeHash[:]), event("system-ready", nil)},
+		},
+		{
+			// An app may extend an event of the same name after boot; only the boot one counts.
+			name: "app event appended after boot",
+			events: []internal.TcbInfoEvent{
+				event("system-preparing", nil), event("compose-hash", composeHash[:]), event("system-ready", nil),
+				event("compose-hash", bytes.Repeat([]byte{1}, 32)),
+			},
+		},
+		{
+			name: "only the appended event matches",
+			events: []internal.TcbInfoEvent{
+				event("system-preparing", nil), event("compose-hash", bytes.Repeat([]byte{1}, 32)), event("system-ready", nil),
+				event("compose-hash", composeHash[:]),
+			},
+			want: "app_compose hashes to",
+		},
+		{
+			name:   "missing at its boot position",
+			events: []internal.TcbInfoEvent{event("system-preparing", nil), event("system-ready", nil), event("compose-hash", composeHash[:])},
+			want:   "runtime event 1 is system-ready, expected compose-hash",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &internal.TcbInfo{EventLog: tt.events, AppCompose: appCompose}
+			output := checkTcbInfo(info, &measurementOutput{}, order)
+			for _, c := range output.Checks {
+				if c.Check != "compose-hash" {
+					continue
+				}
+				if tt.want == "" && !c.Pass {
+					t.Errorf("compose-hash check failed: %s", c.Detail)
+				} else if tt.want != "" && (c.Pass || !strings.Contains(c.Detail, tt.want)) {
+					t.Errorf("compose-hash check = %+v, want failure %q", c, tt.want)
+				}
+			}
+		})
+	}
+}
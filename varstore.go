@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+type variableOutput struct {
+	VendorGuid string `json:"vendor_guid"`
+	Name       string `json:"name"`
+	Attributes string `json:"attributes"`
+	Size       int    `json:"size"`
+}
+
+type varStoreOutput struct {
+	Authenticated   bool                       `json:"authenticated"`
+	FtwWorkingBlock bool                       `json:"ftw_working_block"`
+	FtwPending      bool                       `json:"ftw_pending"`
+	Variables       []variableOutput           `json:"variables"`
+	SecureBoot      []secureBootVariableOutput `json:"secure_boot"`
+}
+
+// runVarStore lists the variables stored in a firmware's CFV and measures its Secure Boot databases.
+func runVarStore(args []string) int {
+	var (
+		fwPath      string
+		catalogPath string
+		jsonOutput  bool
+	)
+	fs := flag.NewFlagSet("varstore", flag.ExitOnError)
+	fs.StringVar(&fwPath, "fw", "", "Path to firmware file")
+	fs.StringVar(&catalogPath, "catalog", "", "Path to a measurement catalog (defaults to the embedded catalog)")
+	fs.BoolVar(&jsonOutput, "json", false, "Output the result as JSON")
+	fs.Parse(args)
+
+	fwData, err := os.ReadFile(fwPath)
+	if err != nil {
+		fmt.Printf("Error reading firmware file: %v\n", err)
+		return 1
+	}
+	cfv, err := internal.GetConfigurationFirmwareVolume(fwData)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	store, err := internal.ParseVariableStore(cfv)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	registry, err := loadRegistry(catalogPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	output := varStoreOutput{
+		Authenticated:   store.Authenticated,
+		FtwWorkingBlock: store.FtwWorkingBlock,
+		FtwPending:      store.FtwPending,
+		Variables:       []variableOutput{},
+	}
+	for _, v := range store.Variables {
+		output.Variables = append(output.Variables, variableOutput{
+			VendorGuid: v.VendorGuid,
+			Name:       v.Name,
+			Attributes: fmt.Sprintf("%#x", v.Attributes),
+			Size:       len(v.Data),
+		})
+	}
+	hashes := store.SecureBootVariables().Hashes()
+	catalog := registry.Catalog().SecureBoot
+	for _, v := range []struct {
+		name             string
+		digest, expected []byte
+	}{
+		{"SecureBoot", hashes.SecureBoot, catalog.SecureBoot},
+		{"PK", hashes.PK, catalog.PK},
+		{"KEK", hashes.KEK, catalog.KEK},
+		{"db", hashes.DB, catalog.DB},
+		{"dbx", hashes.DBX, catalog.DBX},
+	} {
+		output.SecureBoot = append(output.SecureBoot, secureBootVariableOutput{
+			Name:           v.name,
+			Digest:         fmt.Sprintf("%x", v.digest),
+			MatchesCatalog: bytes.Equal(v.digest, v.expected),
+		})
+	}
+
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+		return 0
+	}
+
+	fmt.Printf("Authenticated: %v, FTW working block: %v, FTW pending: %v\n\n", output.Authenticated, output.FtwWorkingBlock, output.FtwPending)
+	for _, v := range output.Variables {
+		fmt.Printf("%s %-24s %-6s %d bytes\n", v.VendorGuid, v.Name, v.Attributes, v.Size)
+	}
+	fmt.Println()
+	for _, v := range output.SecureBoot {
+		match := "catalog match"
+		if !v.MatchesCatalog {
+			match = "catalog MISMATCH"
+		}
+		fmt.Printf("%-10s %s  %s\n", v.Name, v.Digest, match)
+	}
+	return 0
+}
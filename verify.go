@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+type fieldCheck struct {
+	Field  string `json:"field"`
+	Actual string `json:"actual"`
+	Pass   bool   `json:"pass"`
+	// Variant is the RTMR0 variant that matched.
+	Variant *rtmr0Output `json:"variant,omitempty"`
+	Detail  string       `json:"detail,omitempty"`
+}
+
+type verifyOutput struct {
+	Pass   bool         `json:"pass"`
+	Fields []fieldCheck `json:"fields"`
+}
+
+// checkQuote compares the quote's TD report fields with the expected reference values.
+func checkQuote(quote *internal.TdxQuote, expected *measurementOutput) verifyOutput {
+	var output verifyOutput
+	check := func(field string, actual []byte, allowed ...string) {
+		hex := fmt.Sprintf("%x", actual)
+		output.Fields = append(output.Fields, fieldCheck{
+			Field:  field,
+			Actual: hex,
+			Pass:   slices.Contains(allowed, hex),
+		})
+	}
+
+	check("MRTD", quote.MRTD, expected.MRTD...)
+	check("RTMR0", quote.RTMR[0], expected.rtmr0Values()...)
+	// RTMR0 must match a variant of the firmware the quote's MRTD was measured from.
+	rtmr0 := &output.Fields[len(output.Fields)-1]
+	rtmr0.Variant = expected.pairedRTMR0Variant(fmt.Sprintf("%x", quote.MRTD), rtmr0.Actual)
+	if rtmr0.Pass && rtmr0.Variant == nil {
+		rtmr0.Pass = false
+		rtmr0.Detail = fmt.Sprintf("matches a variant of another firmware than MRTD %.16s", fmt.Sprintf("%x", quote.MRTD))
+	}
+	check("RTMR1", quote.RTMR[1], expected.RTMR1)
+	check("RTMR2", quote.RTMR[2], expected.RTMR2)
+	check("RTMR3", quote.RTMR[3], expected.RTMR3)
+	check("XFAM", quote.XFAM, expected.XFAM)
+	check("TDATTRIBUTES", quote.TdAttributes, expected.TDAttributes)
+	check("MRCONFIGID", quote.MrConfigID, expected.MRConfigID)
+
+	output.Pass = true
+	for _, f := range output.Fields {
+		output.Pass = output.Pass && f.Pass
+	}
+	return output
+}
+
+// runVerify checks the measurements in a TDX quote against the computed reference values.
+// Only the measurement registers are checked; the quote signature is not verified.
+func runVerify(args []string) int {
+	var (
+		m          measureFlags
+		quotePath  string
+		jsonOutput bool
+	)
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	m.register(fs)
+	fs.StringVar(&quotePath, "quote", "", "Path to a binary TDX quote (v4 or v5)")
+	fs.BoolVar(&jsonOutput, "json", false, "Output the result as JSON")
+	fs.Parse(args)
+
+	quoteData, err := os.ReadFile(quotePath)
+	if err != nil {
+		fmt.Printf("Error reading quote: %v\n", err)
+		return 1
+	}
+	quote, err := internal.ParseTdxQuote(quoteData)
+	if err != nil {
+		fmt.Printf("Error parsing quote: %v\n", err)
+		return 1
+	}
+
+	expected, err := m.measure(context.Background())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	output := checkQuote(quote, expected)
+	if jsonOutput {
+		jsonData, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+			return 1
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		for _, f := range output.Fields {
+			result := "PASS"
+			if !f.Pass {
+				result = "FAIL"
+			}
+			fmt.Printf("%-12s %s  %s", f.Field, result, f.Actual)
+			if v := f.Variant; v != nil {
+				fmt.Printf("  (%s, ACPI epoch %s, boot variant %d, firmware %.16s)", v.Configuration, v.AcpiEpoch, v.BootVariant, v.Firmware)
+			}
+			if f.Detail != "" {
+				fmt.Printf("  (%s)", f.Detail)
+			}
+			fmt.Println()
+		}
+	}
+
+	if !output.Pass {
+		return 1
+	}
+	return 0
+}
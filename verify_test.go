@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/kvinwang/dstack-mr/internal"
+)
+
+func TestCheckQuoteRTMR0Pairing(t *testing.T) {
+	reg := func(b byte) []byte { return bytes.Repeat([]byte{b}, 48) }
+	hexReg := func(b byte) string { return hex.EncodeToString(reg(b)) }
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	// Firmware A and B each have their own MRTD and RTMR0.
+	expected := &measurementOutput{
+		MRTD: []string{hexReg(0xa0), hexReg(0xb0)},
+		RTMR0: []rtmr0Output{
+			{Value: hexReg(0xa1), MRTD: hexReg(0xa0), Configuration: "c3-standard-4"},
+			{Value: hexReg(0xb1), MRTD: hexReg(0xb0), Configuration: "c3-standard-4"},
+		},
+		RTMR1:        hexReg(0x01),
+		RTMR2:        hexReg(0x02),
+		RTMR3:        hexReg(0x03),
+		XFAM:         internal.XFAM,
+		TDAttributes: internal.TDAttributes,
+		MRConfigID:   internal.Empty,
+	}
+	quote := func(mrtd, rtmr0 byte) *internal.TdxQuote {
+		return &internal.TdxQuote{
+			MRTD:         reg(mrtd),
+			RTMR:         [4][]byte{reg(rtmr0), reg(0x01), reg(0x02), reg(0x03)},
+			XFAM:         decode(internal.XFAM),
+			TdAttributes: decode(internal.TDAttributes),
+			MrConfigID:   decode(internal.Empty),
+		}
+	}
+
+	tests := []struct {
+		name  string
+		quote *internal.TdxQuote
+		want  bool
+	}{
+		{name: "firmware A", quote: quote(0xa0, 0xa1), want: true},
+		{name: "firmware B", quote: quote(0xb0, 0xb1), want: true},
+		{name: "MRTD of A with RTMR0 of B", quote: quote(0xa0, 0xb1), want: false},
+		{name: "unknown RTMR0", quote: quote(0xa0, 0xc1), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := checkQuote(tt.quote, expected)
+			if output.Pass != tt.want {
+				t.Errorf("Pass = %v, want %v: %+v", output.Pass, tt.want, output.Fields)
+			}
+		})
+	}
+}